@@ -2,16 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/spf13/viper"
 	"github.com/valyala/fasthttp"
-	"github.com/zhifu/donation-rank/models"
 	"github.com/zhifu/donation-rank/routes"
 	"github.com/zhifu/donation-rank/services"
 	"github.com/zhifu/donation-rank/utils"
@@ -59,11 +61,28 @@ func main() {
 		log.Printf("Warning: Database connection failed, some features may be limited")
 	}
 
+	// 启动自检汇总，启动完成后记录
+	report := services.StartupReport{Database: "failed", ReadReplica: "disabled"}
+	if dbConnected {
+		report.Database = "ok"
+	}
+
+	// 初始化只读副本（可选），排行榜等读查询走副本，未配置时使用主库
+	if readDSN := viper.GetString("mysql.read_dsn"); readDSN != "" {
+		if err := utils.InitReadDatabase(readDSN); err != nil {
+			log.Printf("Warning: Read replica connection failed, using primary for reads: %v", err)
+			report.ReadReplica = "failed"
+		} else {
+			log.Printf("Read replica connected successfully")
+			report.ReadReplica = "ok"
+		}
+	}
+
 	// 初始化主支付服务配置
 	var paymentService *services.PaymentService
 
-	// 从数据库加载支付配置
-	loadPaymentConfig := func() services.ShouqianbaConfig {
+	// 从数据库加载支付配置，未找到时返回默认配置和false
+	loadPaymentConfig := func() (services.ShouqianbaConfig, bool) {
 		// 默认配置
 		defaultConfig := services.ShouqianbaConfig{
 			VendorSN:   "default",
@@ -75,76 +94,44 @@ func main() {
 		}
 
 		if !dbConnected {
-			return defaultConfig
-		}
-
-		// 优先使用id=6的配置
-		var mainConfig models.PaymentConfig
-		if err := utils.DB.Where("id = ?", 6).First(&mainConfig).Error; err != nil {
-			// 尝试使用id=1的配置
-			if err := utils.DB.Where("id = ?", 1).First(&mainConfig).Error; err != nil {
-				// 尝试使用id=2的配置
-				if err := utils.DB.Where("id = ?", 2).First(&mainConfig).Error; err != nil {
-					// 尝试使用is_active=true的配置
-					if err := utils.DB.Where("is_active = ?", true).First(&mainConfig).Error; err != nil {
-						return defaultConfig
-					}
-				}
-			}
+			return defaultConfig, false
 		}
 
-		// 为选中的配置创建支付服务并签到
-		configService := services.NewPaymentService(services.ShouqianbaConfig{
-			VendorSN:         mainConfig.VendorSN,
-			VendorKey:        mainConfig.VendorKey,
-			AppID:            mainConfig.AppID,
-			TerminalSN:       mainConfig.TerminalSN,
-			TerminalKey:      mainConfig.TerminalKey,
-			DeviceID:         mainConfig.DeviceID,
-			MerchantID:       mainConfig.MerchantID,
-			StoreID:          mainConfig.StoreID,
-			StoreName:        mainConfig.StoreName,
-			APIURL:           mainConfig.APIURL,
-			GatewayURL:       mainConfig.GatewayURL,
-			WechatAppID:      mainConfig.WechatAppID,
-			WechatAppSecret:  mainConfig.WechatAppSecret,
-			AlipayAppID:      mainConfig.AlipayAppID,
-			AlipayPublicKey:  mainConfig.AlipayPublicKey,
-			AlipayPrivateKey: mainConfig.AlipayPrivateKey,
-		})
-
-		// 终端签到，更新terminal_key
-		if err := configService.SignIn(); err != nil {
-			log.Printf("Terminal sign-in failed: %v", err)
-		} else {
-			log.Printf("Terminal sign-in successful: %s", mainConfig.TerminalSN)
+		// 按payment.main_config_ids的顺序选择主配置，都不存在时使用第一个已激活的配置
+		mainConfig, err := services.LoadMainConfig()
+		if err != nil {
+			log.Printf("Warning: %v, using default config", err)
+			return defaultConfig, false
 		}
 
 		// 使用找到的配置
-		return services.ShouqianbaConfig{
-			VendorSN:         mainConfig.VendorSN,
-			VendorKey:        mainConfig.VendorKey,
-			AppID:            mainConfig.AppID,
-			TerminalSN:       mainConfig.TerminalSN,
-			TerminalKey:      mainConfig.TerminalKey,
-			DeviceID:         mainConfig.DeviceID,
-			MerchantID:       mainConfig.MerchantID,
-			StoreID:          mainConfig.StoreID,
-			StoreName:        mainConfig.StoreName,
-			APIURL:           mainConfig.APIURL,
-			GatewayURL:       mainConfig.GatewayURL,
-			WechatAppID:      mainConfig.WechatAppID,
-			WechatAppSecret:  mainConfig.WechatAppSecret,
-			AlipayAppID:      mainConfig.AlipayAppID,
-			AlipayPublicKey:  mainConfig.AlipayPublicKey,
-			AlipayPrivateKey: mainConfig.AlipayPrivateKey,
-		}
+		report.MainConfigID = mainConfig.ID
+		return services.NewShouqianbaConfig(mainConfig), true
 	}
 
 	// 加载配置并创建支付服务
-	paymentConfig := loadPaymentConfig()
+	paymentConfig, found := loadPaymentConfig()
 	paymentService = services.NewPaymentService(paymentConfig)
 
+	// 终端签到，更新terminal_key（网关暂时不可用时重试，仍失败则转入后台重试）
+	var signInErr error
+	if found {
+		signInErr = paymentService.StartupSignIn()
+	}
+	if dbConnected {
+		report.Configs = services.StartupConfigs(report.MainConfigID, signInErr)
+	}
+
+	// 支付结果轮询工作池和后台对账任务
+	if dbConnected {
+		paymentService.StartPolling()
+	}
+
+	// 每日汇总报告（reports.enabled，默认关闭）
+	if dbConnected && viper.GetBool("reports.enabled") {
+		paymentService.StartDailyReports()
+	}
+
 	// 初始化 API 路由
 	apiRoutes := routes.NewAPIRoutes(paymentService)
 
@@ -153,13 +140,17 @@ func main() {
 		method := string(ctx.Method())
 
 		// 添加安全头部
-		ctx.Response.Header.Set("X-Content-Type-Options", "nosniff")
-		ctx.Response.Header.Set("X-Frame-Options", "DENY")
-		ctx.Response.Header.Set("X-XSS-Protection", "1; mode=block")
+		setSecurityHeaders(ctx)
 
-		// CORS配置
-		ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
-		ctx.Response.Header.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		// CORS配置（config: cors.allowed_origins，未配置时保持允许所有域名）
+		allowedOrigins := viper.GetStringSlice("cors.allowed_origins")
+		if len(allowedOrigins) == 0 {
+			ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
+		} else if origin := string(ctx.Request.Header.Peek("Origin")); origin != "" && utils.IsOriginAllowed(origin, string(ctx.Host()), allowedOrigins) {
+			ctx.Response.Header.Set("Access-Control-Allow-Origin", origin)
+			ctx.Response.Header.Set("Vary", "Origin")
+		}
+		ctx.Response.Header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
 		ctx.Response.Header.Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		// 处理OPTIONS请求
@@ -177,48 +168,178 @@ func main() {
 	addr := fmt.Sprintf(":%d", port)
 
 	// 创建压缩处理器，启用GZIP压缩
-	compressedHandler := fasthttp.CompressHandler(handler)
+	// config: server.compression.level（默认6）、min_size（默认1024字节）、skip_types（默认image/）
+	compressLevel := fasthttp.CompressDefaultCompression
+	if viper.IsSet("server.compression.level") {
+		compressLevel = viper.GetInt("server.compression.level")
+	}
+	compressMinSize := viper.GetInt("server.compression.min_size")
+	if compressMinSize <= 0 {
+		compressMinSize = 1024
+	}
+	compressSkipTypes := viper.GetStringSlice("server.compression.skip_types")
+	if len(compressSkipTypes) == 0 {
+		compressSkipTypes = []string{"image/"}
+	}
+	compressedHandler := utils.CompressHandler(handler, compressLevel, compressMinSize, compressSkipTypes)
+
+	// 服务器超时（config: server.read_timeout、write_timeout、idle_timeout）
+	readTimeout := serverTimeout("server.read_timeout", 10*time.Second)
+	writeTimeout := serverTimeout("server.write_timeout", 10*time.Second)
+	idleTimeout := serverTimeout("server.idle_timeout", 120*time.Second)
 
 	// 创建fasthttp服务器
 	server := &fasthttp.Server{
 		Handler:            compressedHandler, // 使用压缩处理器
 		Name:               "zhifu-server",
-		ReadTimeout:        10 * time.Second,  // 减少读取超时，更快释放资源
-		WriteTimeout:       10 * time.Second,  // 减少写入超时，更快释放资源
-		IdleTimeout:        120 * time.Second, // 增加空闲连接超时，提高连接复用率
-		MaxRequestBodySize: 10 * 1024 * 1024,  // 10MB
-		MaxConnsPerIP:      200,               // 增加每个IP最大连接数
-		MaxRequestsPerConn: 2000,              // 增加每个连接最大请求数，提高连接复用率
-		Concurrency:        20000,             // 增加最大并发连接数
-		DisableKeepalive:   false,             // 启用长连接
-		ReduceMemoryUsage:  true,              // 启用内存使用优化
+		ReadTimeout:        readTimeout,      // 读取超时，较短时可更快释放资源
+		WriteTimeout:       writeTimeout,     // 写入超时，流式导出等长连接接口可能需要调大
+		IdleTimeout:        idleTimeout,      // 空闲连接超时，较长时可提高连接复用率
+		MaxRequestBodySize: 10 * 1024 * 1024, // 10MB
+		MaxConnsPerIP:      200,              // 增加每个IP最大连接数
+		MaxRequestsPerConn: 2000,             // 增加每个连接最大请求数，提高连接复用率
+		Concurrency:        20000,            // 增加最大并发连接数
+		DisableKeepalive:   false,            // 启用长连接
+		ReduceMemoryUsage:  true,             // 启用内存使用优化
 		// 启用HTTP/2支持
 		NoDefaultServerHeader: true,  // 禁用默认服务器头部，提高安全性
 		NoDefaultDate:         true,  // 禁用默认日期头部，减少响应大小
 		NoDefaultContentType:  false, // 保持默认内容类型
 	}
 
-	// 检查并清理端口占用
-	log.Printf("Checking port %d availability...", port)
-	if err := utils.KillProcessUsingPort(port); err != nil {
-		log.Printf("Warning: Failed to kill process using port %d: %v", port, err)
-	}
-	// 短暂延迟确保端口释放
-	time.Sleep(1 * time.Second)
-
-	// 创建TCP监听器，设置大的backlog值以匹配Linux内核的net.core.somaxconn=65535
+	// 开发环境可配置启动时杀死占用端口的进程（server.kill_port_process，默认关闭）
+	// 共享主机上可能误杀无关进程，生产环境请勿开启；关闭时端口被占用直接报错退出
 	listenConfig := &net.ListenConfig{}
-	// 在Go 1.21+中，ListenConfig支持Backlog字段
-	listener, err := listenConfig.Listen(context.Background(), "tcp", addr)
+	listener, err := listenServerPort(listenConfig, port, viper.GetBool("server.kill_port_process"))
 	if err != nil {
-		log.Fatalf("Failed to create listener: %v", err)
+		log.Fatalf("%v", err)
 	}
 	defer listener.Close()
 
 	log.Printf("Server running on http://localhost%s", addr)
 	log.Printf("Using fasthttp for improved performance")
 
+	// 配置了admin.port时管理接口和运行指标只在独立端口提供，便于通过防火墙与公网隔离
+	var adminServer *fasthttp.Server
+	if adminPort := routes.AdminPort(); adminPort > 0 {
+		adminAddr := fmt.Sprintf(":%d", adminPort)
+		adminListener, err := listenConfig.Listen(context.Background(), "tcp", adminAddr)
+		if err != nil {
+			if utils.IsAddrInUse(err) {
+				log.Fatalf("Admin port %d is already in use by another process; stop it or change admin.port", adminPort)
+			}
+			log.Fatalf("Failed to create admin listener: %v", err)
+		}
+		defer adminListener.Close()
+
+		adminHandler := func(ctx *fasthttp.RequestCtx) {
+			setSecurityHeaders(ctx)
+			apiRoutes.HandleAdminRequest(ctx)
+		}
+		adminServer = &fasthttp.Server{
+			Handler:               utils.CompressHandler(adminHandler, compressLevel, compressMinSize, compressSkipTypes),
+			Name:                  "zhifu-admin",
+			ReadTimeout:           readTimeout,
+			WriteTimeout:          writeTimeout,
+			IdleTimeout:           idleTimeout,
+			MaxRequestBodySize:    10 * 1024 * 1024, // 10MB，导入历史捐款
+			NoDefaultServerHeader: true,
+			NoDefaultDate:         true,
+		}
+		go func() {
+			if err := adminServer.Serve(adminListener); err != nil {
+				log.Fatalf("Failed to start admin server: %v", err)
+			}
+		}()
+		log.Printf("Admin server running on http://localhost%s", adminAddr)
+		report.AdminListenAddr = adminListener.Addr().String()
+	}
+
+	// 收到退出信号时同时关闭主端口和管理端口，等待进行中的请求完成
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		log.Printf("Shutting down server...")
+		if adminServer != nil {
+			if err := adminServer.Shutdown(); err != nil {
+				log.Printf("Warning: Failed to shut down admin server: %v", err)
+			}
+		}
+		if err := server.Shutdown(); err != nil {
+			log.Printf("Warning: Failed to shut down server: %v", err)
+		}
+	}()
+
+	report.StaticDir = services.StartupDir(filepath.Join(workDir, "static"))
+	report.TemplateDir = services.StartupDir(filepath.Join(workDir, "templates"))
+	report.PublicHost = services.StartupPublicHost()
+	report.ListenAddr = listener.Addr().String()
+	report.Log()
+
 	if err := server.Serve(listener); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// killProcessUsingPort 杀死占用端口的进程，测试中替换以确认未开启时不会调用
+var killProcessUsingPort = utils.KillProcessUsingPort
+
+// errPortInUse 端口已被其他进程占用
+var errPortInUse = errors.New("port in use")
+
+// listenServerPort 监听服务端口，killPortProcess为true时先杀死占用端口的进程
+// 未开启时端口被占用直接返回errPortInUse，不杀死任何进程
+func listenServerPort(listenConfig *net.ListenConfig, port int, killPortProcess bool) (net.Listener, error) {
+	addr := fmt.Sprintf(":%d", port)
+	listenAttempts := 1
+	if killPortProcess {
+		log.Printf("Checking port %d availability...", port)
+		if err := killProcessUsingPort(port); err != nil {
+			log.Printf("Warning: Failed to kill process using port %d: %v", port, err)
+		}
+		// 短暂延迟确保端口释放
+		time.Sleep(1 * time.Second)
+		listenAttempts = 5
+	}
+
+	// 创建TCP监听器，设置大的backlog值以匹配Linux内核的net.core.somaxconn=65535
+	// 在Go 1.21+中，ListenConfig支持Backlog字段
+	// 杀死占用进程后端口可能尚未释放，绑定失败时重试几次
+	var listener net.Listener
+	var err error
+	for attempt := 1; attempt <= listenAttempts; attempt++ {
+		listener, err = listenConfig.Listen(context.Background(), "tcp", addr)
+		if err == nil {
+			return listener, nil
+		}
+		log.Printf("Failed to listen on %s (attempt %d/%d): %v", addr, attempt, listenAttempts, err)
+		if attempt < listenAttempts {
+			time.Sleep(time.Second)
+		}
+	}
+	if utils.IsAddrInUse(err) {
+		return nil, fmt.Errorf("%w: port %d is already in use by another process; stop it or change server.port (server.kill_port_process: true kills it on startup, for development only)", errPortInUse, port)
+	}
+	return nil, fmt.Errorf("failed to create listener: %v", err)
+}
+
+// setSecurityHeaders 添加安全头部
+func setSecurityHeaders(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("X-Content-Type-Options", "nosniff")
+	ctx.Response.Header.Set("X-Frame-Options", "DENY")
+	ctx.Response.Header.Set("X-XSS-Protection", "1; mode=block")
+}
+
+// serverTimeout 读取服务器超时配置，未配置或不是正数时使用默认值
+func serverTimeout(key string, defaultValue time.Duration) time.Duration {
+	if !viper.IsSet(key) {
+		return defaultValue
+	}
+	timeout := viper.GetDuration(key)
+	if timeout <= 0 {
+		log.Printf("Warning: %s must be positive, got %q, using default %v", key, viper.GetString(key), defaultValue)
+		return defaultValue
+	}
+	return timeout
+}
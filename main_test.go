@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestListenServerPortInUseWithoutKill(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer busy.Close()
+
+	killed := 0
+	original := killProcessUsingPort
+	killProcessUsingPort = func(int) error { killed++; return nil }
+	t.Cleanup(func() { killProcessUsingPort = original })
+
+	// server.kill_port_process关闭时端口被占用直接报错，不杀死占用进程
+	listener, err := listenServerPort(&net.ListenConfig{}, busy.Addr().(*net.TCPAddr).Port, false)
+	if listener != nil {
+		listener.Close()
+	}
+	if !errors.Is(err, errPortInUse) {
+		t.Errorf("listenServerPort on busy port error = %v, want errPortInUse", err)
+	}
+	if killed != 0 {
+		t.Errorf("killProcessUsingPort called %d times, want 0", killed)
+	}
+}
+
+func TestListenServerPortFree(t *testing.T) {
+	free, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	listener, err := listenServerPort(&net.ListenConfig{}, port, false)
+	if err != nil {
+		t.Fatalf("listenServerPort on free port: %v", err)
+	}
+	listener.Close()
+}
@@ -10,6 +10,86 @@ ALTER TABLE wechat_users ADD COLUMN expires_at DATETIME NULL;
 ALTER TABLE alipay_users ADD COLUMN refresh_token VARCHAR(255) NULL;
 ALTER TABLE alipay_users ADD COLUMN expires_at DATETIME NULL;
 
+-- 更新donations表：祝福语审核状态（已有记录视为已审核通过）
+ALTER TABLE donations ADD COLUMN blessing_approved BOOLEAN DEFAULT TRUE;
+
+-- 更新payment_configs表：微信小程序配置
+ALTER TABLE payment_configs ADD COLUMN wechat_mini_app_id VARCHAR(50) NULL;
+ALTER TABLE payment_configs ADD COLUMN wechat_mini_app_secret VARCHAR(100) NULL;
+
+-- 更新donations表：平台手续费
+ALTER TABLE donations ADD COLUMN fee DECIMAL(10,2) DEFAULT 0;
+
+-- 更新payment_configs表：支付完成跳转地址
+ALTER TABLE payment_configs ADD COLUMN success_redirect_url VARCHAR(255) NULL;
+
+-- 更新payment_configs表：捐款档位阈值
+ALTER TABLE payment_configs ADD COLUMN tier_thresholds VARCHAR(255) NULL;
+
+-- 更新donations表：已退款金额
+ALTER TABLE donations ADD COLUMN refunded_amount DECIMAL(10,2) DEFAULT 0;
+
+-- 更新donations表：支付通道交易号
+ALTER TABLE donations ADD COLUMN transaction_id VARCHAR(64) NULL;
+ALTER TABLE donations ADD INDEX idx_transaction_id (transaction_id);
+
+-- 新增捐款修改日志表
+CREATE TABLE IF NOT EXISTS donation_audit_logs (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    order_id VARCHAR(50) COMMENT '订单ID',
+    action VARCHAR(20) COMMENT '操作: edit',
+    changes TEXT COMMENT '修改内容（JSON）',
+    operator VARCHAR(50) COMMENT '操作来源',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    INDEX idx_order_id (order_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 更新payment_configs表和categories表：交易概述前缀
+ALTER TABLE payment_configs ADD COLUMN subject_prefix VARCHAR(50) NULL;
+ALTER TABLE categories ADD COLUMN subject_prefix VARCHAR(50) NULL;
+
+-- 更新donations表：金额（分），统计合计使用，并回填历史数据
+ALTER TABLE donations ADD COLUMN amount_cents BIGINT DEFAULT 0;
+UPDATE donations SET amount_cents = ROUND(amount * 100) WHERE amount_cents = 0;
+
+-- 更新categories表：累计金额里程碑步长
+ALTER TABLE categories ADD COLUMN milestone_step DECIMAL(10,2) DEFAULT 0;
+
+-- 新增daily_reports表：每日汇总报告
+CREATE TABLE IF NOT EXISTS daily_reports (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    report_date VARCHAR(10) COMMENT '报告日期',
+    summary TEXT COMMENT '汇总内容（JSON）',
+    delivered TINYINT(1) DEFAULT 0 COMMENT '是否已发送',
+    delivery_error VARCHAR(500) COMMENT '最近一次发送失败原因',
+    attempts INT DEFAULT 0 COMMENT '发送尝试次数',
+    delivered_at DATETIME NULL COMMENT '发送时间',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    UNIQUE INDEX idx_report_date (report_date)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 更新payment_configs表：可用支付方式
+ALTER TABLE payment_configs ADD COLUMN enabled_payments VARCHAR(50) NULL;
+
+-- 新增campaign_archives表：活动周期归档（重置排行榜）
+CREATE TABLE IF NOT EXISTS campaign_archives (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    payment_config_id VARCHAR(50) COMMENT '支付配置ID（为空表示全部项目）',
+    category_id VARCHAR(50) COMMENT '分类ID（为空表示全部分类）',
+    period_start DATETIME NULL COMMENT '上一周期开始时间',
+    period_end DATETIME COMMENT '上一周期结束时间（新周期开始时间）',
+    donation_count BIGINT DEFAULT 0 COMMENT '捐款笔数',
+    donor_count BIGINT DEFAULT 0 COMMENT '捐款人数',
+    total_cents BIGINT DEFAULT 0 COMMENT '累计金额（分）',
+    note VARCHAR(255) COMMENT '备注',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    INDEX idx_campaign_scope (payment_config_id, category_id),
+    INDEX idx_period_end (period_end)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- 查看表结构确认更新
 DESCRIBE wechat_users;
 DESCRIBE alipay_users;
+DESCRIBE donations;
+DESCRIBE payment_configs;
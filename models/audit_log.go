@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// DonationAuditLog 捐款记录修改日志（管理员更正分类、祝福语、捐款人等）
+type DonationAuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrderID   string    `gorm:"size:50;index" json:"order_id"`
+	Action    string    `gorm:"size:20" json:"action"`    // edit
+	Changes   string    `gorm:"type:text" json:"changes"` // 修改内容，JSON格式：{"字段":{"from":旧值,"to":新值}}
+	Operator  string    `gorm:"size:50" json:"operator"`  // 操作来源（管理接口请求IP）
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// CampaignArchive 活动周期归档，重置排行榜时记录上一周期的合计
+// PeriodEnd即新周期的开始时间，排行榜只统计该时间之后的捐款；历史捐款仍保留在donations表中
+type CampaignArchive struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	PaymentConfigID string     `gorm:"size:50;index:idx_campaign_scope" json:"payment_config_id"` // 为空表示全部项目
+	CategoryID      string     `gorm:"size:50;index:idx_campaign_scope" json:"category_id"`       // 为空表示全部分类
+	PeriodStart     *time.Time `json:"period_start"`                                              // 上一周期开始时间，首个周期为空
+	PeriodEnd       time.Time  `gorm:"index" json:"period_end"`
+	DonationCount   int64      `json:"donation_count"`
+	DonorCount      int64      `json:"donor_count"`
+	TotalCents      int64      `json:"total_cents"` // 上一周期累计金额（分）
+	Note            string     `gorm:"size:255" json:"note"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
@@ -10,6 +10,8 @@ type Category struct {
 	Name            string    `gorm:"size:50" json:"name"`              // 类目名称，例如：菜蔬
 	PaymentConfigID string    `gorm:"size:20;index" json:"payment_config_id"` // 支付配置ID
 	Payment         string    `gorm:"size:20;index" json:"payment"`           // 支付参数，用于区分不同配置
+	SubjectPrefix   string    `gorm:"size:50" json:"subject_prefix"`          // 交易概述前缀（如活动编码），优先于支付配置的前缀
+	MilestoneStep   float64   `gorm:"type:decimal(10,2)" json:"milestone_step"` // 累计金额里程碑步长（元），0时使用全局配置
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// DailyReport 每日捐款汇总报告
+type DailyReport struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	ReportDate    string     `gorm:"size:10;uniqueIndex" json:"report_date"` // 报告日期，格式：2006-01-02
+	Summary       string     `gorm:"type:text" json:"summary"`               // 汇总内容，JSON格式
+	Delivered     bool       `json:"delivered"`                              // 是否已成功发送
+	DeliveryError string     `gorm:"size:500" json:"delivery_error"`         // 最近一次发送失败原因
+	Attempts      int        `json:"attempts"`                               // 发送尝试次数
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
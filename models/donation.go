@@ -5,16 +5,21 @@ import (
 )
 
 type Donation struct {
-	ID              uint      `gorm:"primaryKey" json:"id"`
-	OpenID          string    `gorm:"size:50" json:"openid"` // 微信openid或支付宝user_id
-	PayerUID        string    `gorm:"size:50" json:"payer_uid"` // 支付回调中的payer_uid
-	Amount          float64   `gorm:"type:decimal(10,2)" json:"amount"`
-	Payment         string    `gorm:"size:20;index" json:"payment"`           // wechat, alipay
-	PaymentConfigID string    `gorm:"size:20;index" json:"payment_config_id"` // 支付配置ID
-	Categories      string    `gorm:"size:20;index" json:"categories"`        // 捐款类目
-	Blessing        string    `gorm:"size:200" json:"blessing"`         // 祝福语
-	OrderID         string    `gorm:"size:50;index" json:"order_id"`
-	Status          string    `gorm:"size:20;index" json:"status"` // pending, completed
-	CreatedAt       time.Time `gorm:"index" json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	OpenID           string    `gorm:"column:openid;size:50" json:"openid"` // 微信openid或支付宝user_id
+	PayerUID         string    `gorm:"size:50" json:"payer_uid"`            // 支付回调中的payer_uid
+	TransactionID    string    `gorm:"size:64;index" json:"transaction_id"` // 支付通道交易号（商户后台可查）
+	Amount           float64   `gorm:"type:decimal(10,2)" json:"amount"`
+	AmountCents      int64     `gorm:"default:0" json:"amount_cents"`             // 金额（分），统计合计时使用，避免浮点误差
+	Fee              float64   `gorm:"type:decimal(10,2)" json:"fee"`             // 平台手续费（随捐款一并支付，不计入功德榜）
+	RefundedAmount   float64   `gorm:"type:decimal(10,2)" json:"refunded_amount"` // 已退款金额
+	Payment          string    `gorm:"size:20;index" json:"payment"`              // wechat, alipay
+	PaymentConfigID  string    `gorm:"size:20;index" json:"payment_config_id"`    // 支付配置ID
+	Categories       string    `gorm:"size:20;index" json:"categories"`           // 捐款类目ID（单个分类ID，历史原因字段名为categories）
+	Blessing         string    `gorm:"size:200" json:"blessing"`                  // 祝福语
+	BlessingApproved bool      `json:"blessing_approved"`                         // 祝福语是否审核通过（未开启审核时自动通过）
+	OrderID          string    `gorm:"size:50;index" json:"order_id"`
+	Status           string    `gorm:"size:20;index" json:"status"` // pending, completed, failed, refunded
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
@@ -34,6 +34,14 @@ type PaymentConfig struct {
 	LogoURL      string    `gorm:"size:255" json:"logo_url"`
 	Title2       string    `gorm:"size:255" json:"title2"`
 	Title3       string    `gorm:"size:255" json:"title3"`
+	// 支付完成后跳转的感谢页，为空时跳转回功德榜首页
+	SuccessRedirectURL string `gorm:"size:255" json:"success_redirect_url"`
+	// 捐款档位阈值（元，逗号分隔，如"10,100,1000"），用于广播消息中的tier字段
+	TierThresholds string `gorm:"size:255" json:"tier_thresholds"`
+	// 交易概述前缀（如活动编码"2024NY-"），分类设置了前缀时以分类为准
+	SubjectPrefix string `gorm:"size:50" json:"subject_prefix"`
+	// 可用支付方式（逗号分隔，如"wechat"、"wechat,alipay"），为空时按已配置的授权凭证推断
+	EnabledPayments string `gorm:"size:50" json:"enabled_payments"`
 	
 	// 微信公众号配置
 	WechatAppID     string    `gorm:"size:50" json:"wechat_app_id"`
@@ -41,6 +49,10 @@ type PaymentConfig struct {
 	WechatToken     string    `gorm:"size:100" json:"wechat_token"`
 	WechatAESKey    string    `gorm:"size:100" json:"wechat_aes_key"`
 	
+	// 微信小程序配置
+	WechatMiniAppID     string    `gorm:"size:50" json:"wechat_mini_app_id"`
+	WechatMiniAppSecret string    `gorm:"size:100" json:"wechat_mini_app_secret"`
+	
 	// 支付宝配置
 	AlipayAppID       string    `gorm:"size:50" json:"alipay_app_id"`
 	AlipayPublicKey   string    `gorm:"size:500" json:"alipay_public_key"`   // 支付宝公钥
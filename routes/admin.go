@@ -0,0 +1,736 @@
+package routes
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/services"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
+)
+
+// checkAdmin 校验管理接口令牌（config: admin.token，请求头 X-Admin-Token）
+// 未配置令牌时管理接口一律拒绝访问；校验失败时已写入响应，调用方直接返回即可
+func (ar *APIRoutes) checkAdmin(ctx *fasthttp.RequestCtx) bool {
+	adminToken := viper.GetString("admin.token")
+	if adminToken == "" {
+		ctx.SetStatusCode(fasthttp.StatusForbidden)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "admin api disabled"})
+		return false
+	}
+
+	token := string(ctx.Request.Header.Peek("X-Admin-Token"))
+	if !isAdminToken(token) {
+		log.Printf("Admin auth failed: path=%s, IP=%s", string(ctx.Path()), clientIP(ctx))
+		ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "unauthorized"})
+		return false
+	}
+
+	return true
+}
+
+// isAdminToken 校验管理令牌（config: admin.token），未配置令牌时一律返回false
+func isAdminToken(token string) bool {
+	adminToken := viper.GetString("admin.token")
+	return adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// HandleOrderAction 处理订单管理操作：POST /api/order/{order_id}/{action}
+func (ar *APIRoutes) HandleOrderAction(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	// 从路径中解析订单号和操作
+	rest := strings.TrimPrefix(string(ctx.Path()), "/api/order/")
+	idx := strings.LastIndex(rest, "/")
+	if idx <= 0 {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "unknown order action"})
+		return
+	}
+	orderID, action := rest[:idx], rest[idx+1:]
+
+	switch action {
+	case "approve", "reject":
+		ar.ModerateBlessing(ctx, orderID, action == "approve")
+	case "refund":
+		ar.RefundOrder(ctx, orderID)
+	case "rebroadcast":
+		ar.RebroadcastOrder(ctx, orderID)
+	default:
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "unknown order action"})
+	}
+}
+
+// GetPendingBlessings 获取待审核的祝福语列表
+func (ar *APIRoutes) GetPendingBlessings(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	limit := parseLimit(ctx, 50)
+
+	donations, err := ar.paymentService.GetPendingBlessings(limit)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"pending": donations,
+		"total":   len(donations),
+	})
+}
+
+// ModerateBlessing 审核通过或驳回订单祝福语
+func (ar *APIRoutes) ModerateBlessing(ctx *fasthttp.RequestCtx, orderID string, approve bool) {
+	if err := ar.paymentService.ModerateBlessing(orderID, approve); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Blessing moderated: orderNo=%s, approved=%t", orderID, approve)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"order_id": orderID,
+		"approved": approve,
+	})
+}
+
+// GetFeeStats 获取手续费统计，可通过payment参数按支付配置筛选
+func (ar *APIRoutes) GetFeeStats(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	payment := string(ctx.QueryArgs().Peek("payment"))
+	if payment == "" {
+		payment = string(ctx.QueryArgs().Peek("p"))
+	}
+
+	stats, err := ar.paymentService.GetFeeStats(payment)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// 以分累加，避免浮点误差
+	var feeCents int64
+	for _, s := range stats {
+		feeCents += s.FeeCents
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"stats":               stats,
+		"total_fee":           float64(feeCents) / 100,
+		"formatted_total_fee": services.FormatCents(feeCents),
+	})
+}
+
+// ImportDonations 批量导入历史捐款（JSON数组，单次最多1000条）
+func (ar *APIRoutes) ImportDonations(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	var records []services.ImportDonation
+	if err := json.Unmarshal(ctx.PostBody(), &records); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "invalid json: " + err.Error()})
+		return
+	}
+
+	if len(records) == 0 || len(records) > 1000 {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "records must contain 1 to 1000 items"})
+		return
+	}
+
+	result, err := ar.paymentService.ImportDonations(records)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Donations imported: inserted=%d, skipped=%d, errored=%d", result.Inserted, result.Skipped, result.Errored)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(result)
+}
+
+// RefundOrder 订单退款，请求体可选{"amount": 金额}（省略时全额退款）
+// 带?dry_run=true时只返回将要发送的退款参数和剩余可退金额，不调用网关
+func (ar *APIRoutes) RefundOrder(ctx *fasthttp.RequestCtx, orderID string) {
+	var req struct {
+		Amount float64 `json:"amount"`
+	}
+	if body := ctx.PostBody(); len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	dryRun := string(ctx.QueryArgs().Peek("dry_run")) == "true"
+
+	result, err := ar.paymentService.RefundOrder(orderID, req.Amount, dryRun)
+	if err != nil {
+		log.Printf("Refund failed: orderNo=%s, amount=%.2f, dryRun=%t, err=%v", orderID, req.Amount, dryRun, err)
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		if errors.Is(err, services.ErrGatewayBusinessFail) || errors.Is(err, services.ErrGatewayEndpointNotFound) || errors.Is(err, services.ErrGatewayNonJSON) || errors.Is(err, services.ErrSignInvalid) {
+			ctx.SetStatusCode(fasthttp.StatusBadGateway)
+		}
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Refund processed: orderNo=%s, amount=%.2f, dryRun=%t", orderID, result.RefundAmount, dryRun)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(result)
+}
+
+// GetMetrics 获取运行指标（轮询工作池队列深度、活跃数等）
+func (ar *APIRoutes) GetMetrics(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"polling":   ar.paymentService.PollingStats(),
+		"callbacks": ar.callbacks.Stats(),
+		"tokens":    ar.paymentService.TokenHealthStats(),
+		"websocket": ar.wsManager.Stats(),
+	})
+}
+
+// GetOrderByTransaction 根据支付通道交易号查询订单（用于与商户后台对账）
+// 路径：/api/order/by-transaction/{txn_id}，支持payment参数（wechat/alipay）区分不同通道的同号交易
+func (ar *APIRoutes) GetOrderByTransaction(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	transactionID := strings.TrimPrefix(string(ctx.Path()), "/api/order/by-transaction/")
+	if transactionID == "" || strings.Contains(transactionID, "/") {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "transaction id is required"})
+		return
+	}
+	payment := string(ctx.QueryArgs().Peek("payment"))
+
+	donation, err := ar.paymentService.GetDonationByTransactionID(transactionID, payment)
+	if err != nil {
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "donation not found"})
+		case errors.Is(err, services.ErrTransactionAmbiguous):
+			ctx.SetStatusCode(fasthttp.StatusConflict)
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "transaction id matches multiple donations, specify payment"})
+		default:
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(donation)
+}
+
+// CorrectOrder 更正捐款记录（分类、祝福语、捐款人），金额和状态不允许修改
+// 路径：PUT /api/order/{order_id}
+func (ar *APIRoutes) CorrectOrder(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	orderID := strings.TrimPrefix(string(ctx.Path()), "/api/order/")
+	if orderID == "" || strings.Contains(orderID, "/") {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "order not found"})
+		return
+	}
+
+	var req struct {
+		services.DonationCorrection
+		Categories *string      `json:"categories"` // category_id的旧字段名
+		Amount     *json.Number `json:"amount"`
+		Status     *string      `json:"status"`
+	}
+	if err := json.Unmarshal(ctx.Request.Body(), &req); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if req.Amount != nil || req.Status != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "amount and status cannot be edited, use refund or reconcile instead"})
+		return
+	}
+	if req.CategoryID == nil {
+		req.CategoryID = req.Categories
+	}
+
+	donation, err := ar.paymentService.CorrectDonation(orderID, req.DonationCorrection, clientIP(ctx))
+	if err != nil {
+		log.Printf("Correct order failed: orderNo=%s, err=%v", orderID, err)
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+		}
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Order corrected: orderNo=%s, IP=%s", orderID, clientIP(ctx))
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(donation)
+}
+
+// SignInPaymentConfig 对已激活的支付配置手动签到，更换终端密钥
+// 路径：POST /api/payment-config/{id}/signin
+func (ar *APIRoutes) SignInPaymentConfig(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(string(ctx.Path()), "/api/payment-config/"), "/signin")
+
+	result, err := ar.paymentService.SignInConfig(id)
+	if err != nil {
+		log.Printf("Manual sign-in failed: paymentConfigID=%s, err=%v", id, err)
+		ctx.SetStatusCode(fasthttp.StatusBadGateway)
+		if errors.Is(err, services.ErrInvalidPaymentConfigID) {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		} else if errors.Is(err, services.ErrPaymentConfigNotFound) {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+		}
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Manual sign-in succeeded: paymentConfigID=%s, terminal_sn=%s, rotated=%t", id, result.TerminalSN, result.Rotated)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(result)
+}
+
+// RebroadcastOrder 清除订单的已广播标记并重新推送到对应项目和分类的展示端
+func (ar *APIRoutes) RebroadcastOrder(ctx *fasthttp.RequestCtx, orderID string) {
+	donation, err := ar.paymentService.GetDonationByOrderID(orderID)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "order not found"})
+		return
+	}
+	if donation.Status != "completed" {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "order is not completed"})
+		return
+	}
+
+	ar.paymentService.ClearBroadcasted(orderID)
+
+	notification := &PayNotification{
+		Type:      "pay_success",
+		OrderNo:   donation.OrderID,
+		Amount:    strconv.FormatFloat(donation.Amount, 'f', 2, 64),
+		Time:      utils.Now(),
+		Payment:   donation.Payment,
+		Blessing:  donation.Blessing,
+		AvatarURL: services.ProxiedAvatarURL(donation.AvatarURL),
+		UserName:  donation.UserName,
+		CreatedAt: donation.CreatedAt.Format("2006-01-02 15:04:05"),
+		Tier:      ar.paymentService.DonationTier(donation.PaymentConfigID, donation.Amount),
+	}
+	ar.wsManager.BroadcastToSpecific(notification, donation.PaymentConfigID, donation.CategoryID)
+	ar.paymentService.MarkBroadcasted(orderID)
+
+	log.Printf("Order rebroadcast: orderNo=%s, payment=%s, categories=%s", orderID, donation.PaymentConfigID, donation.CategoryID)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{"success": true})
+}
+
+// GetAdminOverview 管理后台概览：今日统计、待支付和失败订单数、已激活配置数、WebSocket连接数及最近10笔捐款
+// 各项并行查询，单项超时（config: admin.overview_timeout，默认2s）或出错时返回其余数据并标记partial
+func (ar *APIRoutes) GetAdminOverview(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	timeout := viper.GetDuration("admin.overview_timeout")
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	queryCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	overview := map[string]interface{}{
+		"websocket_connections": ar.wsManager.GetConnectionCount(),
+	}
+	failures := map[string]string{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	// run 在独立协程中执行一项查询，超时后不再等待其结果
+	run := func(name string, query func() (interface{}, error)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			type result struct {
+				value interface{}
+				err   error
+			}
+			resultChan := make(chan result, 1)
+			go func() {
+				value, err := query()
+				resultChan <- result{value, err}
+			}()
+
+			var value interface{}
+			var err error
+			select {
+			case res := <-resultChan:
+				value, err = res.value, res.err
+			case <-queryCtx.Done():
+				err = queryCtx.Err()
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				log.Printf("Warning: Admin overview %s failed: %v", name, err)
+				failures[name] = err.Error()
+				return
+			}
+			overview[name] = value
+		}()
+	}
+
+	run("today", func() (interface{}, error) {
+		return ar.paymentService.GetTodayStats(queryCtx)
+	})
+	run("pending_orders", func() (interface{}, error) {
+		return ar.paymentService.CountDonationsByStatus(queryCtx, "pending")
+	})
+	run("failed_orders", func() (interface{}, error) {
+		return ar.paymentService.CountDonationsByStatus(queryCtx, "failed")
+	})
+	run("active_configs", func() (interface{}, error) {
+		return ar.paymentService.CountActivePaymentConfigs(queryCtx)
+	})
+	run("recent_donations", func() (interface{}, error) {
+		return ar.paymentService.GetRankings(10, 0, "", "", false)
+	})
+	wg.Wait()
+
+	overview["partial"] = len(failures) > 0
+	if len(failures) > 0 {
+		overview["errors"] = failures
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(overview)
+}
+
+// ListDonations 管理后台订单列表，包含所有状态的订单
+// 参数：status、payment/p（项目ID）、channel（wechat/alipay）、category_id/categories/c、openid、
+// from/to（日期，格式2006-01-02，含当天）、limit、page
+func (ar *APIRoutes) ListDonations(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	limit, page, offset, err := parsePagination(ctx, 20)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	args := ctx.QueryArgs()
+	filter := services.DonationFilter{
+		Status:          string(args.Peek("status")),
+		PaymentConfigID: string(args.Peek("payment")),
+		Payment:         string(args.Peek("channel")),
+		CategoryID:      queryCategoryID(ctx),
+		OpenID:          string(args.Peek("openid")),
+	}
+	if filter.PaymentConfigID == "" {
+		filter.PaymentConfigID = string(args.Peek("p"))
+	}
+
+	// 日期按服务器本地时间解析，to包含当天
+	for _, param := range []string{"from", "to"} {
+		value := string(args.Peek(param))
+		if value == "" {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "invalid " + param + " date, expected 2006-01-02"})
+			return
+		}
+		if param == "from" {
+			filter.From = date
+		} else {
+			filter.To = date.AddDate(0, 0, 1)
+		}
+	}
+
+	donations, total, err := ar.paymentService.ListDonations(filter, limit, offset)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"donations": donations,
+		"pagination": map[string]interface{}{
+			"limit":  limit,
+			"page":   page,
+			"offset": offset,
+			"total":  total,
+		},
+	})
+}
+
+// ListDonationsByOrderRange 按订单号区间查询订单，用于与网关结算批次对账
+// 路径：/api/admin/donations/range?from_order=...&to_order=...
+func (ar *APIRoutes) ListDonationsByOrderRange(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	fromOrder := strings.TrimSpace(string(ctx.QueryArgs().Peek("from_order")))
+	toOrder := strings.TrimSpace(string(ctx.QueryArgs().Peek("to_order")))
+	if fromOrder == "" || toOrder == "" {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "from_order and to_order are required"})
+		return
+	}
+
+	donations, truncated, err := ar.paymentService.ListDonationsByOrderRange(fromOrder, toOrder)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"donations": donations,
+		"total":     len(donations),
+		"truncated": truncated,
+	})
+}
+
+// StartReconcile 启动手动对账任务：POST /api/admin/reconcile?window=24h
+// 任务在后台运行，返回任务ID，通过GET /api/admin/reconcile/{job_id}查询进度和结果
+func (ar *APIRoutes) StartReconcile(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	var window time.Duration
+	if raw := string(ctx.QueryArgs().Peek("window")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "invalid window"})
+			return
+		}
+		window = d
+	}
+
+	job, err := ar.paymentService.StartReconcile(window)
+	if errors.Is(err, services.ErrReconcileRunning) {
+		ctx.SetStatusCode(fasthttp.StatusConflict)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]interface{}{"error": err.Error(), "job": job})
+		return
+	}
+
+	log.Printf("Reconcile job started: job_id=%s, window=%s, IP=%s", job.ID, job.Window, clientIP(ctx))
+	ctx.SetStatusCode(fasthttp.StatusAccepted)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(job)
+}
+
+// GetReconcileJob 查询手动对账任务：GET /api/admin/reconcile/{job_id}
+func (ar *APIRoutes) GetReconcileJob(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	id := strings.TrimPrefix(string(ctx.Path()), "/api/admin/reconcile/")
+	job, ok := ar.paymentService.GetReconcileJob(id)
+	if !ok {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "job not found"})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(job)
+}
+
+// ResetCampaign 开始新的活动周期（重置排行榜）：POST /api/campaign/reset?payment=6&category_id=3&note=...
+// payment、category_id都可省略，省略时作用于全部项目/分类；上一周期的合计归档到campaign_archives，捐款记录不删除
+func (ar *APIRoutes) ResetCampaign(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	paymentConfigID := string(ctx.QueryArgs().Peek("payment"))
+	if paymentConfigID == "" {
+		paymentConfigID = string(ctx.QueryArgs().Peek("p"))
+	}
+	categoryID := queryCategoryID(ctx)
+	note := strings.TrimSpace(string(ctx.QueryArgs().Peek("note")))
+
+	archive, err := ar.paymentService.ResetCampaign(paymentConfigID, categoryID, note)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		if errors.Is(err, services.ErrInvalidPaymentConfigID) {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		}
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Campaign reset: payment=%s, category=%s, archived_total_cents=%d, donations=%d, IP=%s", archive.PaymentConfigID, archive.CategoryID, archive.TotalCents, archive.DonationCount, clientIP(ctx))
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(archive)
+}
+
+// ReenrichDonations 补全历史捐款的捐款人（捐款时尚未关联用户、之后已授权的捐款）：POST /api/admin/reenrich
+func (ar *APIRoutes) ReenrichDonations(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	result, err := ar.paymentService.ReenrichDonations()
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Donations re-enriched: scanned=%d, updated=%d, skipped=%d, IP=%s", result.Scanned, result.Updated, result.Skipped, clientIP(ctx))
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(result)
+}
+
+// GetDailyReports 获取最近的每日汇总报告：GET /api/admin/reports?limit=30
+func (ar *APIRoutes) GetDailyReports(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	reports, err := ar.paymentService.GetDailyReports(parseLimit(ctx, 30))
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{"reports": reports})
+}
+
+// GetDailyReport 获取指定日期的汇总报告：GET /api/admin/reports/{2006-01-02}
+func (ar *APIRoutes) GetDailyReport(ctx *fasthttp.RequestCtx) {
+	if !ar.checkAdmin(ctx) {
+		return
+	}
+
+	date := strings.TrimPrefix(string(ctx.Path()), "/api/admin/reports/")
+	report, err := ar.paymentService.GetDailyReport(date)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "report not found"})
+		return
+	}
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(report)
+}
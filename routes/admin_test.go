@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestRebroadcastOrderAfterDedupMark(t *testing.T) {
+	ar := newTestRoutes(t)
+	ar.wsManager = NewWebSocketManager()
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, AmountCents: 1000, Payment: "wechat", OpenID: "anonymous", PaymentConfigID: "1", Status: "completed"})
+	connect := startWebSocketServer(t, ar.wsManager)
+	client := connect("p=1")
+
+	// 订单已广播过（去重标记存在），重新广播仍应发送
+	ar.paymentService.MarkBroadcasted("ORD1")
+	ctx := request(func(ctx *fasthttp.RequestCtx) { ar.RebroadcastOrder(ctx, "ORD1") }, "POST", "/api/order/ORD1/rebroadcast")
+	if ctx.Response.StatusCode() != fasthttp.StatusOK {
+		t.Fatalf("rebroadcast status = %d: %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	notification, ok := readNotification(t, client, 2*time.Second)
+	if !ok {
+		t.Fatal("no notification received after rebroadcast")
+	}
+	if notification.Type != "pay_success" || notification.OrderNo != "ORD1" || notification.Amount != "10.00" {
+		t.Errorf("notification = %+v, want pay_success for ORD1 amount 10.00", notification)
+	}
+}
+
+func TestRebroadcastOrderRejectsIncompleteOrder(t *testing.T) {
+	ar := newTestRoutes(t)
+	ar.wsManager = NewWebSocketManager()
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, Payment: "wechat", PaymentConfigID: "1", Status: "pending"})
+
+	ctx := request(func(ctx *fasthttp.RequestCtx) { ar.RebroadcastOrder(ctx, "ORD1") }, "POST", "/api/order/ORD1/rebroadcast")
+	if ctx.Response.StatusCode() != fasthttp.StatusBadRequest {
+		t.Errorf("rebroadcast pending order status = %d, want 400", ctx.Response.StatusCode())
+	}
+	ctx = request(func(ctx *fasthttp.RequestCtx) { ar.RebroadcastOrder(ctx, "MISSING") }, "POST", "/api/order/MISSING/rebroadcast")
+	if ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+		t.Errorf("rebroadcast missing order status = %d, want 404", ctx.Response.StatusCode())
+	}
+}
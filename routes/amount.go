@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// errInvalidAmount 金额不是数字或数字字符串
+var errInvalidAmount = errors.New("invalid amount")
+
+// jsonAmount JSON请求中的金额（元），同时接受数字（9.9）和数字字符串（"9.90"），解析后四舍五入到分
+// 前端各种类型的值（字符串、浮点误差如9.899999999）统一为精确到分的金额
+type jsonAmount float64
+
+// UnmarshalJSON 解析数字或数字字符串，null视为未填写（0）
+func (a *jsonAmount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+
+	raw := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return errInvalidAmount
+		}
+		raw = strings.TrimSpace(raw)
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return errInvalidAmount
+	}
+	*a = jsonAmount(math.Round(value*100) / 100)
+	return nil
+}
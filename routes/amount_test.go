@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestJSONAmountUnmarshal(t *testing.T) {
+	tests := []struct {
+		body string
+		want float64
+		err  error
+	}{
+		{`{"amount":9.9}`, 9.9, nil},
+		{`{"amount":10}`, 10, nil},
+		{`{"amount":9.899999999}`, 9.9, nil},
+		{`{"amount":"9.90"}`, 9.9, nil},
+		{`{"amount":" 100 "}`, 100, nil},
+		{`{"amount":"0.01"}`, 0.01, nil},
+		{`{"amount":null}`, 0, nil},
+		{`{}`, 0, nil},
+		{`{"amount":"abc"}`, 0, errInvalidAmount},
+		{`{"amount":""}`, 0, errInvalidAmount},
+		{`{"amount":"9.9元"}`, 0, errInvalidAmount},
+		{`{"amount":"NaN"}`, 0, errInvalidAmount},
+		{`{"amount":"Inf"}`, 0, errInvalidAmount},
+		{`{"amount":true}`, 0, errInvalidAmount},
+		{`{"amount":[9.9]}`, 0, errInvalidAmount},
+	}
+	for _, tt := range tests {
+		var req struct {
+			Amount jsonAmount `json:"amount"`
+		}
+		err := json.Unmarshal([]byte(tt.body), &req)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Unmarshal(%s) error = %v, want %v", tt.body, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unmarshal(%s) error = %v", tt.body, err)
+			continue
+		}
+		if float64(req.Amount) != tt.want {
+			t.Errorf("Unmarshal(%s) amount = %v, want %v", tt.body, req.Amount, tt.want)
+		}
+	}
+}
+
+func TestCreateDonationRejectsInvalidAmount(t *testing.T) {
+	ar := &APIRoutes{}
+	for _, body := range []string{`{"amount":"abc","payment":"wechat"}`, `{"amount":9.9,"fee":"x","payment":"wechat"}`} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod("POST")
+		ctx.Request.SetRequestURI("/api/donation")
+		ctx.Request.SetBodyString(body)
+		ar.CreateDonation(&ctx)
+
+		if ctx.Response.StatusCode() != fasthttp.StatusBadRequest || !strings.Contains(string(ctx.Response.Body()), `"INVALID_AMOUNT"`) {
+			t.Errorf("CreateDonation(%s) = %d %s, want 400 INVALID_AMOUNT", body, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+}
@@ -1,16 +1,22 @@
 package routes
 
 import (
+	"archive/zip"
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/spf13/viper"
 	"github.com/valyala/fasthttp"
 	"github.com/zhifu/donation-rank/models"
 	"github.com/zhifu/donation-rank/services"
@@ -20,15 +26,20 @@ import (
 type APIRoutes struct {
 	paymentService *services.PaymentService
 	wsManager      *WebSocketManager
+	callbacks      *callbackQueue // 回调后续处理队列
 	baseDir        string
 }
 
 func NewAPIRoutes(paymentService *services.PaymentService) *APIRoutes {
 	wsManager := NewWebSocketManager()
-	return &APIRoutes{
+	ar := &APIRoutes{
 		paymentService: paymentService,
 		wsManager:      wsManager,
+		callbacks:      newCallbackQueue(),
 	}
+	// 里程碑在捐款完成时检查（回调、轮询、对账），由服务层回调广播
+	paymentService.SetMilestoneHandler(ar.broadcastMilestone)
+	return ar
 }
 
 // HandleRequest 处理fasthttp请求
@@ -39,7 +50,7 @@ func (ar *APIRoutes) HandleRequest(ctx *fasthttp.RequestCtx, baseDir string) {
 	method := string(ctx.Method())
 
 	// 详细调试信息
-	log.Printf("[DEBUG] Full request: path='%s', method='%s', IP='%s'", path, method, string(ctx.RemoteIP().String()))
+	log.Printf("[DEBUG] Full request: path='%s', method='%s', IP='%s'", path, method, clientIP(ctx))
 
 	// 检查特定路径
 	if path == "/api/pay/callback" {
@@ -57,11 +68,8 @@ func (ar *APIRoutes) HandleRequest(ctx *fasthttp.RequestCtx, baseDir string) {
 		if payment == "" {
 			payment = string(ctx.QueryArgs().Peek("p"))
 		}
-		categories := string(ctx.QueryArgs().Peek("categories"))
-		if categories == "" {
-			categories = string(ctx.QueryArgs().Peek("c"))
-		}
-		fmt.Printf("[DEBUG] WebSocket connection attempt: path='%s', method='%s', IP='%s', payment='%s', categories='%s'\n", path, method, string(ctx.RemoteIP().String()), payment, categories)
+		categories := queryCategoryID(ctx)
+		fmt.Printf("[DEBUG] WebSocket connection attempt: path='%s', method='%s', IP='%s', payment='%s', categories='%s'\n", path, method, clientIP(ctx), payment, categories)
 		ar.wsManager.HandleWebSocket(ctx)
 		return
 	}
@@ -72,7 +80,55 @@ func (ar *APIRoutes) HandleRequest(ctx *fasthttp.RequestCtx, baseDir string) {
 		return
 	}
 
-	// 处理API路由
+	// 配置了独立管理端口时，公开端口不提供管理接口和运行指标
+	if AdminPort() > 0 && isAdminRoute(path, method) {
+		notFound(ctx, path, method)
+		return
+	}
+
+	ar.route(ctx, path, method)
+}
+
+// HandleAdminRequest 处理管理端口（config: admin.port）的请求，只提供管理接口和运行指标，仍需X-Admin-Token
+func (ar *APIRoutes) HandleAdminRequest(ctx *fasthttp.RequestCtx) {
+	path := string(ctx.Path())
+	method := string(ctx.Method())
+
+	if !isAdminRoute(path, method) {
+		notFound(ctx, path, method)
+		return
+	}
+	ar.route(ctx, path, method)
+}
+
+// AdminPort 独立的管理端口（config: admin.port），未配置或与server.port相同时返回0，管理接口仍在主端口提供
+func AdminPort() int {
+	port := viper.GetInt("admin.port")
+	if port <= 0 || port == viper.GetInt("server.port") {
+		return 0
+	}
+	return port
+}
+
+// isAdminRoute 管理接口和运行指标（需要X-Admin-Token），新增管理接口时需同步更新
+func isAdminRoute(path string, method string) bool {
+	switch {
+	case path == "/api/moderation/pending",
+		path == "/api/stats/fees",
+		path == "/api/import/donations",
+		path == "/api/campaign/reset",
+		path == "/metrics",
+		strings.HasPrefix(path, "/api/admin/"),
+		strings.HasPrefix(path, "/api/order/"):
+		return true
+	case strings.HasPrefix(path, "/api/payment-config/") && strings.HasSuffix(path, "/signin") && method == "POST":
+		return true
+	}
+	return false
+}
+
+// route 按路径和方法分发API路由
+func (ar *APIRoutes) route(ctx *fasthttp.RequestCtx, path string, method string) {
 	switch {
 	// API路由
 	case path == "/api/donate" && method == "POST":
@@ -81,22 +137,78 @@ func (ar *APIRoutes) HandleRequest(ctx *fasthttp.RequestCtx, baseDir string) {
 		ar.HandleCallback(ctx)
 	case path == "/api/rankings" && method == "GET":
 		ar.GetRankings(ctx)
+	case path == "/api/rankings/stream" && method == "GET":
+		ar.StreamRankings(ctx)
+	case path == "/api/latest" && method == "GET":
+		ar.GetLatestDonation(ctx)
+	case path == "/api/wall" && method == "GET":
+		ar.GetBlessingWall(ctx)
+	case path == "/api/avatar" && method == "GET":
+		ar.GetAvatar(ctx)
+	case path == "/api/my-rank" && method == "GET":
+		ar.GetMyRank(ctx)
+	case path == "/api/my-pending" && method == "GET":
+		ar.GetMyPendingOrders(ctx)
+	case strings.HasPrefix(path, "/api/donor/") && method == "GET":
+		ar.GetDonorProfile(ctx)
 	case path == "/api/activate" && method == "POST":
 		ar.ActivateTerminal(ctx)
 	case path == "/api/check-user" && method == "GET":
 		ar.CheckUserExists(ctx)
+	case path == "/api/user/forget" && method == "POST":
+		ar.ForgetUser(ctx)
 	case strings.HasPrefix(path, "/api/payment-config/") && method == "GET":
 		ar.GetPaymentConfig(ctx)
 	case strings.HasPrefix(path, "/api/category/") && method == "GET":
 		ar.GetCategory(ctx)
+	case path == "/api/categories/overview" && method == "GET":
+		ar.GetCategoryOverview(ctx)
 	case path == "/api/categories" && method == "GET":
 		ar.GetCategories(ctx)
 
+	// 管理接口（需要X-Admin-Token）
+	case path == "/api/moderation/pending" && method == "GET":
+		ar.GetPendingBlessings(ctx)
+	case strings.HasPrefix(path, "/api/payment-config/") && strings.HasSuffix(path, "/signin") && method == "POST":
+		ar.SignInPaymentConfig(ctx)
+	case strings.HasPrefix(path, "/api/order/by-transaction/") && method == "GET":
+		ar.GetOrderByTransaction(ctx)
+	case strings.HasPrefix(path, "/api/order/") && method == "POST":
+		ar.HandleOrderAction(ctx)
+	case strings.HasPrefix(path, "/api/order/") && method == "PUT":
+		ar.CorrectOrder(ctx)
+	case path == "/api/stats/fees" && method == "GET":
+		ar.GetFeeStats(ctx)
+	case path == "/api/import/donations" && method == "POST":
+		ar.ImportDonations(ctx)
+	case path == "/api/admin/overview" && method == "GET":
+		ar.GetAdminOverview(ctx)
+	case path == "/api/admin/donations" && method == "GET":
+		ar.ListDonations(ctx)
+	case path == "/api/admin/donations/range" && method == "GET":
+		ar.ListDonationsByOrderRange(ctx)
+	case path == "/api/admin/reconcile" && method == "POST":
+		ar.StartReconcile(ctx)
+	case path == "/api/admin/reenrich" && method == "POST":
+		ar.ReenrichDonations(ctx)
+	case strings.HasPrefix(path, "/api/admin/reconcile/") && method == "GET":
+		ar.GetReconcileJob(ctx)
+	case path == "/api/admin/reports" && method == "GET":
+		ar.GetDailyReports(ctx)
+	case strings.HasPrefix(path, "/api/admin/reports/") && method == "GET":
+		ar.GetDailyReport(ctx)
+	case path == "/api/campaign/reset" && method == "POST":
+		ar.ResetCampaign(ctx)
+	case path == "/metrics" && method == "GET":
+		ar.GetMetrics(ctx)
+
 	// 微信授权路由
 	case path == "/api/wechat/auth" && method == "GET":
 		ar.WechatAuth(ctx)
 	case path == "/api/wechat/callback" && method == "GET":
 		ar.WechatAuthCallback(ctx)
+	case path == "/api/wechat/mini-login" && method == "POST":
+		ar.WechatMiniLogin(ctx)
 
 	// 支付宝授权路由
 	case path == "/api/alipay/auth" && method == "GET":
@@ -109,6 +221,8 @@ func (ar *APIRoutes) HandleRequest(ctx *fasthttp.RequestCtx, baseDir string) {
 		ar.CreateDonationForm(ctx)
 
 	// 生成二维码
+	case path == "/api/qrcode/batch" && method == "GET":
+		ar.GenerateQRCodeBatch(ctx)
 	case path == "/qrcode" && method == "GET":
 		ar.GenerateQRCode(ctx)
 
@@ -119,10 +233,7 @@ func (ar *APIRoutes) HandleRequest(ctx *fasthttp.RequestCtx, baseDir string) {
 		if payment == "" {
 			payment = string(ctx.QueryArgs().Peek("p"))
 		}
-		categories := string(ctx.QueryArgs().Peek("categories"))
-		if categories == "" {
-			categories = string(ctx.QueryArgs().Peek("c"))
-		}
+		categories := queryCategoryID(ctx)
 		log.Printf("Home page accessed with payment=%s, categories=%s", payment, categories)
 		// 提供正式的业务逻辑页面
 		ar.serveTemplate(ctx, "templates/index.html")
@@ -131,10 +242,96 @@ func (ar *APIRoutes) HandleRequest(ctx *fasthttp.RequestCtx, baseDir string) {
 	case path == "/pay" && method == "GET":
 		ar.serveTemplate(ctx, "templates/pay.html")
 	default:
-		log.Printf("404 Not Found: path=%s, method=%s", path, method)
-		ctx.SetStatusCode(fasthttp.StatusNotFound)
-		ctx.WriteString("Not Found")
+		// 路径存在但方法不匹配时返回405，未知的API路径返回JSON格式的404
+		if methods := routeMethods(path); len(methods) > 0 {
+			log.Printf("405 Method Not Allowed: path=%s, method=%s", path, method)
+			ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			ctx.Response.Header.Set("Allow", strings.Join(methods, ", "))
+			ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(ctx).Encode(map[string]string{"code": "METHOD_NOT_ALLOWED", "error": "method not allowed"})
+			return
+		}
+
+		notFound(ctx, path, method)
+	}
+}
+
+// notFound 未知的API路径返回JSON格式的404，其他路径返回纯文本
+func notFound(ctx *fasthttp.RequestCtx, path string, method string) {
+	log.Printf("404 Not Found: path=%s, method=%s", path, method)
+	ctx.SetStatusCode(fasthttp.StatusNotFound)
+	if strings.HasPrefix(path, "/api/") {
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"code": "NOT_FOUND", "error": "not found"})
+		return
 	}
+	ctx.WriteString("Not Found")
+}
+
+// routeMethodsExact 已注册路由允许的请求方法，新增路由时需同步更新（用于返回405）
+var routeMethodsExact = map[string][]string{
+	"/api/donate":                {"POST"},
+	"/api/callback":              {"POST"},
+	"/api/pay/callback":          {"POST"},
+	"/api/rankings":              {"GET"},
+	"/api/rankings/stream":       {"GET"},
+	"/api/latest":                {"GET"},
+	"/api/wall":                  {"GET"},
+	"/api/avatar":                {"GET"},
+	"/api/my-rank":               {"GET"},
+	"/api/my-pending":            {"GET"},
+	"/api/activate":              {"POST"},
+	"/api/check-user":            {"GET"},
+	"/api/user/forget":           {"POST"},
+	"/api/categories":            {"GET"},
+	"/api/categories/overview":   {"GET"},
+	"/api/moderation/pending":    {"GET"},
+	"/api/stats/fees":            {"GET"},
+	"/api/import/donations":      {"POST"},
+	"/api/admin/overview":        {"GET"},
+	"/api/admin/donations":       {"GET"},
+	"/api/admin/donations/range": {"GET"},
+	"/api/admin/reconcile":       {"POST"},
+	"/api/admin/reenrich":        {"POST"},
+	"/api/admin/reports":         {"GET"},
+	"/api/campaign/reset":        {"POST"},
+	"/metrics":                   {"GET"},
+	"/api/wechat/auth":           {"GET"},
+	"/api/wechat/callback":       {"GET"},
+	"/api/wechat/mini-login":     {"POST"},
+	"/api/alipay/auth":           {"GET"},
+	"/api/alipay/callback":       {"GET"},
+	"/api/qrcode/batch":          {"GET"},
+	"/qrcode":                    {"GET"},
+	"/":                          {"GET"},
+	"/pay":                       {"GET"},
+}
+
+// routeMethodsPrefix 按前缀匹配的路由允许的请求方法
+var routeMethodsPrefix = []struct {
+	prefix  string
+	methods []string
+}{
+	{"/api/payment-config/", []string{"GET", "POST"}},
+	{"/api/category/", []string{"GET"}},
+	{"/api/donor/", []string{"GET"}},
+	{"/api/order/by-transaction/", []string{"GET", "POST", "PUT"}},
+	{"/api/order/", []string{"POST", "PUT"}},
+	{"/api/admin/reconcile/", []string{"GET"}},
+	{"/api/admin/reports/", []string{"GET"}},
+}
+
+// routeMethods 获取路径允许的请求方法，未注册的路径返回nil
+func routeMethods(path string) []string {
+	if methods, ok := routeMethodsExact[path]; ok {
+		return methods
+	}
+	for _, r := range routeMethodsPrefix {
+		if strings.HasPrefix(path, r.prefix) {
+			return r.methods
+		}
+	}
+	return nil
 }
 
 // serveStaticFile 提供静态文件服务
@@ -160,19 +357,27 @@ func (ar *APIRoutes) CreateDonation(ctx *fasthttp.RequestCtx) {
 	defer cancel()
 
 	var req struct {
-		Amount   float64 `json:"amount"`
-		Payment  string  `json:"payment"`
-		Category string  `json:"category"` // 捐款类目
-		Blessing string  `json:"blessing"` // 祝福语
+		Amount   jsonAmount `json:"amount"` // 数字或数字字符串，精确到分
+		Fee      jsonAmount `json:"fee"`    // 可选的平台手续费
+		Payment  string     `json:"payment"`
+		Category string     `json:"category"` // 捐款类目
+		Blessing string     `json:"blessing"` // 祝福语
+		// 匿名捐款：已授权用户也不关联个人资料，排行榜显示为匿名施主
+		Anonymous bool `json:"anonymous"`
 	}
 
 	// 解析请求体
 	if err := json.Unmarshal(ctx.Request.Body(), &req); err != nil {
 		ctx.SetStatusCode(fasthttp.StatusBadRequest)
 		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		if errors.Is(err, errInvalidAmount) {
+			json.NewEncoder(ctx).Encode(map[string]string{"code": "INVALID_AMOUNT", "error": "amount and fee must be numbers"})
+			return
+		}
 		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
 		return
 	}
+	amount, fee := float64(req.Amount), float64(req.Fee)
 
 	// 验证参数
 	if req.Payment == "" {
@@ -184,10 +389,16 @@ func (ar *APIRoutes) CreateDonation(ctx *fasthttp.RequestCtx) {
 
 	// 手动验证金额范围（使用浮点数比较，配合epsilon处理精度问题）
 	epsilon := 0.0001 // 0.01分的精度误差
-	if req.Amount < 0.01-epsilon || req.Amount > 10000+epsilon {
+	if amount < 0.01-epsilon || amount > 10000+epsilon {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"code": "INVALID_AMOUNT", "error": "amount must be between 0.01 and 10000"})
+		return
+	}
+	if fee < 0 || amount+fee > 10000+epsilon {
 		ctx.SetStatusCode(fasthttp.StatusBadRequest)
 		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
-		json.NewEncoder(ctx).Encode(map[string]string{"error": "amount must be between 0.01 and 10000"})
+		json.NewEncoder(ctx).Encode(map[string]string{"code": "INVALID_AMOUNT", "error": "fee must be non-negative and amount plus fee must not exceed 10000"})
 		return
 	}
 
@@ -204,12 +415,18 @@ func (ar *APIRoutes) CreateDonation(ctx *fasthttp.RequestCtx) {
 		openid = string(ctx.Request.Header.Cookie("alipay_user_id"))
 	}
 
-	// 确保未授权时openid为"anonymous"
-	if openid == "" {
+	// 确保未授权或选择匿名捐款时openid为"anonymous"
+	if openid == "" || req.Anonymous {
 		openid = "anonymous"
 	}
 	// 获取payment_configs的ID（从请求参数中获取）
-	paymentConfigID := string(ctx.QueryArgs().Peek("payment"))
+	paymentConfigID, err := services.NormalizePaymentConfigID(string(ctx.QueryArgs().Peek("payment")))
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "payment must be a positive integer config id"})
+		return
+	}
 
 	// 使用goroutine和channel处理超时
 	type result struct {
@@ -221,7 +438,7 @@ func (ar *APIRoutes) CreateDonation(ctx *fasthttp.RequestCtx) {
 	resultChan := make(chan result, 1)
 
 	go func() {
-		orderID, payURL, err := ar.paymentService.CreateOrder(req.Amount, req.Payment, host, openid, req.Category, paymentConfigID, req.Blessing)
+		orderID, payURL, err := ar.paymentService.CreateOrder(amount, fee, req.Payment, host, openid, req.Category, paymentConfigID, req.Blessing)
 		resultChan <- result{orderID, payURL, err}
 	}()
 
@@ -229,6 +446,9 @@ func (ar *APIRoutes) CreateDonation(ctx *fasthttp.RequestCtx) {
 	case res := <-resultChan:
 		if res.err != nil {
 			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			if errors.Is(res.err, services.ErrInvalidPaymentConfigID) || errors.Is(res.err, services.ErrPaymentConfigNotFound) || errors.Is(res.err, services.ErrUntrustedHost) || errors.Is(res.err, services.ErrCategoryRequired) || errors.Is(res.err, services.ErrPaymentMethodDisabled) {
+				ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			}
 			ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
 			json.NewEncoder(ctx).Encode(map[string]string{"error": res.err.Error()})
 			return
@@ -259,6 +479,10 @@ func (ar *APIRoutes) CreateDonationForm(ctx *fasthttp.RequestCtx) {
 	payment := string(ctx.FormValue("payment"))
 	category := string(ctx.FormValue("category")) // 捐款类目
 	blessing := string(ctx.FormValue("blessing")) // 祝福语
+	feeStr := string(ctx.FormValue("fee"))        // 可选的平台手续费
+	// 匿名捐款（1/true/on），已授权用户也不关联个人资料
+	anonymousStr := string(ctx.FormValue("anonymous"))
+	anonymous := anonymousStr == "1" || anonymousStr == "true" || anonymousStr == "on"
 
 	// 验证参数
 	if amountStr == "" || payment == "" {
@@ -277,6 +501,17 @@ func (ar *APIRoutes) CreateDonationForm(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	var fee float64
+	if feeStr != "" {
+		fee, err = strconv.ParseFloat(feeStr, 64)
+		if err != nil || fee < 0 {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.Response.Header.Set("Content-Type", "application/json")
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "invalid fee"})
+			return
+		}
+	}
+
 	// 验证支付方式
 	if payment != "wechat" && payment != "alipay" {
 		ctx.SetStatusCode(fasthttp.StatusBadRequest)
@@ -298,8 +533,8 @@ func (ar *APIRoutes) CreateDonationForm(ctx *fasthttp.RequestCtx) {
 		openid = string(ctx.Request.Header.Cookie("alipay_user_id"))
 	}
 
-	// 确保未授权时openid为"anonymous"
-	if openid == "" {
+	// 确保未授权或选择匿名捐款时openid为"anonymous"
+	if openid == "" || anonymous {
 		openid = "anonymous"
 	}
 	// 获取payment_configs的ID（从表单或URL参数中获取，支持别名）
@@ -310,6 +545,13 @@ func (ar *APIRoutes) CreateDonationForm(ctx *fasthttp.RequestCtx) {
 			paymentConfigID = string(ctx.QueryArgs().Peek("p"))
 		}
 	}
+	paymentConfigID, err = services.NormalizePaymentConfigID(paymentConfigID)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "payment must be a positive integer config id"})
+		return
+	}
 
 	// 使用goroutine和channel处理超时
 	type result struct {
@@ -320,7 +562,7 @@ func (ar *APIRoutes) CreateDonationForm(ctx *fasthttp.RequestCtx) {
 	resultChan := make(chan result, 1)
 
 	go func() {
-		_, payURL, err := ar.paymentService.CreateOrder(amount, payment, host, openid, category, paymentConfigID, blessing)
+		_, payURL, err := ar.paymentService.CreateOrder(amount, fee, payment, host, openid, category, paymentConfigID, blessing)
 		resultChan <- result{payURL, err}
 	}()
 
@@ -328,6 +570,9 @@ func (ar *APIRoutes) CreateDonationForm(ctx *fasthttp.RequestCtx) {
 	case res := <-resultChan:
 		if res.err != nil {
 			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			if errors.Is(res.err, services.ErrInvalidPaymentConfigID) || errors.Is(res.err, services.ErrPaymentConfigNotFound) || errors.Is(res.err, services.ErrUntrustedHost) || errors.Is(res.err, services.ErrCategoryRequired) || errors.Is(res.err, services.ErrPaymentMethodDisabled) {
+				ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			}
 			ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
 			json.NewEncoder(ctx).Encode(map[string]string{"error": res.err.Error()})
 			return
@@ -360,24 +605,83 @@ func (ar *APIRoutes) CheckUserExists(ctx *fasthttp.RequestCtx) {
 	}
 
 	exists := false
+	// 已保存的授权令牌是否存在且未过期，过期时前端应提示重新授权
+	authorized := false
+	var expiresAt *time.Time
 
 	if payment == "wechat" {
-		// 检查微信用户是否存在
+		// 检查微信用户是否存在（微信用户表的openid列为open_id）
 		var wechatUser models.WechatUser
 		if err := utils.DB.Where("open_id = ?", openid).First(&wechatUser).Error; err == nil {
 			exists = true
+			authorized = wechatUser.AccessToken != "" && wechatUser.ExpiresAt.After(time.Now())
+			if wechatUser.AccessToken != "" && !wechatUser.ExpiresAt.IsZero() {
+				expiresAt = &wechatUser.ExpiresAt
+			}
 		}
 	} else if payment == "alipay" {
 		// 检查支付宝用户是否存在
 		var alipayUser models.AlipayUser
 		if err := utils.DB.Where("user_id = ?", openid).First(&alipayUser).Error; err == nil {
 			exists = true
+			authorized = alipayUser.AccessToken != "" && alipayUser.ExpiresAt.After(time.Now())
+			if alipayUser.AccessToken != "" && !alipayUser.ExpiresAt.IsZero() {
+				expiresAt = &alipayUser.ExpiresAt
+			}
 		}
 	}
 
 	ctx.SetStatusCode(fasthttp.StatusOK)
 	ctx.Response.Header.Set("Content-Type", "application/json")
-	json.NewEncoder(ctx).Encode(map[string]bool{"exists": exists})
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"exists":     exists,
+		"authorized": authorized,
+		"expires_at": expiresAt,
+	})
+}
+
+// ForgetUser 清除当前授权用户的个人资料（昵称、头像、令牌），捐款记录保留
+func (ar *APIRoutes) ForgetUser(ctx *fasthttp.RequestCtx) {
+	users := map[string]string{
+		"wechat": string(ctx.Request.Header.Cookie("wechat_openid")),
+		"alipay": string(ctx.Request.Header.Cookie("alipay_user_id")),
+	}
+
+	cleared := 0
+	for payment, userID := range users {
+		if userID == "" || userID == "anonymous" {
+			continue
+		}
+		if err := ar.paymentService.ForgetUser(payment, userID); err != nil {
+			log.Printf("Failed to forget %s user %s: %v", payment, userID, err)
+			continue
+		}
+		log.Printf("User profile cleared: payment=%s, user_id=%s", payment, userID)
+		cleared++
+	}
+
+	// 无论是否找到用户，都清除本地的用户cookie（路径与设置时一致，否则浏览器不会删除）
+	for _, key := range []string{
+		"wechat_openid", "wechat_user_id", "wechat_user_name", "wechat_avatar_url",
+		"alipay_user_id", "alipay_user_name", "alipay_avatar_url", "alipay_access_token",
+	} {
+		cookie := &fasthttp.Cookie{}
+		cookie.SetKey(key)
+		cookie.SetPath("/")
+		cookie.SetExpire(fasthttp.CookieExpireDelete)
+		ctx.Response.Header.SetCookie(cookie)
+	}
+
+	if cleared == 0 {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "no authorized user found"})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]bool{"success": true})
 }
 
 // WechatAuth 微信公众号授权入口
@@ -385,18 +689,15 @@ func (ar *APIRoutes) WechatAuth(ctx *fasthttp.RequestCtx) {
 	// 获取当前主机名
 	host := string(ctx.Host())
 
-	// 获取重定向URL参数
-	redirectURL := string(ctx.QueryArgs().Peek("redirect_url"))
+	// 获取重定向URL参数（不在跳转白名单中的地址将被忽略）
+	redirectURL := ar.allowedRedirectURL(ctx, string(ctx.QueryArgs().Peek("redirect_url")))
 
 	// 获取payment和categories参数（支持别名）
 	payment := string(ctx.QueryArgs().Peek("payment"))
 	if payment == "" {
 		payment = string(ctx.QueryArgs().Peek("p"))
 	}
-	categories := string(ctx.QueryArgs().Peek("categories"))
-	if categories == "" {
-		categories = string(ctx.QueryArgs().Peek("c"))
-	}
+	categories := queryCategoryID(ctx)
 
 	if redirectURL == "" {
 		// 默认重定向到支付页面
@@ -448,7 +749,7 @@ func (ar *APIRoutes) WechatAuth(ctx *fasthttp.RequestCtx) {
 	}
 
 	// 生成授权URL并跳转
-	authURL, err := ar.paymentService.GetWechatAuthURLWithRedirect(host, redirectURL)
+	authURL, err := ar.paymentService.GetWechatAuthURLWithRedirect(host, redirectURL, payment)
 	if err != nil {
 		log.Printf("Failed to generate wechat auth URL: %v", err)
 		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
@@ -466,18 +767,15 @@ func (ar *APIRoutes) WechatAuthCallback(ctx *fasthttp.RequestCtx) {
 	// 获取授权码
 	code := string(ctx.QueryArgs().Peek("code"))
 
-	// 获取重定向URL参数
-	redirectURL := string(ctx.QueryArgs().Peek("redirect_url"))
+	// 获取重定向URL参数（不在跳转白名单中的地址将被忽略）
+	redirectURL := ar.allowedRedirectURL(ctx, string(ctx.QueryArgs().Peek("redirect_url")))
 
 	// 获取payment和categories参数（支持别名）
 	payment := string(ctx.QueryArgs().Peek("payment"))
 	if payment == "" {
 		payment = string(ctx.QueryArgs().Peek("p"))
 	}
-	categories := string(ctx.QueryArgs().Peek("categories"))
-	if categories == "" {
-		categories = string(ctx.QueryArgs().Peek("c"))
-	}
+	categories := queryCategoryID(ctx)
 
 	// 构建重定向URL
 	redirectURL = ar.buildRedirectURL(redirectURL, payment, categories)
@@ -490,7 +788,7 @@ func (ar *APIRoutes) WechatAuthCallback(ctx *fasthttp.RequestCtx) {
 	}
 
 	// 使用授权码获取用户信息
-	userInfo, err := ar.paymentService.GetWechatUserInfoByCode(code)
+	userInfo, err := ar.paymentService.GetWechatUserInfoByCode(code, payment)
 	if err != nil {
 		// 授权失败，设置为匿名施主
 		ar.setAnonymousWechatCookie(ctx)
@@ -535,23 +833,63 @@ func (ar *APIRoutes) WechatAuthCallback(ctx *fasthttp.RequestCtx) {
 	ctx.Redirect(redirectURL, fasthttp.StatusFound)
 }
 
+// WechatMiniLogin 微信小程序登录（code换取openid）
+func (ar *APIRoutes) WechatMiniLogin(ctx *fasthttp.RequestCtx) {
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil || req.Code == "" {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "code is required"})
+		return
+	}
+
+	// session_key仅用于服务端解密，不返回给前端
+	openid, _, err := ar.paymentService.GetWechatMiniUserByCode(req.Code)
+	if err != nil {
+		log.Printf("Wechat mini program login failed: %v", err)
+		ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+		ctx.Response.Header.Set("Content-Type", "application/json")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "wechat mini program login failed"})
+		return
+	}
+
+	// 与公众号授权保持一致，将openid写入cookie
+	cookie := &fasthttp.Cookie{}
+	cookie.SetKey("wechat_openid")
+	cookie.SetValue(openid)
+	cookie.SetMaxAge(86400)
+	cookie.SetPath("/")
+	ctx.Response.Header.SetCookie(cookie)
+
+	cookie = &fasthttp.Cookie{}
+	cookie.SetKey("wechat_user_id")
+	cookie.SetValue(openid)
+	cookie.SetMaxAge(86400)
+	cookie.SetPath("/")
+	ctx.Response.Header.SetCookie(cookie)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json")
+	json.NewEncoder(ctx).Encode(map[string]string{"openid": openid})
+}
+
 // AlipayAuth 支付宝授权入口
 func (ar *APIRoutes) AlipayAuth(ctx *fasthttp.RequestCtx) {
 	// 获取当前主机名
 	host := string(ctx.Host())
 
-	// 获取重定向URL参数
-	redirectURL := string(ctx.QueryArgs().Peek("redirect_url"))
+	// 获取重定向URL参数（不在跳转白名单中的地址将被忽略）
+	redirectURL := ar.allowedRedirectURL(ctx, string(ctx.QueryArgs().Peek("redirect_url")))
 
 	// 获取payment和categories参数（支持别名）
 	payment := string(ctx.QueryArgs().Peek("payment"))
 	if payment == "" {
 		payment = string(ctx.QueryArgs().Peek("p"))
 	}
-	categories := string(ctx.QueryArgs().Peek("categories"))
-	if categories == "" {
-		categories = string(ctx.QueryArgs().Peek("c"))
-	}
+	categories := queryCategoryID(ctx)
 
 	if redirectURL == "" {
 		// 默认重定向到支付页面
@@ -603,7 +941,7 @@ func (ar *APIRoutes) AlipayAuth(ctx *fasthttp.RequestCtx) {
 	}
 
 	// 生成授权URL并跳转
-	authURL, err := ar.paymentService.GetAlipayAuthURLWithRedirect(host, redirectURL)
+	authURL, err := ar.paymentService.GetAlipayAuthURLWithRedirect(host, redirectURL, payment)
 	if err != nil {
 		log.Printf("Failed to generate alipay auth URL: %v", err)
 		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
@@ -630,6 +968,7 @@ func (ar *APIRoutes) AlipayAuthCallback(ctx *fasthttp.RequestCtx) {
 		if err != nil {
 			redirectURL = ""
 		}
+		redirectURL = ar.allowedRedirectURL(ctx, redirectURL)
 	}
 
 	// 获取payment和categories参数（支持别名）
@@ -637,10 +976,7 @@ func (ar *APIRoutes) AlipayAuthCallback(ctx *fasthttp.RequestCtx) {
 	if payment == "" {
 		payment = string(ctx.QueryArgs().Peek("p"))
 	}
-	categories := string(ctx.QueryArgs().Peek("categories"))
-	if categories == "" {
-		categories = string(ctx.QueryArgs().Peek("c"))
-	}
+	categories := queryCategoryID(ctx)
 
 	// 尝试从redirect_url中解析payment和categories参数（支持别名）
 	if payment == "" || categories == "" {
@@ -675,7 +1011,7 @@ func (ar *APIRoutes) AlipayAuthCallback(ctx *fasthttp.RequestCtx) {
 	}
 
 	// 使用授权码获取用户信息
-	userInfo, err := ar.paymentService.GetAlipayUserInfoByCode(code)
+	userInfo, err := ar.paymentService.GetAlipayUserInfoByCode(code, payment)
 	if err != nil {
 		// 授权失败，设置为匿名施主
 		ar.setAnonymousAlipayCookie(ctx)
@@ -753,52 +1089,20 @@ func (ar *APIRoutes) HandleCallback(ctx *fasthttp.RequestCtx) {
 	// 解析JSON数据，使用map[string]interface{}处理数组字段
 	var data map[string]interface{}
 	if err := json.Unmarshal(body, &data); err != nil {
-		log.Printf("WebHook request unmarshal error: %v, IP=%s", err, string(ctx.RemoteIP().String()))
-		ctx.SetStatusCode(fasthttp.StatusOK)
-		ctx.WriteString("success")
+		log.Printf("WebHook request unmarshal error: %v, IP=%s", err, clientIP(ctx))
+		writeCallbackAck(ctx, callbackChannel(nil))
 		return
 	}
 
+	// 根据回调格式判断支付通道，用于返回对应的应答
+	channel := callbackChannel(data)
+
 	// 记录解析后的数据结构（用于调试）
 	log.Printf("WebHook parsed data: %v", data)
 
-	// 解析订单号、金额、状态
-	orderID, _ := data["client_sn"].(string)
-	// 尝试从其他字段获取订单号（支持微信支付）
-	if orderID == "" {
-		if id, ok := data["order_id"].(string); ok {
-			orderID = id
-			log.Printf("Got order ID from order_id: %s", orderID)
-		} else if id, ok := data["out_trade_no"].(string); ok {
-			orderID = id
-			log.Printf("Got order ID from out_trade_no: %s", orderID)
-		} else if id, ok := data["transaction_id"].(string); ok {
-			orderID = id
-			log.Printf("Got order ID from transaction_id: %s", orderID)
-		}
-	}
-	amount, _ := data["amount"].(string)
-	// 尝试从其他字段获取金额
-	if amount == "" {
-		if amt, ok := data["total_amount"].(string); ok {
-			amount = amt
-			log.Printf("Got amount from total_amount: %s", amount)
-		} else if amt, ok := data["pay_amount"].(string); ok {
-			amount = amt
-			log.Printf("Got amount from pay_amount: %s", amount)
-		}
-	}
-	status, _ := data["status"].(string)
-	// 尝试从其他字段获取状态
-	if status == "" {
-		if stat, ok := data["trade_status"].(string); ok {
-			status = stat
-			log.Printf("Got status from trade_status: %s", status)
-		} else if stat, ok := data["result_code"].(string); ok {
-			status = stat
-			log.Printf("Got status from result_code: %s", status)
-		}
-	}
+	// 解析订单号、金额、状态（兼容收钱吧、微信、支付宝的字段名和嵌套格式）
+	orderID, amount, status := services.CallbackOrderFields(data)
+	log.Printf("WebHook fields: orderNo=%s, amount=%s, status=%s", orderID, amount, status)
 
 	// 检查支付状态（支持多种状态格式）
 	successStatuses := []string{"success", "SUCCESS", "TRADE_SUCCESS", "PAY_SUCCESS"}
@@ -810,11 +1114,10 @@ func (ar *APIRoutes) HandleCallback(ctx *fasthttp.RequestCtx) {
 		}
 	}
 
-	// 非成功状态直接返回success
+	// 非成功状态直接返回应答
 	if !isSuccess {
-		log.Printf("WebHook status not success: orderNo=%s, status=%s, IP=%s", orderID, status, string(ctx.RemoteIP().String()))
-		ctx.SetStatusCode(fasthttp.StatusOK)
-		ctx.WriteString("success")
+		log.Printf("WebHook status not success: orderNo=%s, status=%s, IP=%s", orderID, status, clientIP(ctx))
+		writeCallbackAck(ctx, channel)
 		return
 	}
 
@@ -833,7 +1136,7 @@ func (ar *APIRoutes) HandleCallback(ctx *fasthttp.RequestCtx) {
 		// 方式2：使用终端密钥验证（兼容旧版）
 		verifyErr = ar.paymentService.HandleCallback(data)
 	} else {
-		log.Printf("WebHook missing sign: IP=%s", string(ctx.RemoteIP().String()))
+		log.Printf("WebHook missing sign: IP=%s", clientIP(ctx))
 		ctx.SetStatusCode(fasthttp.StatusForbidden)
 		ctx.WriteString("missing sign")
 		return
@@ -841,24 +1144,18 @@ func (ar *APIRoutes) HandleCallback(ctx *fasthttp.RequestCtx) {
 
 	// 验签失败返403
 	if verifyErr != nil {
-		log.Printf("WebHook signature verify failed: orderNo=%s, IP=%s, err=%v", orderID, string(ctx.RemoteIP().String()), verifyErr)
+		log.Printf("WebHook signature verify failed: orderNo=%s, IP=%s, err=%v", orderID, clientIP(ctx), verifyErr)
 		ctx.SetStatusCode(fasthttp.StatusForbidden)
 		ctx.WriteString("signature verify failed")
 		return
 	}
 
-	// 立即返回success（100ms内）
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	ctx.WriteString("success")
-
-	// 异步处理DB更新和广播
-	go func() {
-		// 更新DB
-		if err := ar.updateOrderStatusToPaid(orderID, amount); err != nil {
-			log.Printf("Update order status failed: %v, orderNo=%s", err, orderID)
-			return
-		}
+	// 立即返回应答（100ms内）
+	writeCallbackAck(ctx, channel)
 
+	// 加入回调队列异步处理DB更新和广播
+	// 订单状态已在验签时同步写入数据库，此处只读取订单用于广播
+	ar.callbacks.Enqueue(orderID, func() {
 		// 广播支付成功消息
 		notification := &PayNotification{
 			Type:    "pay_success",
@@ -876,6 +1173,11 @@ func (ar *APIRoutes) HandleCallback(ctx *fasthttp.RequestCtx) {
 		// categories是分类ID，不是支付方式
 		var donation models.Donation
 		if err := utils.DB.Where("order_id = ?", orderID).First(&donation).Error; err == nil {
+			// 网关回调的状态未写为已完成（如交易失败）时不广播支付成功
+			if donation.Status != "completed" {
+				log.Printf("Skip pay_success broadcast: orderNo=%s, status=%s", orderID, donation.Status)
+				return
+			}
 			if donation.PaymentConfigID != "" {
 				payment = donation.PaymentConfigID // 使用订单的项目ID
 				log.Printf("Got project ID from database: %s", payment)
@@ -884,6 +1186,8 @@ func (ar *APIRoutes) HandleCallback(ctx *fasthttp.RequestCtx) {
 				categories = donation.Categories // 使用订单的分类ID
 				log.Printf("Got category ID from database: %s", categories)
 			}
+			notification.Tier = ar.paymentService.DonationTier(donation.PaymentConfigID, donation.Amount)
+			notification.IsFirstDonation = ar.paymentService.IsFirstDonation(donation.OpenID, donation.OrderID, donation.Amount)
 			// 同时获取支付类型（用于日志记录）
 			if donation.Payment != "" {
 				log.Printf("Got payment method from database: %s", donation.Payment)
@@ -936,36 +1240,10 @@ func (ar *APIRoutes) HandleCallback(ctx *fasthttp.RequestCtx) {
 			isWeChatPay = true
 			log.Printf("Detected WeChat Pay callback: orderNo=%s", orderID)
 			log.Printf("WeChat Pay data: %v", wechatData)
-			// 尝试从微信支付嵌套数据中获取信息
-			if wxOrderID, ok := wechatData["order_id"].(string); ok && orderID == "" {
-				orderID = wxOrderID
-				log.Printf("Got order ID from wechat.order_id: %s", orderID)
-			}
-			if wxAmount, ok := wechatData["amount"].(string); ok && amount == "" {
-				amount = wxAmount
-				log.Printf("Got amount from wechat.amount: %s", amount)
-			}
-			if wxStatus, ok := wechatData["status"].(string); ok && status == "" {
-				status = wxStatus
-				log.Printf("Got status from wechat.status: %s", status)
-			}
 		} else if alipayData, hasAlipay := data["alipay"].(map[string]interface{}); hasAlipay {
 			isAlipay = true
 			log.Printf("Detected Alipay callback: orderNo=%s", orderID)
 			log.Printf("Alipay data: %v", alipayData)
-			// 尝试从支付宝嵌套数据中获取信息
-			if aliOrderID, ok := alipayData["order_id"].(string); ok && orderID == "" {
-				orderID = aliOrderID
-				log.Printf("Got order ID from alipay.order_id: %s", orderID)
-			}
-			if aliAmount, ok := alipayData["amount"].(string); ok && amount == "" {
-				amount = aliAmount
-				log.Printf("Got amount from alipay.amount: %s", amount)
-			}
-			if aliStatus, ok := alipayData["status"].(string); ok && status == "" {
-				status = aliStatus
-				log.Printf("Got status from alipay.status: %s", status)
-			}
 		}
 
 		// 6. 重要：直接使用订单的实际项目和分类参数
@@ -995,7 +1273,7 @@ func (ar *APIRoutes) HandleCallback(ctx *fasthttp.RequestCtx) {
 			}
 		} else if isWeChatPay {
 			// 微信支付不在这里广播，由状态轮询处理
-			log.Printf("Skipping broadcast for WeChat Pay, will be handled by status polling", orderID)
+			log.Printf("Skipping broadcast for WeChat Pay, will be handled by status polling: orderNo=%s", orderID)
 		} else {
 			// 其他支付方式，使用默认广播
 			if payment != "" || categories != "" {
@@ -1006,23 +1284,56 @@ func (ar *APIRoutes) HandleCallback(ctx *fasthttp.RequestCtx) {
 				log.Printf("Sent global broadcast for other payment: orderNo=%s, amount=%s", orderID, amount)
 			}
 		}
-	}()
+	})
 }
 
-// updateOrderStatusToPaid 更新订单状态为已支付
-// TODO: 生产必改点3：实现真实的数据库更新逻辑
-func (ar *APIRoutes) updateOrderStatusToPaid(orderNo, amount string) error {
-	// 短暂延迟，确保数据库事务已提交
-	time.Sleep(1 * time.Second)
+// broadcastMilestone 分类累计金额跨过里程碑时向该项目和分类的展示端广播庆祝消息
+func (ar *APIRoutes) broadcastMilestone(milestone services.Milestone, donation models.Donation) {
+	ar.wsManager.BroadcastToSpecific(&PayNotification{
+		Type:      "milestone",
+		OrderNo:   donation.OrderID,
+		Time:      utils.Now(),
+		Category:  milestone.CategoryID,
+		Total:     strconv.FormatFloat(float64(milestone.TotalCents)/100, 'f', 2, 64),
+		Milestone: strconv.FormatFloat(float64(milestone.MilestoneCents)/100, 'f', 2, 64),
+	}, donation.PaymentConfigID, donation.Categories)
+	log.Printf("Sent milestone broadcast: orderNo=%s, category=%s, milestone=%d, total=%d", donation.OrderID, milestone.CategoryID, milestone.MilestoneCents, milestone.TotalCents)
+}
 
-	// 获取与当前订单相关的捐款记录
-	ar.paymentService.GetDonationByOrderID(orderNo)
+// callbackChannel 根据回调数据格式判断支付通道：shouqianba（默认）、alipay、wechat
+func callbackChannel(data map[string]interface{}) string {
+	if data == nil || data["client_sn"] != nil {
+		return "shouqianba"
+	}
+	if data["trade_status"] != nil || data["notify_id"] != nil {
+		return "alipay"
+	}
+	if data["result_code"] != nil || data["transaction_id"] != nil || data["event_type"] != nil {
+		return "wechat"
+	}
+	return "shouqianba"
+}
 
-	// 示例：更新订单状态
-	// 真实场景需要连接数据库并执行更新操作
-	log.Printf("Update order status to paid: orderNo=%s, amount=%s", orderNo, amount)
+// callbackAckBody 获取支付通道的回调应答内容，可通过callback.ack.<channel>配置覆盖
+// 默认：收钱吧和支付宝为"success"，微信为{"code":"SUCCESS","message":"成功"}
+func callbackAckBody(channel string) string {
+	if ack := viper.GetString("callback.ack." + channel); ack != "" {
+		return ack
+	}
+	if channel == "wechat" {
+		return `{"code":"SUCCESS","message":"成功"}`
+	}
+	return "success"
+}
 
-	return nil // 替换为真实数据库操作
+// writeCallbackAck 返回回调应答，JSON格式的应答设置对应的Content-Type
+func writeCallbackAck(ctx *fasthttp.RequestCtx, channel string) {
+	ack := callbackAckBody(channel)
+	if strings.HasPrefix(ack, "{") {
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.WriteString(ack)
 }
 
 // GetRankings 获取捐款排行榜
@@ -1031,28 +1342,13 @@ func (ar *APIRoutes) GetRankings(ctx *fasthttp.RequestCtx) {
 	ctxTimeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// 解析limit参数，设置默认值和范围校验
-	limitStr := string(ctx.QueryArgs().Peek("limit"))
-	if limitStr == "" {
-		limitStr = "10"
-	}
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
-		limit = 10
-	}
-	// 限制最大返回数量，防止性能问题
-	if limit > 100 {
-		limit = 100
-	}
-
-	// 解析page参数，设置默认值和范围校验
-	pageStr := string(ctx.QueryArgs().Peek("page"))
-	if pageStr == "" {
-		pageStr = "1"
-	}
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page <= 0 {
-		page = 1
+	// 解析limit和page参数（limit最大MaxPageLimit，偏移量不超过pagination.max_offset）
+	limit, page, offset, err := parsePagination(ctx, 10)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
 	}
 
 	// 获取payment和categories参数（支持别名）
@@ -1060,13 +1356,9 @@ func (ar *APIRoutes) GetRankings(ctx *fasthttp.RequestCtx) {
 	if paymentConfigID == "" {
 		paymentConfigID = string(ctx.QueryArgs().Peek("p"))
 	}
-	categoryID := string(ctx.QueryArgs().Peek("categories"))
-	if categoryID == "" {
-		categoryID = string(ctx.QueryArgs().Peek("c"))
-	}
-
-	// 计算偏移量
-	offset := (page - 1) * limit
+	categoryID := queryCategoryID(ctx)
+	// 是否同时返回已全部退款的捐款（标记refunded: true），默认不返回
+	includeRefunded := string(ctx.QueryArgs().Peek("include_refunded")) == "true"
 
 	// 使用goroutine和channel处理超时
 	type result struct {
@@ -1077,7 +1369,7 @@ func (ar *APIRoutes) GetRankings(ctx *fasthttp.RequestCtx) {
 	resultChan := make(chan result, 1)
 
 	go func() {
-		rankings, err := ar.paymentService.GetRankings(limit, offset, paymentConfigID, categoryID)
+		rankings, err := ar.paymentService.GetRankings(limit, offset, paymentConfigID, categoryID, includeRefunded)
 		resultChan <- result{rankings, err}
 	}()
 
@@ -1091,8 +1383,9 @@ func (ar *APIRoutes) GetRankings(ctx *fasthttp.RequestCtx) {
 		}
 
 		// 构建响应数据
+		// 只返回展示所需字段，不公开捐款人openid和支付配置ID
 		responseData := map[string]interface{}{
-			"rankings": res.rankings,
+			"rankings": services.NewPublicRankingItems(res.rankings, offset),
 			"pagination": map[string]interface{}{
 				"limit":  limit,
 				"page":   page,
@@ -1112,6 +1405,211 @@ func (ar *APIRoutes) GetRankings(ctx *fasthttp.RequestCtx) {
 	}
 }
 
+// GetBlessingWall 功德墙：最近带有祝福语的捐款，供闲置屏幕滚动展示
+func (ar *APIRoutes) GetBlessingWall(ctx *fasthttp.RequestCtx) {
+	limit := parseLimit(ctx, 20)
+
+	// 获取payment和categories参数（支持别名）
+	paymentConfigID := string(ctx.QueryArgs().Peek("payment"))
+	if paymentConfigID == "" {
+		paymentConfigID = string(ctx.QueryArgs().Peek("p"))
+	}
+	categoryID := queryCategoryID(ctx)
+
+	items, err := ar.paymentService.GetBlessingWall(limit, paymentConfigID, categoryID)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// 只返回展示所需字段，不公开捐款人openid和支付配置ID
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"wall": services.NewPublicRankingItems(items, 0),
+	})
+}
+
+// StreamRankings 以NDJSON格式流式导出排行榜（每行一个JSON对象），分批读取并逐批刷新
+func (ar *APIRoutes) StreamRankings(ctx *fasthttp.RequestCtx) {
+	// 获取payment和categories参数（支持别名）
+	paymentConfigID := string(ctx.QueryArgs().Peek("payment"))
+	if paymentConfigID == "" {
+		paymentConfigID = string(ctx.QueryArgs().Peek("p"))
+	}
+	categoryID := queryCategoryID(ctx)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		encoder := json.NewEncoder(w)
+		rank := 0
+		err := ar.paymentService.StreamRankings(paymentConfigID, categoryID, 500, func(items []services.RankingItem) error {
+			for _, item := range items {
+				rank++
+				if err := encoder.Encode(services.NewPublicRankingItem(item, rank)); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		})
+		if err != nil {
+			log.Printf("Stream rankings failed: payment=%s, categories=%s, err=%v", paymentConfigID, categoryID, err)
+		}
+	})
+}
+
+// GetMyRank 获取当前用户（cookie中的openid或user_id）在累计金额排行中的名次
+func (ar *APIRoutes) GetMyRank(ctx *fasthttp.RequestCtx) {
+	openid := string(ctx.Request.Header.Cookie("wechat_openid"))
+	if openid == "" || openid == "anonymous" {
+		openid = string(ctx.Request.Header.Cookie("alipay_user_id"))
+	}
+
+	// 获取payment和categories参数（支持别名）
+	paymentConfigID := string(ctx.QueryArgs().Peek("payment"))
+	if paymentConfigID == "" {
+		paymentConfigID = string(ctx.QueryArgs().Peek("p"))
+	}
+	categoryID := queryCategoryID(ctx)
+
+	rank, total, err := ar.paymentService.GetDonorRank(openid, paymentConfigID, categoryID)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"ranked":          rank > 0,
+		"rank":            rank,
+		"total":           total,
+		"formatted_total": services.FormatAmount(total),
+	})
+}
+
+// GetMyPendingOrders 获取当前用户（cookie中的openid或user_id）最近未完成的订单，匿名时返回空列表
+func (ar *APIRoutes) GetMyPendingOrders(ctx *fasthttp.RequestCtx) {
+	payment := "wechat"
+	openid := string(ctx.Request.Header.Cookie("wechat_openid"))
+	if openid == "" || openid == "anonymous" {
+		payment = "alipay"
+		openid = string(ctx.Request.Header.Cookie("alipay_user_id"))
+	}
+
+	orders, err := ar.paymentService.GetDonorPendingOrders(payment, openid)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{"orders": orders})
+}
+
+// GetDonorProfile 获取捐款人公开资料（/api/donor/{openid或user_id}），可用payment参数限定支付配置
+func (ar *APIRoutes) GetDonorProfile(ctx *fasthttp.RequestCtx) {
+	openid := strings.TrimPrefix(string(ctx.Path()), "/api/donor/")
+
+	// 获取payment参数（支持别名）
+	paymentConfigID := string(ctx.QueryArgs().Peek("payment"))
+	if paymentConfigID == "" {
+		paymentConfigID = string(ctx.QueryArgs().Peek("p"))
+	}
+
+	includeCategories := string(ctx.QueryArgs().Peek("include_categories")) == "true"
+
+	profile, err := ar.paymentService.GetDonorProfile(openid, paymentConfigID, includeCategories)
+	if err != nil {
+		status := fasthttp.StatusInternalServerError
+		if errors.Is(err, services.ErrDonorNotFound) {
+			status = fasthttp.StatusNotFound
+		}
+		ctx.SetStatusCode(status)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(profile)
+}
+
+// GetLatestDonation 获取指定范围内最新的一笔捐款，范围内没有捐款时返回204
+func (ar *APIRoutes) GetLatestDonation(ctx *fasthttp.RequestCtx) {
+	// 获取payment和categories参数（支持别名）
+	paymentConfigID := string(ctx.QueryArgs().Peek("payment"))
+	if paymentConfigID == "" {
+		paymentConfigID = string(ctx.QueryArgs().Peek("p"))
+	}
+	categoryID := queryCategoryID(ctx)
+
+	// 最新捐款的最长时间范围（如30m），默认使用latest.max_age（0为不限制）
+	maxAge := viper.GetDuration("latest.max_age")
+	if raw := string(ctx.QueryArgs().Peek("max_age")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "invalid max_age"})
+			return
+		}
+		maxAge = d
+	}
+
+	latest, err := ar.paymentService.GetLatestDonation(paymentConfigID, categoryID, maxAge)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if latest == nil {
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(services.NewPublicRankingItem(*latest, 1))
+}
+
+// GetAvatar 头像代理，通过本站获取并缓存微信/支付宝头像（需开启avatar_proxy.enabled）
+func (ar *APIRoutes) GetAvatar(ctx *fasthttp.RequestCtx) {
+	raw := string(ctx.QueryArgs().Peek("u"))
+	image, err := ar.paymentService.FetchAvatar(raw)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAvatarProxyDisabled):
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+		case errors.Is(err, services.ErrAvatarHostNotAllowed):
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		default:
+			log.Printf("Avatar proxy failed: url=%s, error=%v", raw, err)
+			ctx.SetStatusCode(fasthttp.StatusBadGateway)
+		}
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", image.ContentType)
+	ctx.Response.Header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(services.AvatarCacheTTL().Seconds())))
+	ctx.Response.Header.Set("X-Content-Type-Options", "nosniff")
+	ctx.SetBody(image.Body)
+}
+
 // ActivateTerminal 手动激活终端API
 func (ar *APIRoutes) ActivateTerminal(ctx *fasthttp.RequestCtx) {
 	// 从请求体获取激活码
@@ -1128,6 +1626,15 @@ func (ar *APIRoutes) ActivateTerminal(ctx *fasthttp.RequestCtx) {
 
 	// 执行终端激活
 	if err := ar.paymentService.ActivateTerminal(req.ActivationCode); err != nil {
+		// 接口地址配置错误属于网关问题，与激活码无效等业务失败区分
+		if errors.Is(err, services.ErrGatewayEndpointNotFound) || errors.Is(err, services.ErrGatewayNonJSON) {
+			ctx.SetStatusCode(fasthttp.StatusBadGateway)
+			ctx.Response.Header.Set("Content-Type", "application/json")
+			json.NewEncoder(ctx).Encode(map[string]string{
+				"error": "Payment gateway endpoint not found, please check api_url config",
+			})
+			return
+		}
 		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
 		ctx.Response.Header.Set("Content-Type", "application/json")
 		json.NewEncoder(ctx).Encode(map[string]string{
@@ -1164,10 +1671,7 @@ func (ar *APIRoutes) GenerateQRCode(ctx *fasthttp.RequestCtx) {
 	}
 
 	// 获取categories参数（支持别名）
-	categories := string(ctx.QueryArgs().Peek("categories"))
-	if categories == "" {
-		categories = string(ctx.QueryArgs().Peek("c"))
-	}
+	categories := queryCategoryID(ctx)
 
 	// 当payment有参数时，如果没有categories参数，自动设置默认的categories参数
 	if categories == "" {
@@ -1175,9 +1679,22 @@ func (ar *APIRoutes) GenerateQRCode(ctx *fasthttp.RequestCtx) {
 		categories = "1"
 	}
 
-	// 获取请求的主机名
-	host := string(ctx.Host())
+	payURL := qrPayURL(string(ctx.Host()), payment, categories)
 
+	qrBytes, err := utils.GenerateQRCode(payURL)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.Response.Header.Set("Content-Type", "image/png")
+	ctx.Write(qrBytes)
+}
+
+// qrPayURL 生成二维码中的支付页地址
+func qrPayURL(host, payment, categories string) string {
 	// 处理不同的访问情况
 	switch host {
 	// 本地访问情况
@@ -1198,17 +1715,113 @@ func (ar *APIRoutes) GenerateQRCode(ctx *fasthttp.RequestCtx) {
 	if categories != "" {
 		payURL += fmt.Sprintf("&categories=%s", categories)
 	}
+	return payURL
+}
 
-	qrBytes, err := utils.GenerateQRCode(payURL)
-	if err != nil {
+// qrFileNameReplacer 去除文件名中不安全的字符
+var qrFileNameReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+
+// GenerateQRCodeBatch 批量生成分类支付二维码，以ZIP流式返回（每个分类一张PNG，按分类命名）
+// 参数：payment/p（必填）、categories/category_id/c（逗号分隔的分类ID），数量上限config: qrcode.batch_max（默认50）
+func (ar *APIRoutes) GenerateQRCodeBatch(ctx *fasthttp.RequestCtx) {
+	payment := string(ctx.QueryArgs().Peek("payment"))
+	if payment == "" {
+		payment = string(ctx.QueryArgs().Peek("p"))
+	}
+	payment, err := services.NormalizePaymentConfigID(payment)
+	if err != nil || payment == "" {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "invalid payment"})
+		return
+	}
+
+	var raw string
+	for _, name := range []string{"categories", "category_id", "c"} {
+		if raw = string(ctx.QueryArgs().Peek(name)); raw != "" {
+			break
+		}
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(raw, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if n, err := strconv.ParseUint(id, 10, 32); err != nil || n == 0 {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(ctx).Encode(map[string]string{"error": "invalid category id: " + id})
+			return
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	maxCount := viper.GetInt("qrcode.batch_max")
+	if maxCount <= 0 {
+		maxCount = 50
+	}
+	if len(ids) == 0 || len(ids) > maxCount {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": fmt.Sprintf("categories must contain 1 to %d ids", maxCount)})
+		return
+	}
+
+	var categories []models.Category
+	if err := utils.Reader().Where("id IN ?", ids).Find(&categories).Error; err != nil {
 		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
 		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
 		json.NewEncoder(ctx).Encode(map[string]string{"error": err.Error()})
 		return
 	}
+	names := make(map[string]string, len(categories))
+	for _, category := range categories {
+		names[strconv.FormatUint(uint64(category.ID), 10)] = category.Name
+	}
+	var missing []string
+	for _, id := range ids {
+		if _, ok := names[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "category not found: " + strings.Join(missing, ",")})
+		return
+	}
 
-	ctx.Response.Header.Set("Content-Type", "image/png")
-	ctx.Write(qrBytes)
+	host := string(ctx.Host())
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/zip")
+	ctx.Response.Header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="qrcodes-%s.zip"`, payment))
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		zw := zip.NewWriter(w)
+		for _, id := range ids {
+			png, err := utils.GenerateQRCode(qrPayURL(host, payment, id))
+			if err != nil {
+				log.Printf("Batch QR code failed: payment=%s, category=%s, err=%v", payment, id, err)
+				return
+			}
+			f, err := zw.Create(fmt.Sprintf("%s-%s.png", id, qrFileNameReplacer.Replace(names[id])))
+			if err == nil {
+				_, err = f.Write(png)
+			}
+			if err == nil {
+				err = w.Flush()
+			}
+			if err != nil {
+				log.Printf("Batch QR code stream failed: payment=%s, err=%v", payment, err)
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			log.Printf("Batch QR code stream failed: payment=%s, err=%v", payment, err)
+		}
+	})
 }
 
 // GetPaymentConfig 获取支付配置信息
@@ -1224,16 +1837,44 @@ func (ar *APIRoutes) GetPaymentConfig(ctx *fasthttp.RequestCtx) {
 	}
 
 	var paymentConfig models.PaymentConfig
-	if err := utils.DB.Where("id = ?", id).First(&paymentConfig).Error; err != nil {
+	if err := utils.Reader().Where("id = ?", id).First(&paymentConfig).Error; err != nil {
 		ctx.SetStatusCode(fasthttp.StatusNotFound)
 		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
 		json.NewEncoder(ctx).Encode(map[string]string{"error": "支付配置不存在"})
 		return
 	}
 
+	// 品牌信息（logo、标题）很少变化，允许前端和CDN缓存；配置更新后updated_at变化，ETag随之失效
+	// config: payment_config.cache_max_age（缓存时间，默认5m，0为每次都向服务器验证）
+	maxAge := viper.GetDuration("payment_config.cache_max_age")
+	if !viper.IsSet("payment_config.cache_max_age") {
+		maxAge = 5 * time.Minute
+	}
+	etag := fmt.Sprintf(`"%d-%d"`, paymentConfig.ID, paymentConfig.UpdatedAt.UnixNano())
+	ctx.Response.Header.Set("ETag", etag)
+	ctx.Response.Header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	if etagMatches(string(ctx.Request.Header.Peek("If-None-Match")), etag) {
+		ctx.SetStatusCode(fasthttp.StatusNotModified)
+		return
+	}
+
 	ctx.SetStatusCode(fasthttp.StatusOK)
 	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(ctx).Encode(paymentConfig)
+	json.NewEncoder(ctx).Encode(struct {
+		models.PaymentConfig
+		Payments []string `json:"payments"` // 可用支付方式，前端据此隐藏不可用的支付方式
+	}{paymentConfig, services.AllowedPayments(services.NewShouqianbaConfig(paymentConfig))})
+}
+
+// etagMatches If-None-Match是否包含etag（支持逗号分隔的多个值、弱校验W/前缀和*）
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
 // GetCategory 获取类目信息
@@ -1249,7 +1890,7 @@ func (ar *APIRoutes) GetCategory(ctx *fasthttp.RequestCtx) {
 	}
 
 	var category models.Category
-	if err := utils.DB.Where("id = ?", id).First(&category).Error; err != nil {
+	if err := utils.Reader().Where("id = ?", id).First(&category).Error; err != nil {
 		ctx.SetStatusCode(fasthttp.StatusNotFound)
 		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
 		json.NewEncoder(ctx).Encode(map[string]string{"error": "类目不存在"})
@@ -1264,7 +1905,7 @@ func (ar *APIRoutes) GetCategory(ctx *fasthttp.RequestCtx) {
 // GetCategories 获取所有类目列表
 func (ar *APIRoutes) GetCategories(ctx *fasthttp.RequestCtx) {
 	var categories []models.Category
-	query := utils.DB
+	query := utils.Reader()
 
 	// 根据payment参数过滤（支持别名）
 	payment := string(ctx.QueryArgs().Peek("payment"))
@@ -1287,6 +1928,27 @@ func (ar *APIRoutes) GetCategories(ctx *fasthttp.RequestCtx) {
 	json.NewEncoder(ctx).Encode(categories)
 }
 
+// GetCategoryOverview 获取分类概览（每个分类的捐款统计和最近一笔捐款），支持payment参数过滤
+func (ar *APIRoutes) GetCategoryOverview(ctx *fasthttp.RequestCtx) {
+	payment := string(ctx.QueryArgs().Peek("payment"))
+	if payment == "" {
+		payment = string(ctx.QueryArgs().Peek("p"))
+	}
+
+	overviews, err := ar.paymentService.GetCategoryOverview(payment)
+	if err != nil {
+		log.Printf("Error getting category overview: %v", err)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "获取分类概览失败"})
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx).Encode(overviews)
+}
+
 // setAnonymousWechatCookie 设置微信匿名用户cookie
 func (ar *APIRoutes) setAnonymousWechatCookie(ctx *fasthttp.RequestCtx) {
 	cookie := &fasthttp.Cookie{}
@@ -1342,6 +2004,18 @@ func (ar *APIRoutes) setAnonymousAlipayCookie(ctx *fasthttp.RequestCtx) {
 	ctx.Response.Header.SetCookie(cookie)
 }
 
+// allowedRedirectURL 校验重定向地址（config: redirect.allowed_hosts），不允许时返回空字符串以使用默认地址
+func (ar *APIRoutes) allowedRedirectURL(ctx *fasthttp.RequestCtx, redirectURL string) string {
+	if redirectURL == "" {
+		return ""
+	}
+	if !utils.IsRedirectAllowed(redirectURL, string(ctx.Host()), viper.GetStringSlice("redirect.allowed_hosts")) {
+		log.Printf("Redirect URL not allowed, using default: %s", redirectURL)
+		return ""
+	}
+	return redirectURL
+}
+
 // buildRedirectURL 构建重定向URL
 func (ar *APIRoutes) buildRedirectURL(redirectURL, payment, categories string) string {
 	if redirectURL == "" {
@@ -1383,3 +2057,35 @@ func (ar *APIRoutes) buildRedirectURL(redirectURL, payment, categories string) s
 
 	return redirectURL
 }
+
+var (
+	trustedProxies     []*net.IPNet
+	trustedProxiesOnce sync.Once
+)
+
+// clientIP 获取真实客户端IP，经受信任的代理（负载均衡、Nginx）转发时取X-Forwarded-For中的地址
+// config: server.trusted_proxies（受信任代理的CIDR或IP列表，默认仅本机127.0.0.1、::1）
+func clientIP(ctx *fasthttp.RequestCtx) string {
+	trustedProxiesOnce.Do(func() {
+		entries := viper.GetStringSlice("server.trusted_proxies")
+		if !viper.IsSet("server.trusted_proxies") {
+			entries = []string{"127.0.0.1/32", "::1/128"}
+		}
+		trustedProxies = utils.ParseTrustedProxies(entries)
+	})
+	return utils.ClientIP(ctx.RemoteIP(), string(ctx.Request.Header.Peek("X-Forwarded-For")), trustedProxies).String()
+}
+
+// queryCategoryID 获取请求中的分类ID（单个），参数优先级：category_id > categories > c
+// categories/c为兼容旧链接保留；传入逗号分隔的多个值时只取第一个
+func queryCategoryID(ctx *fasthttp.RequestCtx) string {
+	for _, name := range []string{"category_id", "categories", "c"} {
+		if v := strings.TrimSpace(string(ctx.QueryArgs().Peek(name))); v != "" {
+			if i := strings.Index(v, ","); i >= 0 {
+				v = strings.TrimSpace(v[:i])
+			}
+			return v
+		}
+	}
+	return ""
+}
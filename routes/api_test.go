@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+)
+
+// serve 构造请求并交给handler处理，返回响应状态码
+func serve(handler func(ctx *fasthttp.RequestCtx), method, path string) int {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(path)
+	handler(&ctx)
+	return ctx.Response.StatusCode()
+}
+
+// setAdminPorts 设置主端口和管理端口，测试结束后恢复
+func setAdminPorts(t *testing.T, serverPort, adminPort int) {
+	t.Helper()
+	viper.Set("server.port", serverPort)
+	viper.Set("admin.port", adminPort)
+	t.Cleanup(func() {
+		viper.Set("server.port", 0)
+		viper.Set("admin.port", 0)
+	})
+}
+
+var adminRouteRequests = []struct{ method, path string }{
+	{"GET", "/api/admin/overview"},
+	{"POST", "/api/admin/reenrich"},
+	{"POST", "/api/campaign/reset"},
+	{"POST", "/api/order/ORD1/refund"},
+	{"POST", "/api/payment-config/1/signin"},
+	{"GET", "/metrics"},
+}
+
+func TestAdminRoutesHiddenOnPublicPortWhenAdminPortSet(t *testing.T) {
+	setAdminPorts(t, 9090, 9091)
+	ar := &APIRoutes{}
+	public := func(ctx *fasthttp.RequestCtx) { ar.HandleRequest(ctx, "") }
+
+	for _, req := range adminRouteRequests {
+		if got := serve(public, req.method, req.path); got != fasthttp.StatusNotFound {
+			t.Errorf("public %s %s = %d, want 404", req.method, req.path, got)
+		}
+		// 管理端口仍提供管理接口（未配置admin.token时返回403）
+		if got := serve(ar.HandleAdminRequest, req.method, req.path); got == fasthttp.StatusNotFound {
+			t.Errorf("admin %s %s = 404, want admin route", req.method, req.path)
+		}
+	}
+
+	if got := serve(ar.HandleAdminRequest, "GET", "/api/rankings"); got != fasthttp.StatusNotFound {
+		t.Errorf("admin GET /api/rankings = %d, want 404", got)
+	}
+}
+
+func TestAdminRoutesOnPublicPortWithoutAdminPort(t *testing.T) {
+	for _, ports := range [][2]int{{9090, 0}, {9090, 9090}} {
+		setAdminPorts(t, ports[0], ports[1])
+		ar := &APIRoutes{}
+		public := func(ctx *fasthttp.RequestCtx) { ar.HandleRequest(ctx, "") }
+
+		for _, req := range adminRouteRequests {
+			if got := serve(public, req.method, req.path); got != fasthttp.StatusForbidden {
+				t.Errorf("server.port=%d admin.port=%d: public %s %s = %d, want 403 from admin check", ports[0], ports[1], req.method, req.path, got)
+			}
+		}
+	}
+}
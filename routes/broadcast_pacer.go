@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// broadcastPacer 按范围（payment+categories）限制支付成功广播的最小间隔
+// 大量积压订单同时完成时，通知进入该范围的队列，按间隔逐条发出，前端逐个播放动画而不是同时涌入
+type broadcastPacer struct {
+	scopes  sync.Map // key为payment|categories，value为chan pacedNotification
+	dropped int64    // 因队列已满丢弃的通知数
+}
+
+type pacedNotification struct {
+	notification *PayNotification
+	payment      string
+	categories   string
+}
+
+// broadcastInterval 同一范围两次广播的最小间隔（config: websocket.broadcast_interval，默认0，不限制）
+func broadcastInterval() time.Duration {
+	return viper.GetDuration("websocket.broadcast_interval")
+}
+
+// enqueue 将通知加入对应范围的队列，首次使用该范围时启动发送协程
+// 队列已满（config: websocket.broadcast_queue_size，默认100）时丢弃最早的通知，保证屏幕展示的是最新捐款
+func (p *broadcastPacer) enqueue(m *WebSocketManager, n pacedNotification) {
+	key := n.payment + "|" + n.categories
+	value, ok := p.scopes.Load(key)
+	if !ok {
+		queueSize := viper.GetInt("websocket.broadcast_queue_size")
+		if queueSize <= 0 {
+			queueSize = 100
+		}
+		var loaded bool
+		value, loaded = p.scopes.LoadOrStore(key, make(chan pacedNotification, queueSize))
+		if !loaded {
+			go p.run(m, value.(chan pacedNotification))
+		}
+	}
+	queue := value.(chan pacedNotification)
+
+	for {
+		select {
+		case queue <- n:
+			return
+		default:
+		}
+		select {
+		case old := <-queue:
+			atomic.AddInt64(&p.dropped, 1)
+			log.Printf("Warning: Broadcast queue full for payment='%s', categories='%s', dropped orderNo=%s", old.payment, old.categories, old.notification.OrderNo)
+		default:
+		}
+	}
+}
+
+// run 按间隔逐条发送该范围的通知
+func (p *broadcastPacer) run(m *WebSocketManager, queue chan pacedNotification) {
+	for n := range queue {
+		interval := broadcastInterval()
+		m.sendToSpecific(n.notification, n.payment, n.categories)
+		time.Sleep(interval)
+	}
+}
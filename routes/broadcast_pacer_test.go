@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestBroadcastBurstIsPacedPerScope(t *testing.T) {
+	newTestRoutes(t)
+	viper.Set("websocket.broadcast_interval", "100ms")
+	t.Cleanup(func() { viper.Set("websocket.broadcast_interval", "") })
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+	mustCreate(t, &models.PaymentConfig{ID: 2, VendorSN: "V2", TerminalSN: "T2"})
+
+	m := NewWebSocketManager()
+	connect := startWebSocketServer(t, m)
+	busy := connect("p=1")
+	other := connect("p=2")
+
+	// 积压订单同时完成
+	orders := []string{"ORD1", "ORD2", "ORD3", "ORD4"}
+	for _, orderNo := range orders {
+		m.BroadcastToSpecific(&PayNotification{Type: "pay_success", OrderNo: orderNo}, "1", "")
+	}
+	m.BroadcastToSpecific(&PayNotification{Type: "pay_success", OrderNo: "OTHER"}, "2", "")
+
+	// 其他范围不等待该范围的队列
+	if notification, ok := readNotification(t, other, 50*time.Millisecond); !ok || notification.OrderNo != "OTHER" {
+		t.Errorf("other scope notification = %+v, %t, want OTHER without waiting", notification, ok)
+	}
+
+	var last time.Time
+	for i, orderNo := range orders {
+		notification, ok := readNotification(t, busy, 2*time.Second)
+		if !ok {
+			t.Fatalf("notification %d not received", i+1)
+		}
+		now := time.Now()
+		if notification.OrderNo != orderNo {
+			t.Errorf("notification %d = %s, want %s in order", i+1, notification.OrderNo, orderNo)
+		}
+		if i > 0 && now.Sub(last) < 80*time.Millisecond {
+			t.Errorf("notification %d arrived %v after the previous one, want spaced by about 100ms", i+1, now.Sub(last))
+		}
+		last = now
+	}
+}
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCallbackAck(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        map[string]interface{}
+		channel     string
+		ack         string
+		contentType string
+	}{
+		{"shouqianba", map[string]interface{}{"client_sn": "ORD1", "status": "SUCCESS"}, "shouqianba", "success", ""},
+		// 收钱吧回调同时带有client_sn和微信字段时仍按收钱吧应答
+		{"shouqianba with wechat fields", map[string]interface{}{"client_sn": "ORD1", "result_code": "200"}, "shouqianba", "success", ""},
+		{"empty body", nil, "shouqianba", "success", ""},
+		{"unknown fields", map[string]interface{}{"foo": "bar"}, "shouqianba", "success", ""},
+		{"alipay trade_status", map[string]interface{}{"out_trade_no": "ORD1", "trade_status": "TRADE_SUCCESS"}, "alipay", "success", ""},
+		{"alipay notify_id", map[string]interface{}{"notify_id": "N1"}, "alipay", "success", ""},
+		{"wechat result_code", map[string]interface{}{"out_trade_no": "ORD1", "result_code": "SUCCESS"}, "wechat", `{"code":"SUCCESS","message":"成功"}`, "application/json; charset=utf-8"},
+		{"wechat transaction_id", map[string]interface{}{"transaction_id": "T1"}, "wechat", `{"code":"SUCCESS","message":"成功"}`, "application/json; charset=utf-8"},
+		{"wechat v3 event", map[string]interface{}{"event_type": "TRANSACTION.SUCCESS"}, "wechat", `{"code":"SUCCESS","message":"成功"}`, "application/json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		channel := callbackChannel(tt.data)
+		if channel != tt.channel {
+			t.Errorf("%s: callbackChannel = %s, want %s", tt.name, channel, tt.channel)
+			continue
+		}
+		var ctx fasthttp.RequestCtx
+		writeCallbackAck(&ctx, channel)
+		if body := string(ctx.Response.Body()); body != tt.ack {
+			t.Errorf("%s: ack = %q, want %q", tt.name, body, tt.ack)
+		}
+		if tt.contentType != "" && string(ctx.Response.Header.ContentType()) != tt.contentType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.name, ctx.Response.Header.ContentType(), tt.contentType)
+		}
+	}
+}
+
+func TestCallbackAckBodyOverride(t *testing.T) {
+	viper.Set("callback.ack.alipay", "OK")
+	viper.Set("callback.ack.wechat", `{"code":"OK"}`)
+	t.Cleanup(func() {
+		viper.Set("callback.ack.alipay", "")
+		viper.Set("callback.ack.wechat", "")
+	})
+	for channel, want := range map[string]string{
+		"alipay":     "OK",
+		"wechat":     `{"code":"OK"}`,
+		"shouqianba": "success",
+	} {
+		if got := callbackAckBody(channel); got != want {
+			t.Errorf("callbackAckBody(%s) = %q, want %q", channel, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"hash/fnv"
+	"log"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+// callbackQueue 回调后续处理队列（状态更新、关联查询、广播），固定数量的工作协程处理，平滑突发回调
+// 同一订单号总是分配到同一个工作协程，保证同一订单的回调按到达顺序处理
+type callbackQueue struct {
+	shards  []chan func()
+	dropped int64 // 因队列已满未处理的回调数
+}
+
+// CallbackQueueStats 回调队列指标
+type CallbackQueueStats struct {
+	Workers       int   `json:"workers"`
+	QueueDepth    int   `json:"queue_depth"`
+	QueueCapacity int   `json:"queue_capacity"`
+	Dropped       int64 `json:"dropped"`
+}
+
+// newCallbackQueue 创建并启动回调队列
+// config: callback.workers（默认16）、callback.queue_size（每个工作协程的队列长度，默认256）
+func newCallbackQueue() *callbackQueue {
+	workers := viper.GetInt("callback.workers")
+	if workers <= 0 {
+		workers = 16
+	}
+	queueSize := viper.GetInt("callback.queue_size")
+	if queueSize <= 0 {
+		queueSize = 256
+	}
+
+	q := &callbackQueue{shards: make([]chan func(), workers)}
+	for i := range q.shards {
+		q.shards[i] = make(chan func(), queueSize)
+		go q.worker(q.shards[i])
+	}
+	return q
+}
+
+// worker 依次处理分配到的回调任务
+func (q *callbackQueue) worker(jobs chan func()) {
+	for job := range jobs {
+		job()
+	}
+}
+
+// Enqueue 按订单号加入队列，队列已满时丢弃并记录（订单状态已在应答前更新，后续由轮询和对账补齐）
+func (q *callbackQueue) Enqueue(orderID string, job func()) bool {
+	h := fnv.New32a()
+	h.Write([]byte(orderID))
+	shard := q.shards[h.Sum32()%uint32(len(q.shards))]
+
+	select {
+	case shard <- job:
+		return true
+	default:
+		atomic.AddInt64(&q.dropped, 1)
+		log.Printf("Warning: Callback queue full, dropping post-ack processing for order %s", orderID)
+		return false
+	}
+}
+
+// Stats 获取回调队列指标
+func (q *callbackQueue) Stats() CallbackQueueStats {
+	stats := CallbackQueueStats{
+		Workers: len(q.shards),
+		Dropped: atomic.LoadInt64(&q.dropped),
+	}
+	for _, shard := range q.shards {
+		stats.QueueDepth += len(shard)
+		stats.QueueCapacity += cap(shard)
+	}
+	return stats
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestCallbackQueuePreservesPerOrderOrderUnderLoad(t *testing.T) {
+	viper.Set("callback.workers", 8)
+	viper.Set("callback.queue_size", 4096)
+	t.Cleanup(func() {
+		viper.Set("callback.workers", 0)
+		viper.Set("callback.queue_size", 0)
+	})
+	q := newCallbackQueue()
+
+	const orders, callbacksPerOrder = 200, 20
+	var mutex sync.Mutex
+	seen := make(map[string][]int)
+	var done sync.WaitGroup
+	done.Add(orders * callbacksPerOrder)
+
+	// 各订单的回调由不同协程并发入队，同一订单内按顺序入队
+	var enqueuers sync.WaitGroup
+	for i := 0; i < orders; i++ {
+		enqueuers.Add(1)
+		go func(orderID string) {
+			defer enqueuers.Done()
+			for seq := 0; seq < callbacksPerOrder; seq++ {
+				seq := seq
+				if !q.Enqueue(orderID, func() {
+					defer done.Done()
+					mutex.Lock()
+					seen[orderID] = append(seen[orderID], seq)
+					mutex.Unlock()
+				}) {
+					t.Errorf("Enqueue(%s, %d) dropped", orderID, seq)
+					done.Done()
+				}
+			}
+		}(fmt.Sprintf("ORD%04d", i))
+	}
+	enqueuers.Wait()
+
+	finished := make(chan struct{})
+	go func() {
+		done.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("callbacks not processed within 10s")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(seen) != orders {
+		t.Fatalf("processed %d orders, want %d", len(seen), orders)
+	}
+	for orderID, seqs := range seen {
+		if len(seqs) != callbacksPerOrder {
+			t.Errorf("%s processed %d callbacks, want %d", orderID, len(seqs), callbacksPerOrder)
+			continue
+		}
+		for i, seq := range seqs {
+			if seq != i {
+				t.Errorf("%s processed out of order: %v", orderID, seqs)
+				break
+			}
+		}
+	}
+	if stats := q.Stats(); stats.Dropped != 0 || stats.Workers != 8 {
+		t.Errorf("stats = %+v, want 8 workers and no drops", stats)
+	}
+}
+
+func TestCallbackQueueDropsWhenShardFull(t *testing.T) {
+	viper.Set("callback.workers", 1)
+	viper.Set("callback.queue_size", 1)
+	t.Cleanup(func() {
+		viper.Set("callback.workers", 0)
+		viper.Set("callback.queue_size", 0)
+	})
+	q := newCallbackQueue()
+
+	// 第一个任务阻塞工作协程，第二个占满队列，第三个被丢弃
+	block := make(chan struct{})
+	started := make(chan struct{})
+	q.Enqueue("ORD1", func() {
+		close(started)
+		<-block
+	})
+	<-started
+	if !q.Enqueue("ORD1", func() {}) {
+		t.Fatal("second Enqueue dropped, want queued")
+	}
+	if q.Enqueue("ORD1", func() {}) {
+		t.Error("Enqueue into full shard succeeded, want dropped")
+	}
+	close(block)
+	if stats := q.Stats(); stats.Dropped != 1 {
+		t.Errorf("dropped = %d, want 1", stats.Dropped)
+	}
+}
@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/services"
+)
+
+// signedCallback 构造使用终端密钥签名的回调请求体
+func signedCallback(t *testing.T, ps *services.PaymentService, fields map[string]string) []byte {
+	t.Helper()
+	data := make(map[string]string, len(fields)+1)
+	for k, v := range fields {
+		data[k] = v
+	}
+	data["sign"] = ps.GenerateSign(fields, "terminal")
+	body, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("marshal callback: %v", err)
+	}
+	return body
+}
+
+func TestCallbackBroadcastsWithoutFixedDelay(t *testing.T) {
+	ar := newTestRoutes(t)
+	ar.paymentService = services.NewPaymentService(services.ShouqianbaConfig{TerminalSN: "T1", TerminalKey: "key"})
+	ar.wsManager = NewWebSocketManager()
+	ar.callbacks = newCallbackQueue()
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, AmountCents: 1000, Payment: "alipay", OpenID: "anonymous", PaymentConfigID: "1", Status: "pending"})
+	client := startWebSocketServer(t, ar.wsManager)("p=1")
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI("/api/callback")
+	ctx.Request.SetBody(signedCallback(t, ar.paymentService, map[string]string{"client_sn": "ORD1", "status": "SUCCESS", "total_amount": "1000"}))
+	start := time.Now()
+	ar.HandleCallback(&ctx)
+	if string(ctx.Response.Body()) != "success" {
+		t.Fatalf("callback response = %d %q, want success", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	// 订单状态在应答前已写入，广播不再固定等待1秒
+	notification, ok := readNotification(t, client, 2*time.Second)
+	if !ok {
+		t.Fatal("no broadcast after callback")
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("broadcast took %v after callback, want well under the old 1s delay", elapsed)
+	}
+	if notification.Type != "pay_success" || notification.OrderNo != "ORD1" {
+		t.Errorf("notification = %+v, want pay_success for ORD1", notification)
+	}
+}
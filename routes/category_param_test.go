@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestQueryCategoryIDAliases(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"category_id=3", "3"},
+		{"categories=3", "3"},
+		{"c=3", "3"},
+		// category_id优先于categories，categories优先于c
+		{"categories=2&category_id=3", "3"},
+		{"c=1&categories=2", "2"},
+		{"c=1&categories=2&category_id=3", "3"},
+		// 空值跳过，使用下一个别名
+		{"category_id=&categories=2", "2"},
+		{"category_id=%20&c=1", "1"},
+		// 只取逗号分隔的第一个值
+		{"categories=2,3", "2"},
+		{"c=%201%20,2", "1"},
+	}
+	for _, tt := range tests {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.SetRequestURI("/api/rankings?" + tt.query)
+		if got := queryCategoryID(&ctx); got != tt.want {
+			t.Errorf("queryCategoryID(%s) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRankingsCategoryFilterAliases(t *testing.T) {
+	ar := newTestRoutes(t)
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1"})
+	mustCreate(t, &models.Category{ID: 2, Name: "放生", PaymentConfigID: "1"})
+	mustCreate(t, &models.WechatUser{OpenID: "wx1", Nickname: "供灯施主"})
+	mustCreate(t, &models.WechatUser{OpenID: "wx2", Nickname: "放生施主"})
+	mustCreate(t, &models.Donation{OpenID: "wx1", Amount: 10, AmountCents: 1000, Payment: "wechat", PaymentConfigID: "1", Categories: "1", OrderID: "ORD1", Status: "completed"})
+	mustCreate(t, &models.Donation{OpenID: "wx2", Amount: 20, AmountCents: 2000, Payment: "wechat", PaymentConfigID: "1", Categories: "2", OrderID: "ORD2", Status: "completed"})
+
+	for _, query := range []string{"category_id=1", "categories=1", "c=1", "c=2&categories=1", "categories=2&category_id=1", "categories=1,2"} {
+		body := string(request(ar.GetRankings, "GET", "/api/rankings?p=1&"+query).Response.Body())
+		if !strings.Contains(body, "供灯施主") || strings.Contains(body, "放生施主") {
+			t.Errorf("rankings?%s = %s, want only category 1 donors", query, body)
+		}
+	}
+}
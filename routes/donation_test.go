@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/services"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// newDonationRoutes 主配置指向模拟网关（签到失败不影响下单），已授权的微信用户为wx_secret_openid
+func newDonationRoutes(t *testing.T) *APIRoutes {
+	t.Helper()
+	ar := newTestRoutes(t)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result_code":"400","error_message":"test gateway"}`))
+	}))
+	t.Cleanup(gateway.Close)
+	ar.paymentService = services.NewPaymentService(services.ShouqianbaConfig{APIURL: gateway.URL, GatewayURL: gateway.URL, TerminalSN: "T1", TerminalKey: "key"})
+
+	viper.Set("server.public_host", "example.com")
+	t.Cleanup(func() { viper.Set("server.public_host", "") })
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯"})
+	mustCreate(t, &models.WechatUser{OpenID: "wx_secret_openid", Nickname: "微信施主"})
+	return ar
+}
+
+func TestAnonymousDonationNotLinkedToDonor(t *testing.T) {
+	for name, send := range map[string]func(ar *APIRoutes) *fasthttp.RequestCtx{
+		"json": func(ar *APIRoutes) *fasthttp.RequestCtx {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/api/donation")
+			ctx.Request.Header.SetCookie("wechat_openid", "wx_secret_openid")
+			ctx.Request.SetBodyString(`{"amount":10,"payment":"wechat","category":"1","anonymous":true}`)
+			ar.CreateDonation(&ctx)
+			return &ctx
+		},
+		"form": func(ar *APIRoutes) *fasthttp.RequestCtx {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/api/donation/form")
+			ctx.Request.Header.SetContentType("application/x-www-form-urlencoded")
+			ctx.Request.Header.SetCookie("wechat_openid", "wx_secret_openid")
+			ctx.Request.SetBodyString("amount=10&payment=wechat&category=1&anonymous=on")
+			ar.CreateDonationForm(&ctx)
+			return &ctx
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ar := newDonationRoutes(t)
+			ctx := send(ar)
+			if status := ctx.Response.StatusCode(); status != fasthttp.StatusOK && status != fasthttp.StatusFound {
+				t.Fatalf("create donation status = %d: %s", status, ctx.Response.Body())
+			}
+
+			var donation models.Donation
+			if err := utils.DB.First(&donation).Error; err != nil {
+				t.Fatalf("load donation: %v", err)
+			}
+			if donation.OpenID != "anonymous" {
+				t.Fatalf("donation openid = %q, want anonymous", donation.OpenID)
+			}
+
+			// 支付完成后排行榜显示为匿名施主，不关联授权用户的昵称
+			utils.DB.Model(&donation).Update("status", "completed")
+			body := request(ar.GetRankings, "GET", "/api/rankings").Response.Body()
+			if !strings.Contains(string(body), "匿名施主") || strings.Contains(string(body), "微信施主") {
+				t.Errorf("rankings = %s, want anonymous donor without nickname", body)
+			}
+			assertNoDonorIDs(t, "/api/rankings", body)
+		})
+	}
+}
+
+func TestCreateDonationRejectsInvalidPaymentConfigID(t *testing.T) {
+	ar := newDonationRoutes(t)
+	for _, payment := range []string{"abc", "0", "-1", "1%20OR%201%3D1"} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod("POST")
+		ctx.Request.SetRequestURI("/api/donation?payment=" + payment)
+		ctx.Request.SetBodyString(`{"amount":10,"payment":"wechat","category":"1"}`)
+		ar.CreateDonation(&ctx)
+		if ctx.Response.StatusCode() != fasthttp.StatusBadRequest {
+			t.Errorf("payment=%s: status = %d, want 400", payment, ctx.Response.StatusCode())
+		}
+	}
+	var count int64
+	utils.DB.Model(&models.Donation{}).Count(&count)
+	if count != 0 {
+		t.Errorf("created %d donations with invalid config ids, want 0", count)
+	}
+}
@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/services"
+)
+
+func TestDonorProfileCategoryBreakdown(t *testing.T) {
+	ar := newTestRoutes(t)
+	seedDonors(t)
+	mustCreate(t, &models.Category{ID: 2, Name: "放生", PaymentConfigID: "1", Payment: "1"})
+	// 微信施主在两个分类和未分类下各有捐款：供灯10+20.20（部分退款0.20），放生5.05+0.01，未分类3
+	for _, d := range []models.Donation{
+		{Amount: 20.2, AmountCents: 2020, RefundedAmount: 0.2, Categories: "1", OrderID: "ORD3", Status: "completed"},
+		{Amount: 5.05, AmountCents: 505, Categories: "2", OrderID: "ORD4", Status: "completed"},
+		{Amount: 0.01, AmountCents: 1, Categories: "2", OrderID: "ORD5", Status: "completed"},
+		{Amount: 3, AmountCents: 300, Categories: "", OrderID: "ORD6", Status: "completed"},
+		// 未完成的捐款不计入
+		{Amount: 99, AmountCents: 9900, Categories: "2", OrderID: "ORD7", Status: "pending"},
+	} {
+		d.OpenID, d.Payment, d.PaymentConfigID = "wx_secret_openid", "wechat", "1"
+		mustCreate(t, &d)
+	}
+
+	ctx := request(ar.GetDonorProfile, "GET", "/api/donor/wx_secret_openid?include_categories=true")
+	if ctx.Response.StatusCode() != fasthttp.StatusOK {
+		t.Fatalf("donor profile status = %d: %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	assertNoDonorIDs(t, "/api/donor", ctx.Response.Body())
+	var profile services.DonorProfile
+	if err := json.Unmarshal(ctx.Response.Body(), &profile); err != nil {
+		t.Fatalf("decode %s: %v", ctx.Response.Body(), err)
+	}
+
+	// 按金额从高到低排列，各分类合计之和等于总额
+	want := []services.DonorCategoryTotal{
+		{CategoryID: "1", CategoryName: "供灯", DonationCount: 2, TotalAmount: 30, FormattedTotal: "¥30.00"},
+		{CategoryID: "2", CategoryName: "放生", DonationCount: 2, TotalAmount: 5.06, FormattedTotal: "¥5.06"},
+		{CategoryID: "", CategoryName: "", DonationCount: 1, TotalAmount: 3, FormattedTotal: "¥3.00"},
+	}
+	if !reflect.DeepEqual(profile.Categories, want) {
+		t.Errorf("categories = %+v, want %+v", profile.Categories, want)
+	}
+	if profile.DonationCount != 5 || profile.TotalAmount != 38.06 {
+		t.Errorf("profile totals = %d donations, %v, want 5, 38.06", profile.DonationCount, profile.TotalAmount)
+	}
+
+	// 默认不返回分类明细
+	ctx = request(ar.GetDonorProfile, "GET", "/api/donor/wx_secret_openid")
+	var plain map[string]interface{}
+	if err := json.Unmarshal(ctx.Response.Body(), &plain); err != nil {
+		t.Fatalf("decode %s: %v", ctx.Response.Body(), err)
+	}
+	if _, ok := plain["categories"]; ok {
+		t.Errorf("profile without include_categories = %s, want no categories", ctx.Response.Body())
+	}
+
+	// 匿名捐款人没有公开资料
+	if status := request(ar.GetDonorProfile, "GET", "/api/donor/anonymous?include_categories=true").Response.StatusCode(); status != fasthttp.StatusNotFound {
+		t.Errorf("anonymous donor status = %d, want 404", status)
+	}
+}
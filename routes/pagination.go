@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+)
+
+// MaxPageLimit 分页接口单页最大返回数量
+const MaxPageLimit = 100
+
+// errOffsetTooLarge 页码过大，偏移量超过pagination.max_offset
+var errOffsetTooLarge = errors.New("page too large")
+
+// parseLimit 解析limit参数，无效时使用默认值，超过MaxPageLimit时取MaxPageLimit
+func parseLimit(ctx *fasthttp.RequestCtx, defaultLimit int) int {
+	limit, err := strconv.Atoi(string(ctx.QueryArgs().Peek("limit")))
+	if err != nil || limit <= 0 {
+		return defaultLimit
+	}
+	if limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return limit
+}
+
+// parsePagination 解析limit和page参数并计算偏移量，page无效时为1
+// 偏移量超过pagination.max_offset（默认10000）时返回errOffsetTooLarge，避免大OFFSET扫描
+func parsePagination(ctx *fasthttp.RequestCtx, defaultLimit int) (limit, page, offset int, err error) {
+	limit = parseLimit(ctx, defaultLimit)
+
+	page, err = strconv.Atoi(string(ctx.QueryArgs().Peek("page")))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	maxOffset := viper.GetInt("pagination.max_offset")
+	if maxOffset <= 0 {
+		maxOffset = 10000
+	}
+	// 先按页码判断，避免page极大时乘法溢出
+	if page-1 > maxOffset/limit {
+		return limit, page, 0, errOffsetTooLarge
+	}
+	offset = (page - 1) * limit
+	if offset > maxOffset {
+		return limit, page, 0, errOffsetTooLarge
+	}
+	return limit, page, offset, nil
+}
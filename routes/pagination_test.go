@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+)
+
+// paginationCtx 构造带查询参数的请求上下文
+func paginationCtx(query string) *fasthttp.RequestCtx {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/api/rankings?" + query)
+	return &ctx
+}
+
+func TestParsePagination(t *testing.T) {
+	maxPage := strconv.Itoa(10000/MaxPageLimit + 1)
+	tests := []struct {
+		query               string
+		limit, page, offset int
+		err                 error
+	}{
+		{"", 10, 1, 0, nil},
+		{"limit=20&page=3", 20, 3, 40, nil},
+		// limit无效时使用默认值，超过上限时取MaxPageLimit
+		{"limit=0", 10, 1, 0, nil},
+		{"limit=-5", 10, 1, 0, nil},
+		{"limit=abc", 10, 1, 0, nil},
+		{"limit=1000000", MaxPageLimit, 1, 0, nil},
+		// page无效时为1
+		{"page=0", 10, 1, 0, nil},
+		{"page=-3", 10, 1, 0, nil},
+		{"page=abc", 10, 1, 0, nil},
+		// 偏移量不超过pagination.max_offset（默认10000）
+		{"limit=100&page=" + maxPage, 100, 101, 10000, nil},
+		{"limit=100&page=102", 100, 102, 0, errOffsetTooLarge},
+		{"limit=10&page=1002", 10, 1002, 0, errOffsetTooLarge},
+		{"limit=1&page=9223372036854775807", 1, 9223372036854775807, 0, errOffsetTooLarge},
+		{"page=99999999999999999999", 10, 1, 0, nil},
+	}
+	for _, tt := range tests {
+		limit, page, offset, err := parsePagination(paginationCtx(tt.query), 10)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("parsePagination(%s) error = %v, want %v", tt.query, err, tt.err)
+		}
+		if limit != tt.limit || page != tt.page || offset != tt.offset {
+			t.Errorf("parsePagination(%s) = limit %d, page %d, offset %d, want %d, %d, %d", tt.query, limit, page, offset, tt.limit, tt.page, tt.offset)
+		}
+	}
+}
+
+func TestParsePaginationMaxOffset(t *testing.T) {
+	viper.Set("pagination.max_offset", 50)
+	t.Cleanup(func() { viper.Set("pagination.max_offset", 0) })
+
+	if _, _, offset, err := parsePagination(paginationCtx("limit=10&page=6"), 10); err != nil || offset != 50 {
+		t.Errorf("page at max_offset = offset %d, %v, want 50", offset, err)
+	}
+	if _, _, _, err := parsePagination(paginationCtx("limit=10&page=7"), 10); !errors.Is(err, errOffsetTooLarge) {
+		t.Errorf("page past max_offset error = %v, want errOffsetTooLarge", err)
+	}
+}
+
+func TestGetRankingsRejectsPageTooLarge(t *testing.T) {
+	ar := newTestRoutes(t)
+	ctx := request(ar.GetRankings, "GET", "/api/rankings?limit=100&page=1000")
+	if ctx.Response.StatusCode() != fasthttp.StatusBadRequest {
+		t.Errorf("GetRankings with huge page = %d, want 400", ctx.Response.StatusCode())
+	}
+}
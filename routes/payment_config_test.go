@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// getPaymentConfig 请求/api/payment-config/1，ifNoneMatch为空时不带条件请求头
+func getPaymentConfig(ar *APIRoutes, ifNoneMatch string) *fasthttp.RequestCtx {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod("GET")
+	ctx.Request.SetRequestURI("/api/payment-config/1")
+	if ifNoneMatch != "" {
+		ctx.Request.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	ar.GetPaymentConfig(&ctx)
+	return &ctx
+}
+
+func TestGetPaymentConfigIfNoneMatch(t *testing.T) {
+	ar := newTestRoutes(t)
+	config := models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1", StoreName: "主院"}
+	mustCreate(t, &config)
+
+	first := getPaymentConfig(ar, "")
+	etag := string(first.Response.Header.Peek("ETag"))
+	if first.Response.StatusCode() != fasthttp.StatusOK || etag == "" {
+		t.Fatalf("first request = %d, ETag %q, want 200 with ETag", first.Response.StatusCode(), etag)
+	}
+	if got := string(first.Response.Header.Peek("Cache-Control")); got != "public, max-age=300" {
+		t.Errorf("Cache-Control = %q, want default max-age=300", got)
+	}
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		ctx := getPaymentConfig(ar, ifNoneMatch)
+		if ctx.Response.StatusCode() != fasthttp.StatusNotModified || len(ctx.Response.Body()) != 0 {
+			t.Errorf("If-None-Match %s = %d with %d byte body, want 304 without body", ifNoneMatch, ctx.Response.StatusCode(), len(ctx.Response.Body()))
+		}
+		if got := string(ctx.Response.Header.Peek("ETag")); got != etag {
+			t.Errorf("If-None-Match %s: ETag = %q, want %q", ifNoneMatch, got, etag)
+		}
+	}
+
+	if ctx := getPaymentConfig(ar, `"stale"`); ctx.Response.StatusCode() != fasthttp.StatusOK {
+		t.Errorf("stale If-None-Match = %d, want 200", ctx.Response.StatusCode())
+	}
+
+	// 配置更新后ETag变化，旧的ETag不再命中
+	if err := utils.DB.Model(&config).Updates(map[string]interface{}{"store_name": "新名称", "updated_at": time.Now().Add(time.Second)}).Error; err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	ctx := getPaymentConfig(ar, etag)
+	if ctx.Response.StatusCode() != fasthttp.StatusOK {
+		t.Errorf("old ETag after update = %d, want 200", ctx.Response.StatusCode())
+	}
+	if got := string(ctx.Response.Header.Peek("ETag")); got == etag {
+		t.Errorf("ETag unchanged after update: %s", got)
+	}
+}
+
+func TestGetPaymentConfigCacheMaxAge(t *testing.T) {
+	ar := newTestRoutes(t)
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+	viper.Set("payment_config.cache_max_age", "0")
+	t.Cleanup(func() { viper.Set("payment_config.cache_max_age", nil) })
+
+	if got := string(getPaymentConfig(ar, "").Response.Header.Peek("Cache-Control")); got != "public, max-age=0" {
+		t.Errorf("Cache-Control = %q, want max-age=0", got)
+	}
+}
@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/services"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// newTestRoutes 使用内存数据库创建路由，测试结束后恢复全局DB
+func newTestRoutes(t *testing.T) *APIRoutes {
+	t.Helper()
+	t.Cleanup(utils.InitTestDB())
+	return &APIRoutes{paymentService: services.NewPaymentService(services.ShouqianbaConfig{})}
+}
+
+func mustCreate(t *testing.T, value interface{}) {
+	t.Helper()
+	if err := utils.DB.Create(value).Error; err != nil {
+		t.Fatalf("seed %T: %v", value, err)
+	}
+}
+
+// request 构造请求并交给handler处理，返回处理后的请求上下文
+func request(handler func(ctx *fasthttp.RequestCtx), method, uri string) *fasthttp.RequestCtx {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(uri)
+	handler(&ctx)
+	return &ctx
+}
+
+// seedDonors 写入已授权的微信和支付宝捐款人，openid/user_id不应出现在公开接口中
+func seedDonors(t *testing.T) {
+	t.Helper()
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1", Payment: "1"})
+	mustCreate(t, &models.WechatUser{OpenID: "wx_secret_openid", Nickname: "微信施主"})
+	mustCreate(t, &models.AlipayUser{UserID: "ali_secret_uid", Nickname: "支付宝施主"})
+	mustCreate(t, &models.Donation{OpenID: "wx_secret_openid", PayerUID: "wx_secret_openid", Amount: 10, AmountCents: 1000, Payment: "wechat", PaymentConfigID: "1", Categories: "1", Blessing: "阿弥陀佛", BlessingApproved: true, OrderID: "ORD1", Status: "completed"})
+	mustCreate(t, &models.Donation{OpenID: "ali_secret_uid", PayerUID: "ali_secret_uid", Amount: 20, AmountCents: 2000, Payment: "alipay", PaymentConfigID: "1", Categories: "1", Blessing: "吉祥", BlessingApproved: true, OrderID: "ORD2", Status: "completed"})
+}
+
+// assertNoDonorIDs 响应中不能包含捐款人标识，extra为额外不应出现的内部字段
+func assertNoDonorIDs(t *testing.T, name string, body []byte, extra ...string) {
+	t.Helper()
+	s := string(body)
+	for _, secret := range append([]string{"wx_secret_openid", "ali_secret_uid", `"openid"`, `"user_id"`, `"payer_uid"`}, extra...) {
+		if strings.Contains(s, secret) {
+			t.Errorf("%s response contains %s: %s", name, secret, s)
+		}
+	}
+}
+
+func TestPublicRankingsOmitDonorIDs(t *testing.T) {
+	ar := newTestRoutes(t)
+	seedDonors(t)
+
+	for name, handler := range map[string]func(ctx *fasthttp.RequestCtx){
+		"/api/rankings?p=1":        ar.GetRankings,
+		"/api/wall?p=1":            ar.GetBlessingWall,
+		"/api/rankings/stream?p=1": ar.StreamRankings,
+	} {
+		ctx := request(handler, "GET", name)
+		body := ctx.Response.Body()
+		if ctx.Response.StatusCode() != fasthttp.StatusOK {
+			t.Fatalf("%s status = %d: %s", name, ctx.Response.StatusCode(), body)
+		}
+		if !strings.Contains(string(body), "微信施主") || !strings.Contains(string(body), "支付宝施主") {
+			t.Errorf("%s response missing donor names: %s", name, body)
+		}
+		assertNoDonorIDs(t, name, body, `"payment_config_id"`)
+	}
+}
+
+func TestLatestDonationAndCategoryOverviewOmitDonorIDs(t *testing.T) {
+	ar := newTestRoutes(t)
+	seedDonors(t)
+
+	for name, handler := range map[string]func(ctx *fasthttp.RequestCtx){
+		"/api/latest?p=1":              ar.GetLatestDonation,
+		"/api/latest?p=1&categories=1": ar.GetLatestDonation,
+		"/api/categories/overview":     ar.GetCategoryOverview,
+		"/api/categories/overview?p=1": ar.GetCategoryOverview,
+	} {
+		ctx := request(handler, "GET", name)
+		body := ctx.Response.Body()
+		if ctx.Response.StatusCode() != fasthttp.StatusOK {
+			t.Fatalf("%s status = %d: %s", name, ctx.Response.StatusCode(), body)
+		}
+		// 最新一笔为支付宝捐款，展示昵称但不公开user_id
+		if !strings.Contains(string(body), "支付宝施主") {
+			t.Errorf("%s response missing latest donor name: %s", name, body)
+		}
+		assertNoDonorIDs(t, name, body)
+	}
+}
+
+func TestLatestDonationMaxAge(t *testing.T) {
+	ar := newTestRoutes(t)
+	t.Cleanup(func() { viper.Set("latest.max_age", 0) })
+	mustCreate(t, &models.Donation{OpenID: "anonymous", Amount: 10, OrderID: "ORD_OLD", Status: "completed", CreatedAt: time.Now().Add(-2 * time.Hour)})
+
+	tests := []struct {
+		configured string
+		uri        string
+		want       int
+	}{
+		// 默认不限制，返回很久以前的捐款
+		{"", "/api/latest", fasthttp.StatusOK},
+		// 只有超出时间范围的捐款时返回204，前端显示空状态
+		{"", "/api/latest?max_age=30m", fasthttp.StatusNoContent},
+		{"30m", "/api/latest", fasthttp.StatusNoContent},
+		// 请求参数优先于latest.max_age
+		{"30m", "/api/latest?max_age=3h", fasthttp.StatusOK},
+		{"", "/api/latest?max_age=abc", fasthttp.StatusBadRequest},
+		{"", "/api/latest?max_age=-1m", fasthttp.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		viper.Set("latest.max_age", tt.configured)
+		ctx := request(ar.GetLatestDonation, "GET", tt.uri)
+		if ctx.Response.StatusCode() != tt.want {
+			t.Errorf("%s with latest.max_age=%q status = %d, want %d: %s", tt.uri, tt.configured, ctx.Response.StatusCode(), tt.want, ctx.Response.Body())
+		}
+	}
+
+	// 时间范围内有新捐款时返回新捐款
+	mustCreate(t, &models.Donation{OpenID: "anonymous", Amount: 20, OrderID: "ORD_NEW", Status: "completed", CreatedAt: time.Now().Add(-time.Minute)})
+	viper.Set("latest.max_age", "")
+	ctx := request(ar.GetLatestDonation, "GET", "/api/latest?max_age=30m")
+	if ctx.Response.StatusCode() != fasthttp.StatusOK || !strings.Contains(string(ctx.Response.Body()), `"amount":20`) {
+		t.Errorf("latest within window = %d %s, want the new donation", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
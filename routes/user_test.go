@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestForgetUserExpiresCookiesOnRootPath(t *testing.T) {
+	ar := newTestRoutes(t)
+	mustCreate(t, &models.WechatUser{OpenID: "wx_openid", Nickname: "微信施主"})
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI("/api/user/forget")
+	ctx.Request.Header.SetCookie("wechat_openid", "wx_openid")
+	ar.ForgetUser(&ctx)
+	if ctx.Response.StatusCode() != fasthttp.StatusOK {
+		t.Fatalf("ForgetUser status = %d: %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	// 设置cookie时使用路径/，删除时路径必须一致，且立即过期
+	for _, key := range []string{
+		"wechat_openid", "wechat_user_id", "wechat_user_name", "wechat_avatar_url",
+		"alipay_user_id", "alipay_user_name", "alipay_avatar_url", "alipay_access_token",
+	} {
+		cookie := &fasthttp.Cookie{}
+		cookie.SetKey(key)
+		if !ctx.Response.Header.Cookie(cookie) {
+			t.Errorf("Set-Cookie for %s missing", key)
+			continue
+		}
+		if string(cookie.Path()) != "/" || string(cookie.Value()) != "" || !cookie.Expire().Equal(fasthttp.CookieExpireDelete) {
+			t.Errorf("Set-Cookie %s = %q, want empty value, path / and expired", key, cookie.String())
+		}
+	}
+}
+
+func TestCheckUserExists(t *testing.T) {
+	ar := newTestRoutes(t)
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	mustCreate(t, &models.WechatUser{OpenID: "wx_valid", AccessToken: "token", ExpiresAt: expires})
+	mustCreate(t, &models.WechatUser{OpenID: "wx_expired", AccessToken: "token", ExpiresAt: time.Now().Add(-time.Hour)})
+	mustCreate(t, &models.WechatUser{OpenID: "wx_forgotten"})
+	mustCreate(t, &models.AlipayUser{UserID: "ali_valid", AccessToken: "token", ExpiresAt: expires})
+
+	tests := []struct {
+		query              string
+		exists, authorized bool
+		expiresAt          bool
+	}{
+		// 微信用户按open_id列查询
+		{"openid=wx_valid&payment=wechat", true, true, true},
+		{"openid=wx_expired&p=wechat", true, false, true},
+		{"openid=wx_forgotten&payment=wechat", true, false, false},
+		{"openid=wx_missing&payment=wechat", false, false, false},
+		// 支付宝用户按user_id查询，不与微信用户表串用
+		{"openid=ali_valid&payment=alipay", true, true, true},
+		{"openid=wx_valid&payment=alipay", false, false, false},
+		{"openid=ali_valid&payment=wechat", false, false, false},
+	}
+	for _, tt := range tests {
+		ctx := request(ar.CheckUserExists, "GET", "/api/check-user?"+tt.query)
+		if ctx.Response.StatusCode() != fasthttp.StatusOK {
+			t.Errorf("%s: status = %d, want 200", tt.query, ctx.Response.StatusCode())
+			continue
+		}
+		var body struct {
+			Exists     bool       `json:"exists"`
+			Authorized bool       `json:"authorized"`
+			ExpiresAt  *time.Time `json:"expires_at"`
+		}
+		if err := json.Unmarshal(ctx.Response.Body(), &body); err != nil {
+			t.Fatalf("%s: decode %s: %v", tt.query, ctx.Response.Body(), err)
+		}
+		if body.Exists != tt.exists || body.Authorized != tt.authorized || (body.ExpiresAt != nil) != tt.expiresAt {
+			t.Errorf("%s: body = %s, want exists %t, authorized %t, expires_at set %t", tt.query, ctx.Response.Body(), tt.exists, tt.authorized, tt.expiresAt)
+		}
+		if tt.authorized && !body.ExpiresAt.Equal(expires) {
+			t.Errorf("%s: expires_at = %v, want %v", tt.query, body.ExpiresAt, expires)
+		}
+	}
+
+	for _, query := range []string{"openid=wx_valid", "payment=wechat"} {
+		if status := request(ar.CheckUserExists, "GET", "/api/check-user?"+query).Response.StatusCode(); status != fasthttp.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, status)
+		}
+	}
+}
@@ -2,24 +2,49 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fasthttp/websocket"
+	"github.com/spf13/viper"
 	"github.com/valyala/fasthttp"
+	"github.com/zhifu/donation-rank/models"
 	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
 )
 
 // ClientConn WebSocket客户端连接
 type ClientConn struct {
 	Conn       *websocket.Conn
-	LastHeart  time.Time // 最后心跳时间
-	ConnID     string    // 连接ID
-	IP         string    // 客户端IP
-	Payment    string    // 支付方式参数
-	Categories string    // 分类参数
+	LastHeart  time.Time  // 最后心跳时间
+	ConnID     string     // 连接ID
+	IP         string     // 客户端IP
+	Payment    string     // 支付方式参数
+	Categories string     // 分类参数
+	admin      int32      // 是否已通过管理令牌认证（原子读写），认证后接收所有项目和分类的通知
+	writeMutex sync.Mutex // websocket连接不支持并发写，推送与回复都经由WriteMessage串行写入
+}
+
+// WriteMessage 串行写入消息，推送goroutine与读循环的回复可能同时写同一连接
+func (c *ClientConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// IsAdmin 是否为管理端连接
+func (c *ClientConn) IsAdmin() bool {
+	return atomic.LoadInt32(&c.admin) == 1
+}
+
+// wsAuthMessage 管理端认证消息：{"type":"auth","token":"..."}
+type wsAuthMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
 }
 
 // PayNotification 支付通知
@@ -33,6 +58,13 @@ type PayNotification struct {
 	AvatarURL string `json:"avatar_url"` // 头像URL
 	UserName  string `json:"user_name"`  // 用户名
 	CreatedAt string `json:"created_at"` // 创建时间
+	Tier      int    `json:"tier"`       // 捐款档位，前端据此选择提示音和动画
+	// 是否为捐款人的首笔已完成捐款，前端据此展示首捐庆祝效果
+	IsFirstDonation bool `json:"is_first_donation"`
+	// 里程碑通知（type为milestone）：分类ID、分类累计金额及跨过的里程碑金额
+	Category  string `json:"category,omitempty"`
+	Total     string `json:"total,omitempty"`
+	Milestone string `json:"milestone,omitempty"`
 }
 
 // WebSocketManager WebSocket管理器
@@ -40,6 +72,21 @@ type WebSocketManager struct {
 	Clients           sync.Map      // 线程安全连接池
 	HeartbeatInterval time.Duration // 心跳检查间隔
 	HeartbeatTimeout  time.Duration // 心跳超时时间
+	pacer             broadcastPacer
+	active            int64 // 已占用的连接名额（含正在升级的连接）
+	rejected          int64 // 因超过连接数上限被拒绝的连接数
+}
+
+// WebSocketStats WebSocket连接指标
+type WebSocketStats struct {
+	Connections    int   `json:"connections"`
+	MaxConnections int   `json:"max_connections"` // 0为不限制
+	Rejected       int64 `json:"rejected"`
+}
+
+// maxConnections 最大WebSocket连接数（config: websocket.max_connections，默认0，不限制）
+func maxConnections() int {
+	return viper.GetInt("websocket.max_connections")
 }
 
 // NewWebSocketManager 创建WebSocket管理器
@@ -60,11 +107,18 @@ func NewWebSocketManager() *WebSocketManager {
 var Upgrader = websocket.FastHTTPUpgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	// 生产环境需要限制域名，测试环境返回true
+	// 校验Origin（config: cors.allowed_origins，未配置时仅允许同域）
 	CheckOrigin: func(ctx *fasthttp.RequestCtx) bool {
-		// TODO: 生产必改点1：限制允许的域名
-		// 例如：return ctx.Request.Header.Peek("Origin") == []byte("https://yourdomain.com")
-		return true // 测试环境允许所有域名
+		origin := string(ctx.Request.Header.Peek("Origin"))
+		if origin == "" {
+			// 非浏览器客户端不携带Origin
+			return true
+		}
+		if !utils.IsOriginAllowed(origin, string(ctx.Host()), viper.GetStringSlice("cors.allowed_origins")) {
+			log.Printf("WebSocket origin rejected: origin=%s, IP=%s", origin, clientIP(ctx))
+			return false
+		}
+		return true
 	},
 }
 
@@ -75,45 +129,131 @@ func (m *WebSocketManager) HandleWebSocket(ctx *fasthttp.RequestCtx) {
 	if payment == "" {
 		payment = string(ctx.QueryArgs().Peek("p"))
 	}
-	categories := string(ctx.QueryArgs().Peek("categories"))
-	if categories == "" {
-		categories = string(ctx.QueryArgs().Peek("c"))
+	categories := queryCategoryID(ctx)
+	token := string(ctx.QueryArgs().Peek("token"))
+
+	fmt.Printf("[DEBUG] WebSocket upgrade attempt: payment='%s', categories='%s', IP=%s\n", payment, categories, clientIP(ctx))
+
+	// 超过连接数上限时返回503，避免大量连接耗尽内存和协程
+	if limit := maxConnections(); atomic.AddInt64(&m.active, 1) > int64(limit) && limit > 0 {
+		atomic.AddInt64(&m.active, -1)
+		atomic.AddInt64(&m.rejected, 1)
+		log.Printf("WebSocket connection rejected, limit %d reached: IP=%s", limit, clientIP(ctx))
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		ctx.Response.Header.Set("Retry-After", "30")
+		ctx.Response.Header.Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(ctx).Encode(map[string]string{"error": "too many connections"})
+		return
 	}
 
-	fmt.Printf("[DEBUG] WebSocket upgrade attempt: payment='%s', categories='%s', IP=%s\n", payment, categories, string(ctx.RemoteIP().String()))
-
 	// 升级HTTP连接为WebSocket
 	err := Upgrader.Upgrade(ctx, func(conn *websocket.Conn) {
+		defer atomic.AddInt64(&m.active, -1)
+
 		// 连接成功后的回调
 		connID := utils.GenerateConnID()
-		clientIP := string(ctx.RemoteIP().String())
+		remoteIP := clientIP(ctx)
 
 		// 创建客户端连接
 		clientConn := &ClientConn{
 			Conn:       conn,
 			LastHeart:  time.Now(),
 			ConnID:     connID,
-			IP:         clientIP,
+			IP:         remoteIP,
 			Payment:    payment,
 			Categories: categories,
 		}
+		// 连接时通过token参数携带管理令牌，认证后订阅所有通知
+		if token != "" {
+			if isAdminToken(token) {
+				clientConn.admin = 1
+			} else {
+				log.Printf("WebSocket admin auth failed: IP=%s", remoteIP)
+			}
+		}
+
+		// 订阅范围不存在时发送错误消息并关闭连接，避免前端配置错误时连接正常却永远收不到通知
+		if !clientConn.IsAdmin() {
+			if reason := wsScopeError(payment, categories); reason != "" {
+				log.Printf("WebSocket scope rejected: %s, payment='%s', categories='%s', IP=%s", reason, payment, categories, remoteIP)
+				reply, _ := json.Marshal(map[string]string{"type": "error", "code": "INVALID_SCOPE", "error": reason})
+				conn.WriteMessage(websocket.TextMessage, reply)
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason), time.Now().Add(time.Second))
+				conn.Close()
+				return
+			}
+		}
+
+		// 消息限制在加入连接池前读取
+		maxMessageSize, rate := wsMessageLimits()
+		conn.SetReadLimit(maxMessageSize)
 
 		// 添加到连接池
 		m.Clients.Store(connID, clientConn)
-		fmt.Printf("[DEBUG] WebSocket connected: connID=%s, IP=%s, payment='%s', categories='%s'\n", connID, clientIP, payment, categories)
+		fmt.Printf("[DEBUG] WebSocket connected: connID=%s, IP=%s, payment='%s', categories='%s'\n", connID, remoteIP, payment, categories)
 
 		// 处理连接
-		m.handleClientConn(clientConn)
+		m.handleClientConn(clientConn, rate)
 	})
 
 	if err != nil {
-		fmt.Printf("[DEBUG] WebSocket upgrade failed: %v, IP=%s\n", err, string(ctx.RemoteIP().String()))
+		atomic.AddInt64(&m.active, -1)
+		fmt.Printf("[DEBUG] WebSocket upgrade failed: %v, IP=%s\n", err, clientIP(ctx))
 		return
 	}
 }
 
-// handleClientConn 处理客户端连接
-func (m *WebSocketManager) handleClientConn(clientConn *ClientConn) {
+// wsScopeError 校验订阅的项目（支付配置ID）和分类ID，为空表示不限制；不存在或分类不属于该项目时返回原因
+// 数据库不可用时不拒绝连接
+func wsScopeError(payment string, categories string) string {
+	db := utils.Reader()
+	if db == nil {
+		return ""
+	}
+
+	if payment != "" {
+		var count int64
+		if err := db.Model(&models.PaymentConfig{}).Where("id = ?", payment).Count(&count).Error; err != nil {
+			log.Printf("Warning: Failed to validate WebSocket payment '%s': %v", payment, err)
+			return ""
+		}
+		if count == 0 {
+			return "unknown payment config"
+		}
+	}
+
+	if categories != "" {
+		var category models.Category
+		if err := db.Where("id = ?", categories).First(&category).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return "unknown category"
+			}
+			log.Printf("Warning: Failed to validate WebSocket category '%s': %v", categories, err)
+			return ""
+		}
+		if payment != "" && category.PaymentConfigID != "" && category.PaymentConfigID != payment {
+			return "category does not belong to payment config"
+		}
+	}
+	return ""
+}
+
+// wsMessageLimits 单条消息大小和每秒消息数上限
+// config: websocket.max_message_size（默认4096字节）、websocket.max_messages_per_second（默认5）
+func wsMessageLimits() (int64, float64) {
+	maxMessageSize := viper.GetInt64("websocket.max_message_size")
+	if maxMessageSize <= 0 {
+		maxMessageSize = 4096
+	}
+	rate := viper.GetFloat64("websocket.max_messages_per_second")
+	if rate <= 0 {
+		rate = 5
+	}
+	return maxMessageSize, rate
+}
+
+// handleClientConn 处理客户端连接，rate为每秒消息数上限
+func (m *WebSocketManager) handleClientConn(clientConn *ClientConn, rate float64) {
 	defer func() {
 		// 清理连接
 		m.Clients.Delete(clientConn.ConnID)
@@ -121,6 +261,11 @@ func (m *WebSocketManager) handleClientConn(clientConn *ClientConn) {
 		log.Printf("WebSocket disconnected: connID=%s, IP=%s", clientConn.ConnID, clientConn.IP)
 	}()
 
+	// 令牌桶，允许短时间突发到每秒上限的2倍
+	burst := rate * 2
+	tokens := burst
+	lastRefill := time.Now()
+
 	for {
 		// 读取消息
 		messageType, message, err := clientConn.Conn.ReadMessage()
@@ -131,12 +276,26 @@ func (m *WebSocketManager) handleClientConn(clientConn *ClientConn) {
 			break
 		}
 
+		// 超过消息速率限制时断开连接（心跳ping同样计入，正常心跳远低于上限）
+		now := time.Now()
+		tokens += now.Sub(lastRefill).Seconds() * rate
+		if tokens > burst {
+			tokens = burst
+		}
+		lastRefill = now
+		if tokens < 1 {
+			log.Printf("WebSocket message rate exceeded, closing: connID=%s, IP=%s", clientConn.ConnID, clientConn.IP)
+			clientConn.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"), now.Add(time.Second))
+			break
+		}
+		tokens--
+
 		// 处理ping消息
 		if messageType == websocket.PingMessage {
 			// 更新心跳时间
 			clientConn.LastHeart = time.Now()
 			// 回复pong
-			if err := clientConn.Conn.WriteMessage(websocket.PongMessage, nil); err != nil {
+			if err := clientConn.WriteMessage(websocket.PongMessage, nil); err != nil {
 				log.Printf("WebSocket pong error: %v, connID=%s", err, clientConn.ConnID)
 				break
 			}
@@ -148,15 +307,33 @@ func (m *WebSocketManager) handleClientConn(clientConn *ClientConn) {
 			// 更新心跳时间
 			clientConn.LastHeart = time.Now()
 			// 回复pong
-			if err := clientConn.Conn.WriteMessage(websocket.TextMessage, []byte("pong")); err != nil {
+			if err := clientConn.WriteMessage(websocket.TextMessage, []byte("pong")); err != nil {
 				log.Printf("WebSocket text pong error: %v, connID=%s", err, clientConn.ConnID)
 				break
 			}
 			continue
 		}
 
-		// 忽略其他类型的消息
-		log.Printf("Received message: %s, connID=%s", string(message), clientConn.ConnID)
+		// 处理管理端认证消息，认证结果以auth_ok/auth_failed回复
+		var auth wsAuthMessage
+		if messageType == websocket.TextMessage && json.Unmarshal(message, &auth) == nil && auth.Type == "auth" {
+			reply := `{"type":"auth_failed"}`
+			if isAdminToken(auth.Token) {
+				atomic.StoreInt32(&clientConn.admin, 1)
+				reply = `{"type":"auth_ok"}`
+				log.Printf("WebSocket admin authenticated: connID=%s, IP=%s", clientConn.ConnID, clientConn.IP)
+			} else {
+				log.Printf("WebSocket admin auth failed: connID=%s, IP=%s", clientConn.ConnID, clientConn.IP)
+			}
+			if err := clientConn.WriteMessage(websocket.TextMessage, []byte(reply)); err != nil {
+				log.Printf("WebSocket auth reply error: %v, connID=%s", err, clientConn.ConnID)
+				break
+			}
+			continue
+		}
+
+		// 忽略其他类型的消息（只记录长度，避免刷屏日志）
+		log.Printf("Received message: %d bytes, connID=%s", len(message), clientConn.ConnID)
 	}
 }
 
@@ -205,7 +382,7 @@ func (m *WebSocketManager) Broadcast(notification *PayNotification) {
 	// 每个连接独立goroutine推送
 	m.Clients.Range(func(key, value interface{}) bool {
 		go func(clientConn *ClientConn) {
-			if err := clientConn.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			if err := clientConn.WriteMessage(websocket.TextMessage, data); err != nil {
 				log.Printf("Broadcast write error: %v, connID=%s, IP=%s, payment=%s, categories=%s", err, clientConn.ConnID, clientConn.IP, clientConn.Payment, clientConn.Categories)
 				// 关闭连接并清理
 				clientConn.Conn.Close()
@@ -219,7 +396,17 @@ func (m *WebSocketManager) Broadcast(notification *PayNotification) {
 }
 
 // BroadcastToSpecific 定向广播消息（根据payment和categories参数）
+// 配置了websocket.broadcast_interval时同一范围的通知按间隔逐条发送
 func (m *WebSocketManager) BroadcastToSpecific(notification *PayNotification, payment, categories string) {
+	if broadcastInterval() > 0 {
+		m.pacer.enqueue(m, pacedNotification{notification, payment, categories})
+		return
+	}
+	m.sendToSpecific(notification, payment, categories)
+}
+
+// sendToSpecific 立即向匹配payment和categories的连接发送通知
+func (m *WebSocketManager) sendToSpecific(notification *PayNotification, payment, categories string) {
 	// 序列化消息
 	data, err := json.Marshal(notification)
 	if err != nil {
@@ -227,38 +414,36 @@ func (m *WebSocketManager) BroadcastToSpecific(notification *PayNotification, pa
 		return
 	}
 
-	// 统计发送数量
-	sentCount := 0
-	failedCount := 0
+	// 统计匹配的连接数（发送在各自的goroutine中进行，失败单独记录日志）
+	matched := 0
 
 	// 每个连接独立goroutine推送
 	m.Clients.Range(func(key, value interface{}) bool {
 		clientConn := value.(*ClientConn)
 
-		// 检查参数匹配
+		// 检查参数匹配，管理端连接接收所有通知
 		paymentMatch := (payment == "" || clientConn.Payment == payment)
 		categoriesMatch := (categories == "" || clientConn.Categories == categories)
 
-		if paymentMatch && categoriesMatch {
+		if (paymentMatch && categoriesMatch) || clientConn.IsAdmin() {
+			matched++
 			// 捕获key变量，避免并发问题
 			connKey := key
 			go func() {
 				// 尝试发送消息，最多重试2次
 				retryCount := 0
 				maxRetries := 2
-				
+
 				for retryCount < maxRetries {
-					if err := clientConn.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+					if err := clientConn.WriteMessage(websocket.TextMessage, data); err != nil {
 						retryCount++
 						if retryCount >= maxRetries {
 							log.Printf("Broadcast write error: %v, connID=%s, IP=%s", err, clientConn.ConnID, clientConn.IP)
 							// 关闭连接并清理
 							clientConn.Conn.Close()
 							m.Clients.Delete(connKey)
-							failedCount++
 						}
 					} else {
-						sentCount++
 						break
 					}
 				}
@@ -267,7 +452,16 @@ func (m *WebSocketManager) BroadcastToSpecific(notification *PayNotification, pa
 		return true
 	})
 
-	log.Printf("Broadcast pay notification to specific clients: orderNo=%s, amount=%s, payment='%s', categories='%s', sentCount=%d, failedCount=%d", notification.OrderNo, notification.Amount, payment, categories, sentCount, failedCount)
+	log.Printf("Broadcast pay notification to specific clients: orderNo=%s, amount=%s, payment='%s', categories='%s', matched=%d", notification.OrderNo, notification.Amount, payment, categories, matched)
+}
+
+// Stats 获取WebSocket连接指标
+func (m *WebSocketManager) Stats() WebSocketStats {
+	return WebSocketStats{
+		Connections:    m.GetConnectionCount(),
+		MaxConnections: maxConnections(),
+		Rejected:       atomic.LoadInt64(&m.rejected),
+	}
 }
 
 // GetConnectionCount 获取连接数
@@ -0,0 +1,280 @@
+package routes
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"github.com/zhifu/donation-rank/models"
+)
+
+// webSocketDialer 在内存监听器上提供/ws/pay-notify，返回连接该监听器的拨号器
+func webSocketDialer(t *testing.T, m *WebSocketManager) *websocket.Dialer {
+	t.Helper()
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: m.HandleWebSocket}
+	go server.Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+	return &websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) { return ln.Dial() }}
+}
+
+// startWebSocketServer 在内存监听器上提供/ws/pay-notify，返回连接客户端的函数
+// 连接函数在连接加入连接池后返回，query为订阅参数（如"p=1&categories=2"）
+func startWebSocketServer(t *testing.T, m *WebSocketManager) func(query string) *websocket.Conn {
+	t.Helper()
+	dialer := webSocketDialer(t, m)
+	return func(query string) *websocket.Conn {
+		t.Helper()
+		before := m.GetConnectionCount()
+		conn, _, err := dialer.Dial("ws://test/ws/pay-notify?"+query, nil)
+		if err != nil {
+			t.Fatalf("dial websocket %s: %v", query, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		for deadline := time.Now().Add(2 * time.Second); m.GetConnectionCount() <= before; {
+			if time.Now().After(deadline) {
+				t.Fatalf("websocket %s not registered", query)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return conn
+	}
+}
+
+// readNotification 读取一条通知，超时返回false
+func readNotification(t *testing.T, conn *websocket.Conn, timeout time.Duration) (PayNotification, bool) {
+	t.Helper()
+	var notification PayNotification
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return notification, false
+	}
+	if err := json.Unmarshal(data, &notification); err != nil {
+		t.Fatalf("unmarshal notification %s: %v", data, err)
+	}
+	return notification, true
+}
+
+func TestAdminWebSocketReceivesAllScopes(t *testing.T) {
+	ar := newTestRoutes(t)
+	viper.Set("admin.token", "admin-secret")
+	t.Cleanup(func() { viper.Set("admin.token", "") })
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+	mustCreate(t, &models.PaymentConfig{ID: 2, VendorSN: "V2", TerminalSN: "T2"})
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1"})
+
+	m := NewWebSocketManager()
+	ar.wsManager = m
+	connect := startWebSocketServer(t, m)
+	tokenAdmin := connect("token=admin-secret")
+	scoped := connect("p=1&categories=1")
+
+	// 连接后发送认证消息的管理端同样接收所有通知
+	messageAdmin := connect("p=2")
+	if err := messageAdmin.WriteMessage(websocket.TextMessage, []byte(`{"type":"auth","token":"admin-secret"}`)); err != nil {
+		t.Fatalf("send auth: %v", err)
+	}
+	messageAdmin.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, reply, err := messageAdmin.ReadMessage(); err != nil || string(reply) != `{"type":"auth_ok"}` {
+		t.Fatalf("auth reply = %s, %v, want auth_ok", reply, err)
+	}
+
+	scopes := []struct{ orderNo, payment, categories string }{
+		{"ORD1", "1", "1"},
+		{"ORD2", "2", ""},
+		{"ORD3", "1", "99"},
+	}
+	for _, s := range scopes {
+		m.BroadcastToSpecific(&PayNotification{Type: "pay_success", OrderNo: s.orderNo}, s.payment, s.categories)
+	}
+
+	for name, conn := range map[string]*websocket.Conn{"token admin": tokenAdmin, "auth message admin": messageAdmin} {
+		got := make(map[string]bool)
+		for range scopes {
+			notification, ok := readNotification(t, conn, 2*time.Second)
+			if !ok {
+				break
+			}
+			got[notification.OrderNo] = true
+		}
+		if len(got) != len(scopes) {
+			t.Errorf("%s received %v, want all of ORD1, ORD2, ORD3", name, got)
+		}
+	}
+
+	// 普通连接只接收自己订阅范围的通知
+	if notification, ok := readNotification(t, scoped, 2*time.Second); !ok || notification.OrderNo != "ORD1" {
+		t.Errorf("scoped client first notification = %+v, %t, want ORD1", notification, ok)
+	}
+	if notification, ok := readNotification(t, scoped, 200*time.Millisecond); ok {
+		t.Errorf("scoped client received out-of-scope notification %+v", notification)
+	}
+}
+
+func TestWebSocketWrongAdminTokenKeepsScope(t *testing.T) {
+	newTestRoutes(t)
+	viper.Set("admin.token", "admin-secret")
+	t.Cleanup(func() { viper.Set("admin.token", "") })
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+
+	m := NewWebSocketManager()
+	connect := startWebSocketServer(t, m)
+	client := connect("p=1&token=wrong")
+
+	m.BroadcastToSpecific(&PayNotification{Type: "pay_success", OrderNo: "ORD2"}, "2", "")
+	if notification, ok := readNotification(t, client, 200*time.Millisecond); ok {
+		t.Errorf("client with wrong token received other scope notification %+v", notification)
+	}
+}
+
+// waitClosed 读取直到连接关闭，返回服务端发送的关闭码
+func waitClosed(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			return closeErr.Code
+		}
+		t.Fatalf("read until close: %v", err)
+	}
+}
+
+func TestWebSocketMessageFloodDisconnects(t *testing.T) {
+	newTestRoutes(t)
+	viper.Set("websocket.max_messages_per_second", 5)
+	t.Cleanup(func() { viper.Set("websocket.max_messages_per_second", 0) })
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+
+	m := NewWebSocketManager()
+	client := startWebSocketServer(t, m)("p=1")
+	// 突发上限为每秒上限的2倍，超过后断开连接
+	for i := 0; i < 50; i++ {
+		if err := client.WriteMessage(websocket.TextMessage, []byte("flood")); err != nil {
+			break
+		}
+	}
+	if code := waitClosed(t, client); code != websocket.ClosePolicyViolation {
+		t.Errorf("close code = %d, want %d (policy violation)", code, websocket.ClosePolicyViolation)
+	}
+	for deadline := time.Now().Add(2 * time.Second); m.GetConnectionCount() != 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection count = %d after flood, want 0", m.GetConnectionCount())
+		}
+	}
+}
+
+func TestWebSocketOversizedMessageDisconnects(t *testing.T) {
+	newTestRoutes(t)
+	viper.Set("websocket.max_message_size", 64)
+	t.Cleanup(func() { viper.Set("websocket.max_message_size", 0) })
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+
+	client := startWebSocketServer(t, NewWebSocketManager())("p=1")
+	client.WriteMessage(websocket.TextMessage, make([]byte, 1024))
+	if code := waitClosed(t, client); code != websocket.CloseMessageTooBig {
+		t.Errorf("close code = %d, want %d (message too big)", code, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestWebSocketConnectionLimit(t *testing.T) {
+	newTestRoutes(t)
+	viper.Set("websocket.max_connections", 2)
+	t.Cleanup(func() { viper.Set("websocket.max_connections", 0) })
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+
+	m := NewWebSocketManager()
+	dialer := webSocketDialer(t, m)
+	var conns []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		conn, _, err := dialer.Dial("ws://test/ws/pay-notify?p=1", nil)
+		if err != nil {
+			t.Fatalf("connection %d: %v", i+1, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conns = append(conns, conn)
+	}
+
+	// 第N+1个连接返回503
+	conn, resp, err := dialer.Dial("ws://test/ws/pay-notify?p=1", nil)
+	if err == nil {
+		conn.Close()
+		t.Fatal("connection over the limit accepted")
+	}
+	if resp == nil || resp.StatusCode != fasthttp.StatusServiceUnavailable {
+		t.Fatalf("connection over the limit response = %v, %v, want 503", resp, err)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("503 response missing Retry-After")
+	}
+	if stats := m.Stats(); stats.Rejected != 1 || stats.MaxConnections != 2 {
+		t.Errorf("stats = %+v, want 1 rejected of max 2", stats)
+	}
+
+	// 断开一个连接后释放名额
+	conns[0].Close()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		conn, _, err := dialer.Dial("ws://test/ws/pay-notify?p=1", nil)
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connection after releasing a slot: %v", err)
+		}
+	}
+	// 等待新连接加入连接池，避免测试结束时服务端仍在处理连接
+	for deadline := time.Now().Add(2 * time.Second); m.GetConnectionCount() != 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection count = %d, want 2", m.GetConnectionCount())
+		}
+	}
+}
+
+func TestWebSocketUnknownScopeRejected(t *testing.T) {
+	newTestRoutes(t)
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1"})
+	mustCreate(t, &models.PaymentConfig{ID: 2, VendorSN: "V2", TerminalSN: "T2"})
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1"})
+
+	m := NewWebSocketManager()
+	dialer := webSocketDialer(t, m)
+	for query, reason := range map[string]string{
+		"p=99":                    "unknown payment config",
+		"p=1&categories=99":       "unknown category",
+		"p=2&categories=1":        "category does not belong to payment config",
+		"payment=99&categories=1": "unknown payment config",
+	} {
+		conn, _, err := dialer.Dial("ws://test/ws/pay-notify?"+query, nil)
+		if err != nil {
+			t.Fatalf("%s: dial: %v", query, err)
+		}
+		// 先收到错误消息，再收到带原因的关闭帧
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var reply map[string]string
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("%s: read error message: %v", query, err)
+		}
+		if reply["type"] != "error" || reply["code"] != "INVALID_SCOPE" || reply["error"] != reason {
+			t.Errorf("%s: error message = %v, want INVALID_SCOPE %q", query, reply, reason)
+		}
+		_, _, err = conn.ReadMessage()
+		closeErr, ok := err.(*websocket.CloseError)
+		if !ok || closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != reason {
+			t.Errorf("%s: close = %v, want policy violation %q", query, err, reason)
+		}
+		conn.Close()
+	}
+	if count := m.GetConnectionCount(); count != 0 {
+		t.Errorf("connection count = %d, want rejected connections not registered", count)
+	}
+}
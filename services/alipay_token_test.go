@@ -0,0 +1,114 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+func TestAlipayExpiresIn(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  time.Duration
+		ok    bool
+	}{
+		{float64(7200), 2 * time.Hour, true},
+		{"7200", 2 * time.Hour, true},
+		{" 7200 ", 2 * time.Hour, true},
+		{"abc", 0, false},
+		{"", 0, false},
+		{float64(0), 0, false},
+		{"-1", 0, false},
+		{nil, 0, false},
+		{true, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := alipayExpiresIn(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("alipayExpiresIn(%#v) = %v, %t, want %v, %t", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// newAlipayGateway 模拟支付宝网关，换取和刷新token时以expiresIn原样返回expires_in
+func newAlipayGateway(t *testing.T, expiresIn string) ShouqianbaConfig {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.Form.Get("method") {
+		case "alipay.system.oauth.token":
+			w.Write([]byte(`{"alipay_system_oauth_token_response":{"access_token":"new_token","refresh_token":"new_refresh","user_id":"2088001","expires_in":` + expiresIn + `}}`))
+		case "alipay.user.info.share":
+			w.Write([]byte(`{"alipay_user_info_share_response":{"code":"10000","nick_name":"支付宝施主","avatar":"https://example.com/a.png"}}`))
+		default:
+			w.Write([]byte(`{"error_response":{"code":"40004","msg":"unknown method"}}`))
+		}
+	}))
+	t.Cleanup(gateway.Close)
+
+	return ShouqianbaConfig{
+		AlipayAppID:      "alipay_app",
+		AlipayPrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		AlipayPublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		AlipayGatewayURL: gateway.URL,
+	}
+}
+
+// assertExpiresIn 检查用户token过期时间约为现在之后的want
+func assertExpiresIn(t *testing.T, name string, want time.Duration) {
+	t.Helper()
+	var user models.AlipayUser
+	if err := utils.DB.Where("user_id = ?", "2088001").First(&user).Error; err != nil {
+		t.Fatalf("%s: load user: %v", name, err)
+	}
+	if got := time.Until(user.ExpiresAt); got < want-time.Minute || got > want {
+		t.Errorf("%s: token expires in %v, want about %v", name, got, want)
+	}
+}
+
+func TestAlipayTokenExpiresInNumericAndString(t *testing.T) {
+	for name, expiresIn := range map[string]string{
+		"numeric": `7200`,
+		"string":  `"7200"`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			setupRankingsDB(t)
+			ps := NewPaymentService(newAlipayGateway(t, expiresIn))
+
+			// 授权码换取token
+			if _, err := ps.GetAlipayUserInfoByCode("auth_code", ""); err != nil {
+				t.Fatalf("GetAlipayUserInfoByCode: %v", err)
+			}
+			assertExpiresIn(t, "by code", 2*time.Hour)
+
+			// token过期后使用refresh_token刷新
+			utils.DB.Model(&models.AlipayUser{}).Where("user_id = ?", "2088001").Update("expires_at", time.Now().Add(-time.Hour))
+			if _, err := ps.getAlipayUserInfo("2088001", ""); err != nil {
+				t.Fatalf("getAlipayUserInfo: %v", err)
+			}
+			assertExpiresIn(t, "refresh", 2*time.Hour)
+		})
+	}
+}
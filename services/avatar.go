@@ -0,0 +1,75 @@
+package services
+
+import (
+	"hash/fnv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	genderUnknown = ""
+	genderMale    = "male"
+	genderFemale  = "female"
+)
+
+// wechatGender 微信用户性别（0:未知, 1:男, 2:女）
+func wechatGender(gender int) string {
+	switch gender {
+	case 1:
+		return genderMale
+	case 2:
+		return genderFemale
+	default:
+		return genderUnknown
+	}
+}
+
+// alipayGender 支付宝用户性别（F:女, M:男, 其他视为未知）
+func alipayGender(gender string) string {
+	switch strings.ToUpper(strings.TrimSpace(gender)) {
+	case "M":
+		return genderMale
+	case "F":
+		return genderFemale
+	default:
+		return genderUnknown
+	}
+}
+
+// defaultAvatar 为没有头像的捐款人选择默认头像
+// config: display.default_avatar（通用默认头像）、display.default_avatar_male、display.default_avatar_female
+// 每项可为逗号分隔的多张图片，按用户标识固定选取其中一张；性别未知或未配置对应性别时使用通用默认头像
+func defaultAvatar(gender string, userID string) string {
+	var candidates []string
+	switch gender {
+	case genderMale:
+		candidates = avatarList("display.default_avatar_male")
+	case genderFemale:
+		candidates = avatarList("display.default_avatar_female")
+	}
+	if len(candidates) == 0 {
+		candidates = avatarList("display.default_avatar")
+	}
+	if len(candidates) == 0 {
+		return "./static/avatar.jpeg"
+	}
+	if len(candidates) == 1 || userID == "" {
+		return candidates[0]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return candidates[h.Sum32()%uint32(len(candidates))]
+}
+
+// avatarList 读取逗号分隔的头像列表，忽略空项
+func avatarList(key string) []string {
+	var list []string
+	for _, avatar := range strings.Split(viper.GetString(key), ",") {
+		if avatar = strings.TrimSpace(avatar); avatar != "" {
+			list = append(list, avatar)
+		}
+	}
+	return list
+}
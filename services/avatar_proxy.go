@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// 头像代理相关错误
+var (
+	// ErrAvatarProxyDisabled 未开启头像代理
+	ErrAvatarProxyDisabled = errors.New("avatar proxy disabled")
+	// ErrAvatarHostNotAllowed 头像地址不是http(s)或域名不在允许列表中
+	ErrAvatarHostNotAllowed = errors.New("avatar host not allowed")
+	// ErrAvatarTooLarge 头像超过大小限制
+	ErrAvatarTooLarge = errors.New("avatar too large")
+	// ErrAvatarNotImage 上游返回的不是图片
+	ErrAvatarNotImage = errors.New("avatar is not an image")
+)
+
+// 默认允许代理的头像域名（微信、支付宝头像CDN）
+var defaultAvatarHosts = []string{"qlogo.cn", "alipayobjects.com"}
+
+// AvatarImage 代理获取的头像
+type AvatarImage struct {
+	ContentType string
+	Body        []byte
+}
+
+type avatarEntry struct {
+	image     AvatarImage
+	fetchedAt time.Time
+}
+
+// avatarProxy 头像代理缓存，解决http头像在https页面的混合内容问题和防盗链导致的头像无法显示
+type avatarProxy struct {
+	mutex       sync.Mutex
+	entries     map[string]avatarEntry // key为原始头像地址
+	fetcher     *utils.SafeFetcher
+	fetcherOnce sync.Once
+}
+
+// avatarProxyEnabled 是否开启头像代理（config: avatar_proxy.enabled，默认false）
+func avatarProxyEnabled() bool {
+	return viper.GetBool("avatar_proxy.enabled")
+}
+
+// ProxiedAvatarURL 开启头像代理时将允许代理的外部头像地址改写为/api/avatar?u=...，否则原样返回
+// 本地默认头像等相对地址不改写
+func ProxiedAvatarURL(raw string) string {
+	if !avatarProxyEnabled() || raw == "" {
+		return raw
+	}
+	if _, err := parseAvatarURL(raw); err != nil {
+		return raw
+	}
+	return "/api/avatar?u=" + url.QueryEscape(raw)
+}
+
+// parseAvatarURL 校验头像地址：仅允许http(s)、默认端口、不含用户信息，且域名在允许列表中
+// config: avatar_proxy.allowed_hosts（允许的域名，包含其子域名，默认qlogo.cn、alipayobjects.com）
+func parseAvatarURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, ErrAvatarHostNotAllowed
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.User != nil || u.Port() != "" {
+		return nil, ErrAvatarHostNotAllowed
+	}
+	if !avatarHostAllowed(u.Hostname()) {
+		return nil, ErrAvatarHostNotAllowed
+	}
+	return u, nil
+}
+
+// avatarHostAllowed 域名是否在允许列表中（完全匹配或为其子域名）
+func avatarHostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || net.ParseIP(host) != nil {
+		return false
+	}
+	allowed := viper.GetStringSlice("avatar_proxy.allowed_hosts")
+	if len(allowed) == 0 {
+		allowed = defaultAvatarHosts
+	}
+	for _, h := range allowed {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" && (host == h || strings.HasSuffix(host, "."+h)) {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchAvatar 获取代理头像，缓存时间内直接返回缓存
+// config: avatar_proxy.max_bytes（头像大小上限，默认512KB）、avatar_proxy.cache_ttl（缓存时间，默认24h）、
+// avatar_proxy.cache_size（最多缓存的头像数，默认1000）
+func (ps *PaymentService) FetchAvatar(raw string) (AvatarImage, error) {
+	if !avatarProxyEnabled() {
+		return AvatarImage{}, ErrAvatarProxyDisabled
+	}
+	u, err := parseAvatarURL(raw)
+	if err != nil {
+		return AvatarImage{}, err
+	}
+
+	p := &ps.avatars
+	ttl := AvatarCacheTTL()
+	if image, ok := p.cached(raw, ttl); ok {
+		return image, nil
+	}
+
+	image, err := p.fetch(u.String())
+	if err != nil {
+		return AvatarImage{}, err
+	}
+	p.store(raw, image, ttl)
+	return image, nil
+}
+
+// AvatarCacheTTL 头像缓存时间，同时用于响应的Cache-Control
+func AvatarCacheTTL() time.Duration {
+	ttl := viper.GetDuration("avatar_proxy.cache_ttl")
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return ttl
+}
+
+// cached 读取未过期的缓存
+func (p *avatarProxy) cached(raw string, ttl time.Duration) (AvatarImage, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	entry, ok := p.entries[raw]
+	if !ok {
+		return AvatarImage{}, false
+	}
+	if time.Since(entry.fetchedAt) > ttl {
+		delete(p.entries, raw)
+		return AvatarImage{}, false
+	}
+	return entry.image, true
+}
+
+// store 写入缓存，超过上限时先清理过期条目，仍超过则淘汰最早获取的头像
+func (p *avatarProxy) store(raw string, image AvatarImage, ttl time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	size := viper.GetInt("avatar_proxy.cache_size")
+	if size <= 0 {
+		size = 1000
+	}
+	if p.entries == nil {
+		p.entries = make(map[string]avatarEntry)
+	}
+	if len(p.entries) >= size {
+		for key, entry := range p.entries {
+			if time.Since(entry.fetchedAt) > ttl {
+				delete(p.entries, key)
+			}
+		}
+	}
+	for len(p.entries) >= size {
+		var oldestKey string
+		var oldest time.Time
+		for key, entry := range p.entries {
+			if oldestKey == "" || entry.fetchedAt.Before(oldest) {
+				oldestKey, oldest = key, entry.fetchedAt
+			}
+		}
+		delete(p.entries, oldestKey)
+	}
+	p.entries[raw] = avatarEntry{image: image, fetchedAt: time.Now()}
+}
+
+// fetch 从上游获取头像，限制大小并要求返回图片
+// 通过utils.SafeFetcher请求，拒绝连接内网、回环等非公网地址；重定向目标同样需要通过域名校验
+func (p *avatarProxy) fetch(rawURL string) (AvatarImage, error) {
+	maxBytes := viper.GetInt64("avatar_proxy.max_bytes")
+	if maxBytes <= 0 {
+		maxBytes = 512 * 1024
+	}
+
+	p.fetcherOnce.Do(func() {
+		p.fetcher = &utils.SafeFetcher{
+			CheckRedirect: func(req *http.Request) error {
+				_, err := parseAvatarURL(req.URL.String())
+				return err
+			},
+		}
+	})
+	resp, err := p.fetcher.Get(rawURL, maxBytes)
+	if errors.Is(err, utils.ErrResponseTooLarge) {
+		return AvatarImage{}, ErrAvatarTooLarge
+	}
+	if err != nil {
+		return AvatarImage{}, fmt.Errorf("failed to fetch avatar: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return AvatarImage{}, fmt.Errorf("avatar upstream returned status %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return AvatarImage{}, ErrAvatarNotImage
+	}
+	return AvatarImage{ContentType: contentType, Body: resp.Body}, nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+)
+
+// setDefaultAvatars 配置通用和按性别的默认头像，测试结束后清除
+func setDefaultAvatars(t *testing.T, neutral, male, female string) {
+	t.Helper()
+	viper.Set("display.default_avatar", neutral)
+	viper.Set("display.default_avatar_male", male)
+	viper.Set("display.default_avatar_female", female)
+	t.Cleanup(func() {
+		viper.Set("display.default_avatar", "")
+		viper.Set("display.default_avatar_male", "")
+		viper.Set("display.default_avatar_female", "")
+	})
+}
+
+func TestDefaultAvatarByGender(t *testing.T) {
+	setDefaultAvatars(t, "/n.png", "/m.png", "/f.png")
+	tests := []struct {
+		gender string
+		want   string
+	}{
+		{wechatGender(1), "/m.png"},
+		{wechatGender(2), "/f.png"},
+		{wechatGender(0), "/n.png"},
+		{wechatGender(9), "/n.png"},
+		{alipayGender("M"), "/m.png"},
+		{alipayGender(" f "), "/f.png"},
+		{alipayGender("UNKNOWN"), "/n.png"},
+		{alipayGender(""), "/n.png"},
+	}
+	for _, tt := range tests {
+		if got := defaultAvatar(tt.gender, "user"); got != tt.want {
+			t.Errorf("defaultAvatar(%q) = %q, want %q", tt.gender, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultAvatarFallback(t *testing.T) {
+	// 未配置对应性别时使用通用默认头像，都未配置时使用内置头像
+	setDefaultAvatars(t, "/n.png", "", "")
+	if got := defaultAvatar(genderFemale, "user"); got != "/n.png" {
+		t.Errorf("female without female avatars = %q, want /n.png", got)
+	}
+	viper.Set("display.default_avatar", " , ")
+	if got := defaultAvatar(genderMale, "user"); got != "./static/avatar.jpeg" {
+		t.Errorf("no avatars configured = %q, want ./static/avatar.jpeg", got)
+	}
+
+	// 多张头像时按用户标识固定选取，同一用户每次相同
+	viper.Set("display.default_avatar", "/a.png, /b.png, /c.png")
+	seen := make(map[string]bool)
+	for _, userID := range []string{"u1", "u2", "u3", "u4", "u5", "u6"} {
+		got := defaultAvatar(genderUnknown, userID)
+		if got != defaultAvatar(genderUnknown, userID) {
+			t.Errorf("defaultAvatar for %s is not stable", userID)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("six users all got %v, want avatars spread across the list", seen)
+	}
+}
+
+func TestGetRankingsGenderAvatar(t *testing.T) {
+	setupRankingsDB(t)
+	setDefaultAvatars(t, "/n.png", "/m.png", "/f.png")
+	mustCreate(t, &models.WechatUser{OpenID: "wx_female", Nickname: "女施主", Gender: 2})
+	mustCreate(t, &models.WechatUser{OpenID: "wx_unknown", Nickname: "施主"})
+	mustCreate(t, &models.WechatUser{OpenID: "wx_avatar", Nickname: "有头像", Gender: 1, AvatarURL: "https://example.com/wx.png"})
+	mustCreate(t, &models.AlipayUser{UserID: "ali_male", Nickname: "男施主", Gender: "M"})
+	for i, d := range []struct{ openid, payment string }{
+		{"wx_female", "wechat"}, {"wx_unknown", "wechat"}, {"wx_avatar", "wechat"}, {"ali_male", "alipay"}, {"anonymous", "wechat"},
+	} {
+		mustCreate(t, &models.Donation{OpenID: d.openid, Payment: d.payment, Amount: float64(10 + i), OrderID: d.openid, Status: "completed"})
+	}
+
+	ps := NewPaymentService(ShouqianbaConfig{})
+	items, err := ps.GetRankings(10, 0, "", "", false)
+	if err != nil {
+		t.Fatalf("GetRankings: %v", err)
+	}
+	want := map[string]string{
+		"wx_female":  "/f.png",
+		"wx_unknown": "/n.png",
+		"wx_avatar":  "https://example.com/wx.png",
+		"ali_male":   "/m.png",
+		"anonymous":  "/n.png",
+	}
+	got := rankingsByOrder(items)
+	for orderID, avatar := range want {
+		if got[orderID].AvatarURL != avatar {
+			t.Errorf("%s avatar = %q, want %q", orderID, got[orderID].AvatarURL, avatar)
+		}
+	}
+}
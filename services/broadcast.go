@@ -0,0 +1,97 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// isBroadcasted 检查订单是否已经广播过
+func (ps *PaymentService) isBroadcasted(orderID string) bool {
+	_, ok := ps.BroadcastedOrders.Load(orderID)
+	return ok
+}
+
+// markAsBroadcasted 标记订单为已广播，超过broadcast.dedup_max_entries时立即清理
+func (ps *PaymentService) markAsBroadcasted(orderID string) {
+	ps.broadcastCleanup.Do(func() {
+		go ps.startBroadcastCleanup()
+	})
+
+	if _, loaded := ps.BroadcastedOrders.Swap(orderID, time.Now()); !loaded {
+		if atomic.AddInt64(&ps.broadcastedCount, 1) > int64(broadcastDedupMaxEntries()) {
+			go ps.cleanupBroadcasted()
+		}
+	}
+}
+
+// MarkBroadcasted 标记订单为已广播（供广播方调用）
+func (ps *PaymentService) MarkBroadcasted(orderID string) {
+	ps.markAsBroadcasted(orderID)
+}
+
+// ClearBroadcasted 清除订单的已广播标记，以便重新广播
+func (ps *PaymentService) ClearBroadcasted(orderID string) {
+	if _, loaded := ps.BroadcastedOrders.LoadAndDelete(orderID); loaded {
+		atomic.AddInt64(&ps.broadcastedCount, -1)
+	}
+}
+
+// broadcastDedupMaxEntries 已广播标记的最大条目数（config: broadcast.dedup_max_entries，默认100000）
+func broadcastDedupMaxEntries() int {
+	if n := viper.GetInt("broadcast.dedup_max_entries"); n > 0 {
+		return n
+	}
+	return 100000
+}
+
+// startBroadcastCleanup 定期清理过期的已广播标记
+func (ps *PaymentService) startBroadcastCleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ps.cleanupBroadcasted()
+	}
+}
+
+// cleanupBroadcasted 删除超过broadcast.dedup_ttl（默认24h）的标记，仍超过上限时删除最早的标记
+func (ps *PaymentService) cleanupBroadcasted() {
+	if !atomic.CompareAndSwapInt32(&ps.broadcastCleaning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&ps.broadcastCleaning, 0)
+
+	ttl := viper.GetDuration("broadcast.dedup_ttl")
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	cutoff := time.Now().Add(-ttl)
+
+	type entry struct {
+		orderID  string
+		markedAt time.Time
+	}
+	var remaining []entry
+	ps.BroadcastedOrders.Range(func(key, value interface{}) bool {
+		orderID, _ := key.(string)
+		markedAt, _ := value.(time.Time)
+		if markedAt.Before(cutoff) {
+			ps.ClearBroadcasted(orderID)
+		} else {
+			remaining = append(remaining, entry{orderID, markedAt})
+		}
+		return true
+	})
+
+	if excess := len(remaining) - broadcastDedupMaxEntries(); excess > 0 {
+		sort.Slice(remaining, func(i, j int) bool { return remaining[i].markedAt.Before(remaining[j].markedAt) })
+		for _, e := range remaining[:excess] {
+			ps.ClearBroadcasted(e.orderID)
+		}
+		log.Printf("Broadcast dedup entries exceeded limit, evicted %d oldest entries", excess)
+	}
+}
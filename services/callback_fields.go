@@ -0,0 +1,72 @@
+package services
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// 回调中订单号、金额、状态的候选字段，按顺序取第一个非空值
+var (
+	callbackOrderIDKeys = []string{"client_sn", "order_id", "out_trade_no", "transaction_id"}
+	callbackAmountKeys  = []string{"amount", "total_amount", "pay_amount"}
+	callbackStatusKeys  = []string{"status", "trade_status", "result_code"}
+)
+
+// CallbackOrderFields 从回调数据中提取订单号、金额和状态
+// 先取顶层字段，缺少时再取微信（wechat）、支付宝（alipay）嵌套对象中的order_id、amount、status
+func CallbackOrderFields(data map[string]interface{}) (orderID, amount, status string) {
+	orderID = firstCallbackField(data, callbackOrderIDKeys)
+	amount = firstCallbackField(data, callbackAmountKeys)
+	status = firstCallbackField(data, callbackStatusKeys)
+
+	for _, channel := range []string{"wechat", "alipay"} {
+		nested, ok := data[channel].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if orderID == "" {
+			orderID = coerceToString(nested["order_id"])
+		}
+		if amount == "" {
+			amount = coerceToString(nested["amount"])
+		}
+		if status == "" {
+			status = coerceToString(nested["status"])
+		}
+	}
+	return orderID, amount, status
+}
+
+// firstCallbackField 按顺序返回第一个非空字段值
+func firstCallbackField(data map[string]interface{}, keys []string) string {
+	for _, key := range keys {
+		if v := coerceToString(data[key]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// coerceToString 将回调JSON中的字段值转换为字符串
+// 网关有时以数字、有时以字符串发送金额等字段，json解码后数字为float64
+func coerceToString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		// 嵌套对象、数组等不是标量字段
+		return ""
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCallbackOrderFields(t *testing.T) {
+	tests := []struct {
+		name                    string
+		data                    map[string]interface{}
+		orderID, amount, status string
+	}{
+		{"client_sn", map[string]interface{}{"client_sn": "ORD1"}, "ORD1", "", ""},
+		{"order_id", map[string]interface{}{"order_id": "ORD1"}, "ORD1", "", ""},
+		{"out_trade_no", map[string]interface{}{"out_trade_no": "ORD1"}, "ORD1", "", ""},
+		{"transaction_id", map[string]interface{}{"transaction_id": "ORD1"}, "ORD1", "", ""},
+		{"client_sn before order_id", map[string]interface{}{"order_id": "ORD2", "client_sn": "ORD1"}, "ORD1", "", ""},
+		{"amount", map[string]interface{}{"amount": "100"}, "", "100", ""},
+		{"total_amount", map[string]interface{}{"total_amount": float64(100)}, "", "100", ""},
+		{"pay_amount", map[string]interface{}{"pay_amount": "0.01"}, "", "0.01", ""},
+		{"status", map[string]interface{}{"status": "SUCCESS"}, "", "", "SUCCESS"},
+		{"trade_status", map[string]interface{}{"trade_status": "TRADE_SUCCESS"}, "", "", "TRADE_SUCCESS"},
+		{"result_code", map[string]interface{}{"result_code": "SUCCESS"}, "", "", "SUCCESS"},
+		{"wechat nested", map[string]interface{}{"wechat": map[string]interface{}{"order_id": "ORD1", "amount": float64(100), "status": "SUCCESS"}}, "ORD1", "100", "SUCCESS"},
+		{"alipay nested", map[string]interface{}{"alipay": map[string]interface{}{"order_id": "ORD1", "amount": "1.00", "status": "TRADE_SUCCESS"}}, "ORD1", "1.00", "TRADE_SUCCESS"},
+		{"top level before nested", map[string]interface{}{"client_sn": "ORD1", "wechat": map[string]interface{}{"order_id": "ORD2"}}, "ORD1", "", ""},
+		{"empty", map[string]interface{}{}, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderID, amount, status := CallbackOrderFields(tt.data)
+			if orderID != tt.orderID || amount != tt.amount || status != tt.status {
+				t.Errorf("CallbackOrderFields() = (%q, %q, %q), want (%q, %q, %q)", orderID, amount, status, tt.orderID, tt.amount, tt.status)
+			}
+		})
+	}
+}
+
+func TestCoerceToString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"string", "1.00", "1.00"},
+		{"float integer", float64(100), "100"},
+		{"float fraction", 0.29, "0.29"},
+		{"json.Number", json.Number("2.675"), "2.675"},
+		{"int", 5, "5"},
+		{"int64", int64(5), "5"},
+		{"bool", true, "true"},
+		{"object", map[string]interface{}{"a": "b"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coerceToString(tt.in); got != tt.want {
+				t.Errorf("coerceToString(%#v) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallbackOrderFieldsNumericAmount(t *testing.T) {
+	// 网关金额字段有时为数字、有时为字符串，两种格式解析结果一致
+	for _, body := range []string{
+		`{"client_sn":"ORD1","total_amount":100,"status":"SUCCESS"}`,
+		`{"client_sn":"ORD1","total_amount":"100","status":"SUCCESS"}`,
+	} {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &data); err != nil {
+			t.Fatalf("unmarshal %s: %v", body, err)
+		}
+		if _, amount, _ := CallbackOrderFields(data); amount != "100" {
+			t.Errorf("%s: amount = %q, want 100", body, amount)
+		}
+
+		// 使用UseNumber解码时数字为json.Number
+		decoder := json.NewDecoder(strings.NewReader(body))
+		decoder.UseNumber()
+		data = nil
+		if err := decoder.Decode(&data); err != nil {
+			t.Fatalf("decode %s: %v", body, err)
+		}
+		if _, amount, _ := CallbackOrderFields(data); amount != "100" {
+			t.Errorf("%s with UseNumber: amount = %q, want 100", body, amount)
+		}
+	}
+}
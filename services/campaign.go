@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
+)
+
+// campaignStart 排行榜范围（支付配置、分类）当前活动周期的开始时间，未重置过时返回false
+// 对全部项目或全部分类的重置同样作用于其中的单个项目和分类，取最近的一次
+func campaignStart(paymentConfigID string, categoryID string) (time.Time, bool) {
+	var archive models.CampaignArchive
+	err := utils.Reader().
+		Where("payment_config_id IN ? AND category_id IN ?", []string{"", paymentConfigID}, []string{"", categoryID}).
+		Order("period_end desc").First(&archive).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Warning: Failed to load campaign period for payment=%s, category=%s: %v", paymentConfigID, categoryID, err)
+		}
+		return time.Time{}, false
+	}
+	return archive.PeriodEnd, true
+}
+
+// campaignStartsByCategory 批量获取分类当前活动周期的开始时间（用于分类概览），key为分类ID，未重置过的分类不在结果中
+// payments为各分类所属的支付配置ID
+func campaignStartsByCategory(ids []string, payments []string) map[string]time.Time {
+	starts := make(map[string]time.Time)
+	var archives []models.CampaignArchive
+	if err := utils.Reader().Where("category_id IN ?", append([]string{""}, ids...)).Find(&archives).Error; err != nil {
+		log.Printf("Warning: Failed to load campaign periods: %v", err)
+		return starts
+	}
+
+	for i, id := range ids {
+		for _, a := range archives {
+			if (a.CategoryID != "" && a.CategoryID != id) || (a.PaymentConfigID != "" && a.PaymentConfigID != payments[i]) {
+				continue
+			}
+			if start, ok := starts[id]; !ok || a.PeriodEnd.After(start) {
+				starts[id] = a.PeriodEnd
+			}
+		}
+	}
+	return starts
+}
+
+// categoryPeriodScope 按分类的活动周期构建统计条件：已重置的分类只统计周期开始之后的捐款
+func categoryPeriodScope(column string, createdAtColumn string, ids []string, starts map[string]time.Time) (string, []interface{}) {
+	var plain []string
+	var conditions []string
+	var args []interface{}
+	for _, id := range ids {
+		start, ok := starts[id]
+		if !ok {
+			plain = append(plain, id)
+			continue
+		}
+		conditions = append(conditions, "("+column+" = ? AND "+createdAtColumn+" >= ?)")
+		args = append(args, id, start)
+	}
+	if len(plain) > 0 {
+		conditions = append([]string{column + " IN ?"}, conditions...)
+		args = append([]interface{}{plain}, args...)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// ResetCampaign 开始新的活动周期：将当前周期的合计归档到campaign_archives，之后排行榜只统计新周期的捐款
+// paymentConfigID、categoryID为空分别表示全部项目、全部分类；捐款记录不会删除，管理接口仍可查询和导出
+func (ps *PaymentService) ResetCampaign(paymentConfigID string, categoryID string, note string) (*models.CampaignArchive, error) {
+	paymentConfigID, err := NormalizePaymentConfigID(paymentConfigID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	archive := models.CampaignArchive{
+		PaymentConfigID: paymentConfigID,
+		CategoryID:      categoryID,
+		PeriodEnd:       now,
+		Note:            note,
+	}
+
+	query := utils.DB.Model(&models.Donation{}).Where("status = ? AND created_at < ?", "completed", now)
+	if paymentConfigID != "" {
+		query = query.Where("payment_config_id = ?", paymentConfigID)
+	}
+	if categoryID != "" {
+		query = query.Where("categories = ?", categoryID)
+	}
+	if start, ok := campaignStart(paymentConfigID, categoryID); ok {
+		archive.PeriodStart = &start
+		query = query.Where("created_at >= ?", start)
+	}
+
+	var totals struct {
+		DonationCount int64
+		DonorCount    int64
+		TotalCents    int64
+	}
+	if err := query.Select("COUNT(*) AS donation_count, " +
+		"COUNT(DISTINCT CASE WHEN openid <> 'anonymous' THEN openid END) AS donor_count, " +
+		"COALESCE(SUM(" + netAmountCentsSQL + "), 0) AS total_cents").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	archive.DonationCount = totals.DonationCount
+	archive.DonorCount = totals.DonorCount
+	archive.TotalCents = totals.TotalCents
+
+	if err := utils.DB.Create(&archive).Error; err != nil {
+		return nil, err
+	}
+	ps.invalidateRankingsCache(paymentConfigID)
+	return &archive, nil
+}
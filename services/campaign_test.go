@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestResetCampaignHidesOldDonationsFromPublicRanking(t *testing.T) {
+	setupRankingsDB(t)
+	before := time.Now().Add(-time.Hour)
+	mustCreate(t, &models.Donation{OrderID: "OLD1", Amount: 10, AmountCents: 1000, Payment: "wechat", OpenID: "wx_user", PaymentConfigID: "1", Categories: "1", Status: "completed", CreatedAt: before})
+	mustCreate(t, &models.Donation{OrderID: "OLD2", Amount: 20, AmountCents: 2000, Payment: "wechat", OpenID: "anonymous", PaymentConfigID: "1", Categories: "1", Status: "completed", CreatedAt: before})
+	// 其他项目不受重置影响
+	mustCreate(t, &models.Donation{OrderID: "OTHER", Amount: 30, AmountCents: 3000, Payment: "wechat", PaymentConfigID: "2", Categories: "1", Status: "completed", CreatedAt: before})
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	// 先读取一次，确保重置后不会返回缓存的旧排行榜
+	if items, _ := ps.GetRankings(10, 0, "1", "", false); len(items) != 2 {
+		t.Fatalf("rankings before reset = %d items, want 2", len(items))
+	}
+
+	archive, err := ps.ResetCampaign("1", "", "春节活动")
+	if err != nil {
+		t.Fatalf("ResetCampaign: %v", err)
+	}
+	if archive.DonationCount != 2 || archive.DonorCount != 1 || archive.TotalCents != 3000 {
+		t.Errorf("archive = %+v, want 2 donations, 1 donor, 3000 cents", archive)
+	}
+
+	mustCreate(t, &models.Donation{OrderID: "NEW", Amount: 5, AmountCents: 500, Payment: "wechat", PaymentConfigID: "1", Categories: "1", Status: "completed", CreatedAt: time.Now().Add(time.Second)})
+
+	items, err := ps.GetRankings(10, 0, "1", "", false)
+	if err != nil {
+		t.Fatalf("GetRankings: %v", err)
+	}
+	if len(items) != 1 || items[0].OrderID != "NEW" {
+		t.Errorf("public rankings after reset = %v, want only NEW", rankingsByOrder(items))
+	}
+	if items, _ := ps.GetRankings(10, 0, "2", "", false); len(items) != 1 {
+		t.Errorf("other config rankings after reset = %d items, want 1", len(items))
+	}
+
+	// 管理后台仍能查询到上一周期的捐款
+	donations, total, err := ps.ListDonations(DonationFilter{PaymentConfigID: "1"}, 10, 0)
+	if err != nil {
+		t.Fatalf("ListDonations: %v", err)
+	}
+	if total != 3 || len(donations) != 3 {
+		t.Errorf("admin list = %d of %d, want all 3 donations", len(donations), total)
+	}
+}
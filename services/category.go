@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// ErrCategoryRequired 未指定分类且配置为拒绝未分类捐款
+var ErrCategoryRequired = errors.New("category is required")
+
+// resolveCategoryID 按donation.uncategorized配置处理未指定分类的捐款
+// allow（默认）：保持为空；reject：返回ErrCategoryRequired；default：使用donation.default_category_id
+func resolveCategoryID(categoryID string) (string, error) {
+	categoryID = strings.TrimSpace(categoryID)
+	if categoryID != "" {
+		return categoryID, nil
+	}
+
+	switch mode := viper.GetString("donation.uncategorized"); mode {
+	case "", "allow":
+		return "", nil
+	case "reject":
+		return "", ErrCategoryRequired
+	case "default":
+		defaultID := viper.GetString("donation.default_category_id")
+		if defaultID == "" {
+			log.Printf("Warning: donation.uncategorized is default but donation.default_category_id is empty, keeping donation uncategorized")
+		}
+		return defaultID, nil
+	default:
+		log.Printf("Warning: Unknown donation.uncategorized %q, allowing uncategorized donation", mode)
+		return "", nil
+	}
+}
+
+// CategoryOverview 分类概览：分类信息、已完成捐款统计及最近一笔捐款
+type CategoryOverview struct {
+	models.Category
+	DonationCount        int64              `json:"donation_count"`
+	DonorCount           int64              `json:"donor_count"`  // 不含匿名捐款人
+	TotalAmount          float64            `json:"total_amount"` // 已扣除部分退款
+	FormattedTotalAmount string             `json:"formatted_total_amount"`
+	LatestDonation       *PublicRankingItem `json:"latest_donation"` // 没有已完成捐款时为null
+}
+
+// GetCategoryOverview 获取分类概览，payment为空时返回全部分类
+// 统计使用一次分组查询，最近一笔捐款使用一次相关子查询取每个分类最新的记录
+func (ps *PaymentService) GetCategoryOverview(payment string) ([]CategoryOverview, error) {
+	var categories []models.Category
+	query := utils.Reader().Order("id asc")
+	if payment != "" {
+		query = query.Where("payment = ?", payment)
+	}
+	if err := query.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	overviews := make([]CategoryOverview, len(categories))
+	if len(categories) == 0 {
+		return overviews, nil
+	}
+
+	ids := make([]string, len(categories))
+	payments := make([]string, len(categories))
+	for i, category := range categories {
+		ids[i] = strconv.FormatUint(uint64(category.ID), 10)
+		payments[i] = category.PaymentConfigID
+	}
+	// 重置过排行榜的分类只统计当前活动周期
+	starts := campaignStartsByCategory(ids, payments)
+	scope, scopeArgs := categoryPeriodScope("categories", "created_at", ids, starts)
+	latestScope, latestScopeArgs := categoryPeriodScope("d.categories", "d.created_at", ids, starts)
+
+	var totals []struct {
+		Categories    string
+		DonationCount int64
+		DonorCount    int64
+		TotalCents    int64
+	}
+	if err := utils.Reader().Model(&models.Donation{}).
+		Select("categories, COUNT(*) AS donation_count, "+
+			"COUNT(DISTINCT CASE WHEN openid <> 'anonymous' THEN openid END) AS donor_count, "+
+			"COALESCE(SUM("+netAmountCentsSQL+"), 0) AS total_cents").
+		Where("status = ?", "completed").
+		Where(scope, scopeArgs...).
+		Group("categories").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+
+	// 每个分类最新的已完成捐款（不存在创建时间更晚、或同一时间ID更大的记录）
+	var latest []models.Donation
+	if err := utils.Reader().Table("donations AS d").
+		Where("d.status = ?", "completed").
+		Where(latestScope, latestScopeArgs...).
+		Where("NOT EXISTS (SELECT 1 FROM donations AS n WHERE n.status = d.status AND n.categories = d.categories " +
+			"AND (n.created_at > d.created_at OR (n.created_at = d.created_at AND n.id > d.id)))").
+		Find(&latest).Error; err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(categories))
+	for i, category := range categories {
+		overviews[i] = CategoryOverview{Category: category, FormattedTotalAmount: FormatCents(0)}
+		index[ids[i]] = i
+	}
+	for _, t := range totals {
+		if i, ok := index[t.Categories]; ok {
+			overviews[i].DonationCount = t.DonationCount
+			overviews[i].DonorCount = t.DonorCount
+			overviews[i].TotalAmount = float64(t.TotalCents) / 100
+			overviews[i].FormattedTotalAmount = FormatCents(t.TotalCents)
+		}
+	}
+	for _, item := range buildRankingItems(latest) {
+		if i, ok := index[item.CategoryID]; ok {
+			public := NewPublicRankingItem(item, 1)
+			overviews[i].LatestDonation = &public
+		}
+	}
+	return overviews, nil
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// NewShouqianbaConfig 将数据库中的支付配置转换为ShouqianbaConfig，支付宝密钥统一为标准PEM格式
+func NewShouqianbaConfig(m models.PaymentConfig) ShouqianbaConfig {
+	return ShouqianbaConfig{
+		VendorSN:            m.VendorSN,
+		VendorKey:           m.VendorKey,
+		AppID:               m.AppID,
+		TerminalSN:          m.TerminalSN,
+		TerminalKey:         m.TerminalKey,
+		DeviceID:            m.DeviceID,
+		MerchantID:          m.MerchantID,
+		StoreID:             m.StoreID,
+		StoreName:           m.StoreName,
+		APIURL:              m.APIURL,
+		GatewayURL:          m.GatewayURL,
+		SuccessRedirectURL:  m.SuccessRedirectURL,
+		SubjectPrefix:       m.SubjectPrefix,
+		EnabledPayments:     m.EnabledPayments,
+		TierThresholds:      m.TierThresholds,
+		WechatAppID:         m.WechatAppID,
+		WechatAppSecret:     m.WechatAppSecret,
+		WechatMiniAppID:     m.WechatMiniAppID,
+		WechatMiniAppSecret: m.WechatMiniAppSecret,
+		AlipayAppID:         m.AlipayAppID,
+		AlipayPublicKey:     normalizeKey(m.AlipayPublicKey, "PUBLIC KEY"),
+		AlipayPrivateKey:    normalizeKey(m.AlipayPrivateKey, "PRIVATE KEY"),
+	}
+}
+
+// NormalizePaymentConfigID 校验并规范化支付配置ID（去除空白和前导零）
+// 空字符串表示使用主配置，原样返回；非正整数返回ErrInvalidPaymentConfigID
+func NormalizePaymentConfigID(paymentConfigID string) (string, error) {
+	paymentConfigID = strings.TrimSpace(paymentConfigID)
+	if paymentConfigID == "" {
+		return "", nil
+	}
+
+	id, err := strconv.ParseUint(paymentConfigID, 10, 32)
+	if err != nil || id == 0 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPaymentConfigID, paymentConfigID)
+	}
+	return strconv.FormatUint(id, 10), nil
+}
+
+// defaultMainConfigIDs 未配置payment.main_config_ids时依次尝试的主配置ID
+var defaultMainConfigIDs = []int{6, 1, 2}
+
+// LoadMainConfig 按优先级选择主支付配置：依次尝试payment.main_config_ids中的ID，都不存在时使用第一个已激活的配置
+func LoadMainConfig() (models.PaymentConfig, error) {
+	ids := defaultMainConfigIDs
+	if viper.IsSet("payment.main_config_ids") {
+		ids = viper.GetIntSlice("payment.main_config_ids")
+	}
+
+	var mainConfig models.PaymentConfig
+	for _, id := range ids {
+		if err := utils.DB.Where("id = ?", id).First(&mainConfig).Error; err == nil {
+			log.Printf("Main payment config selected: id=%d (preferred ids %v)", mainConfig.ID, ids)
+			warnIncompleteConfig(mainConfig)
+			return mainConfig, nil
+		}
+	}
+
+	if err := utils.DB.Where("is_active = ?", true).Order("id asc").First(&mainConfig).Error; err != nil {
+		return models.PaymentConfig{}, fmt.Errorf("%w: no preferred id in %v and no active config: %v", ErrPaymentConfigNotFound, ids, err)
+	}
+	log.Printf("Main payment config selected: id=%d (first active config, none of preferred ids %v found)", mainConfig.ID, ids)
+	warnIncompleteConfig(mainConfig)
+	return mainConfig, nil
+}
+
+// warnIncompleteConfig 加载主配置时提示缺少的必填项和格式错误的密钥，下单、查单和支付宝授权时会因此失败
+func warnIncompleteConfig(m models.PaymentConfig) {
+	config := NewShouqianbaConfig(m)
+	if err := validateConfig(config); err != nil {
+		log.Printf("Warning: Main payment config id=%d: %v", m.ID, err)
+	}
+	if err := validateAlipayKeys(config); err != nil {
+		log.Printf("Error: Main payment config id=%d: %v", m.ID, err)
+	}
+	if _, err := callbackPublicKey(); err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
+
+// validateConfig 校验支付配置的网关地址和终端编号，缺少时返回ErrPaymentConfigIncomplete并指明缺少的字段
+func validateConfig(config ShouqianbaConfig) error {
+	switch {
+	case config.APIURL == "":
+		return fmt.Errorf("%w: api_url is empty", ErrPaymentConfigIncomplete)
+	case config.GatewayURL == "":
+		return fmt.Errorf("%w: gateway_url is empty", ErrPaymentConfigIncomplete)
+	case config.TerminalSN == "":
+		return fmt.Errorf("%w: terminal_sn is empty", ErrPaymentConfigIncomplete)
+	}
+	return nil
+}
+
+// loadConfig 根据paymentConfigID获取对应的支付配置（优先使用缓存）
+// paymentConfigID为空时使用主配置；ID无效或配置不存在时返回错误
+func (ps *PaymentService) loadConfig(paymentConfigID string) (ShouqianbaConfig, error) {
+	paymentConfigID, err := NormalizePaymentConfigID(paymentConfigID)
+	if err != nil {
+		return ShouqianbaConfig{}, err
+	}
+	if paymentConfigID == "" {
+		return ps.Config(), nil
+	}
+
+	ps.configMutex.RLock()
+	cachedConfig, exists := ps.configCache[paymentConfigID]
+	ps.configMutex.RUnlock()
+	// 缓存配置缺少StoreName时从数据库重新加载
+	if exists && cachedConfig.StoreName != "" {
+		return cachedConfig, nil
+	}
+
+	// 同一配置同时未命中缓存时只查询一次数据库，其余请求等待结果
+	return ps.configLoads.do(paymentConfigID, func() (ShouqianbaConfig, error) {
+		var dbConfig models.PaymentConfig
+		if err := utils.Reader().Where("id = ?", paymentConfigID).First(&dbConfig).Error; err != nil {
+			return ShouqianbaConfig{}, fmt.Errorf("%w: id=%s: %v", ErrPaymentConfigNotFound, paymentConfigID, err)
+		}
+
+		config := NewShouqianbaConfig(dbConfig)
+		if err := validateConfig(config); err != nil {
+			log.Printf("Warning: Payment config %s: %v", paymentConfigID, err)
+		}
+		if err := validateAlipayKeys(config); err != nil {
+			log.Printf("Error: Payment config %s: %v", paymentConfigID, err)
+		}
+		ps.cacheConfig(paymentConfigID, config)
+		log.Printf("DEBUG: Loaded config from database for paymentConfigID=%s, terminal_sn=%s, store_name=%s", paymentConfigID, config.TerminalSN, config.StoreName)
+		return config, nil
+	})
+}
+
+// configLoadGroup 合并同一配置ID并发的数据库加载（缓存失效或冷启动时避免大量重复查询）
+type configLoadGroup struct {
+	mutex sync.Mutex
+	calls map[string]*configLoadCall
+}
+
+type configLoadCall struct {
+	wg     sync.WaitGroup
+	config ShouqianbaConfig
+	err    error
+}
+
+// do 执行id对应的加载；已有相同id的加载在进行中时等待并返回其结果
+func (g *configLoadGroup) do(id string, load func() (ShouqianbaConfig, error)) (ShouqianbaConfig, error) {
+	g.mutex.Lock()
+	if call, ok := g.calls[id]; ok {
+		g.mutex.Unlock()
+		call.wg.Wait()
+		return call.config, call.err
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*configLoadCall)
+	}
+	call := &configLoadCall{}
+	call.wg.Add(1)
+	g.calls[id] = call
+	g.mutex.Unlock()
+
+	call.config, call.err = load()
+	call.wg.Done()
+
+	g.mutex.Lock()
+	delete(g.calls, id)
+	g.mutex.Unlock()
+	return call.config, call.err
+}
+
+// resolveConfig 根据paymentConfigID获取对应的支付配置，ID无效或配置不存在时使用主配置
+// 仅用于授权、用户信息等不涉及收款归属的场景，下单和查单使用loadConfig
+func (ps *PaymentService) resolveConfig(paymentConfigID string) ShouqianbaConfig {
+	config, err := ps.loadConfig(paymentConfigID)
+	if err != nil {
+		log.Printf("Warning: %v, using default config", err)
+		return ps.Config()
+	}
+	return config
+}
+
+// cacheConfig 更新配置缓存
+func (ps *PaymentService) cacheConfig(paymentConfigID string, config ShouqianbaConfig) {
+	ps.configMutex.Lock()
+	ps.configCache[paymentConfigID] = config
+	ps.configMutex.Unlock()
+}
+
+// SignInResult 手动签到结果（终端密钥已脱敏）
+type SignInResult struct {
+	PaymentConfigID string    `json:"payment_config_id"`
+	TerminalSN      string    `json:"terminal_sn"`
+	TerminalKey     string    `json:"terminal_key"` // 脱敏后的终端密钥
+	Rotated         bool      `json:"rotated"`      // 终端密钥是否已更换
+	SignedInAt      time.Time `json:"signed_in_at"`
+}
+
+// SignInConfig 对已激活的支付配置手动签到，更换终端密钥并刷新配置缓存（用于怀疑密钥泄露时）
+func (ps *PaymentService) SignInConfig(paymentConfigID string) (*SignInResult, error) {
+	paymentConfigID, err := NormalizePaymentConfigID(paymentConfigID)
+	if err != nil {
+		return nil, err
+	}
+	if paymentConfigID == "" {
+		return nil, ErrInvalidPaymentConfigID
+	}
+
+	// 直接从主库读取，避免使用缓存或副本中的旧密钥
+	var dbConfig models.PaymentConfig
+	if err := utils.DB.Where("id = ?", paymentConfigID).First(&dbConfig).Error; err != nil {
+		return nil, fmt.Errorf("%w: id=%s: %v", ErrPaymentConfigNotFound, paymentConfigID, err)
+	}
+
+	// 使用独立的服务实例签到，不影响当前服务的主配置
+	signer := &PaymentService{config: NewShouqianbaConfig(dbConfig), httpClient: ps.httpClient}
+	// 签到内部保存失败时新密钥已在网关生效，下面仍按配置ID保存，这次保存也失败时返回错误
+	if err := signer.SignIn(); err != nil {
+		if !errors.Is(err, ErrSignInNotSaved) {
+			return nil, err
+		}
+		log.Printf("Warning: %v, saving terminal key by config id %s", err, paymentConfigID)
+	}
+
+	now := time.Now()
+	if err := utils.DB.Model(&models.PaymentConfig{}).Where("id = ?", paymentConfigID).Updates(map[string]interface{}{
+		"TerminalSN":   signer.config.TerminalSN,
+		"TerminalKey":  signer.config.TerminalKey,
+		"LastSignInAt": now,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to save terminal key: %v", err)
+	}
+	ps.cacheConfig(paymentConfigID, signer.config)
+
+	// 主配置使用同一终端时同步更新（在锁内比较和更换，请求可能同时读取主配置）
+	ps.updateConfig(func(config *ShouqianbaConfig) {
+		if config.TerminalSN == dbConfig.TerminalSN {
+			config.TerminalSN = signer.config.TerminalSN
+			config.TerminalKey = signer.config.TerminalKey
+		}
+	})
+
+	return &SignInResult{
+		PaymentConfigID: paymentConfigID,
+		TerminalSN:      signer.config.TerminalSN,
+		TerminalKey:     maskSecret(signer.config.TerminalKey),
+		Rotated:         signer.config.TerminalKey != dbConfig.TerminalKey,
+		SignedInAt:      now,
+	}, nil
+}
+
+// maskSecret 脱敏密钥，只保留首尾各4位
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", len(secret)-8) + secret[len(secret)-4:]
+}
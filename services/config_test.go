@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
+)
+
+// slowQueries 让每次查询延迟，使并发请求在第一次加载完成前都到达
+func slowQueries(t *testing.T, delay time.Duration) {
+	t.Helper()
+	if err := utils.DB.Callback().Query().Before("gorm:query").Register("test:slow_query", func(*gorm.DB) {
+		time.Sleep(delay)
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	t.Cleanup(func() { utils.DB.Callback().Query().Remove("test:slow_query") })
+}
+
+// loadConcurrently 同时发起n次loadConfig，返回各次的结果
+func loadConcurrently(ps *PaymentService, paymentConfigID string, n int) ([]ShouqianbaConfig, []error) {
+	configs := make([]ShouqianbaConfig, n)
+	errs := make([]error, n)
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			start.Wait()
+			configs[i], errs[i] = ps.loadConfig(paymentConfigID)
+		}(i)
+	}
+	start.Done()
+	done.Wait()
+	return configs, errs
+}
+
+func TestLoadConfigConcurrentMissQueriesOnce(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.PaymentConfig{ID: 2, VendorSN: "V2", TerminalSN: "T2", StoreName: "分院", APIURL: "https://api.example.com", GatewayURL: "https://gw.example.com"})
+	ps := NewPaymentService(ShouqianbaConfig{})
+	slowQueries(t, 50*time.Millisecond)
+
+	var configs []ShouqianbaConfig
+	var errs []error
+	queries := countQueries(t, func() { configs, errs = loadConcurrently(ps, "2", 50) })
+	if queries != 1 {
+		t.Errorf("concurrent loadConfig ran %d queries, want 1", queries)
+	}
+	for i := range configs {
+		if errs[i] != nil || configs[i].TerminalSN != "T2" {
+			t.Fatalf("loadConfig #%d = %+v, %v, want config 2", i, configs[i], errs[i])
+		}
+	}
+
+	// 之后的请求命中缓存，不再查询；等价的ID（前导零）共用缓存
+	if queries := countQueries(t, func() { loadConcurrently(ps, "002", 10) }); queries != 0 {
+		t.Errorf("cached loadConfig ran %d queries, want 0", queries)
+	}
+}
+
+func TestLoadConfigConcurrentMissingConfig(t *testing.T) {
+	setupRankingsDB(t)
+	ps := NewPaymentService(ShouqianbaConfig{})
+	slowQueries(t, 50*time.Millisecond)
+
+	var errs []error
+	queries := countQueries(t, func() { _, errs = loadConcurrently(ps, "9", 20) })
+	if queries != 1 {
+		t.Errorf("concurrent loadConfig of missing config ran %d queries, want 1", queries)
+	}
+	for i, err := range errs {
+		if !errors.Is(err, ErrPaymentConfigNotFound) {
+			t.Fatalf("loadConfig #%d error = %v, want ErrPaymentConfigNotFound", i, err)
+		}
+	}
+
+	// 错误结果不缓存，配置创建后可以加载
+	mustCreate(t, &models.PaymentConfig{ID: 9, VendorSN: "V9", TerminalSN: "T9", StoreName: "新院"})
+	if config, err := ps.loadConfig("9"); err != nil || config.TerminalSN != "T9" {
+		t.Errorf("loadConfig after create = %+v, %v, want config 9", config, err)
+	}
+}
+
+func TestConfigLoadGroupSharesInFlightLoad(t *testing.T) {
+	var g configLoadGroup
+	var loads int32
+	release := make(chan struct{})
+	load := func() (ShouqianbaConfig, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return ShouqianbaConfig{TerminalSN: "T1"}, nil
+	}
+
+	results := make(chan ShouqianbaConfig, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			config, _ := g.do("1", load)
+			results <- config
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 10; i++ {
+		if config := <-results; config.TerminalSN != "T1" {
+			t.Errorf("result #%d = %+v, want shared result", i, config)
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("load ran %d times, want 1", n)
+	}
+
+	// 加载完成后再次调用重新加载
+	g.do("1", func() (ShouqianbaConfig, error) { atomic.AddInt32(&loads, 1); return ShouqianbaConfig{}, nil })
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Errorf("load after completion ran %d times in total, want 2", n)
+	}
+}
+
+func TestNormalizePaymentConfigID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+		err  bool
+	}{
+		{"", "", false},
+		{"   ", "", false},
+		{"1", "1", false},
+		{" 2 ", "2", false},
+		{"007", "7", false},
+		{"4294967295", "4294967295", false},
+		{"0", "", true},
+		{"000", "", true},
+		{"-1", "", true},
+		{"+1", "", true},
+		{"1.5", "", true},
+		{"abc", "", true},
+		{"1 OR 1=1", "", true},
+		{"1;DROP TABLE donations", "", true},
+		{"0x10", "", true},
+		{"4294967296", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePaymentConfigID(tt.id)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidPaymentConfigID) {
+				t.Errorf("NormalizePaymentConfigID(%q) = %q, %v, want ErrInvalidPaymentConfigID", tt.id, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizePaymentConfigID(%q) = %q, %v, want %q", tt.id, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigRejectsInvalidID(t *testing.T) {
+	setupRankingsDB(t)
+	ps := NewPaymentService(ShouqianbaConfig{TerminalSN: "MAIN"})
+
+	if _, err := ps.loadConfig("abc"); !errors.Is(err, ErrInvalidPaymentConfigID) {
+		t.Errorf("loadConfig(abc) error = %v, want ErrInvalidPaymentConfigID", err)
+	}
+	if config, err := ps.loadConfig(""); err != nil || config.TerminalSN != "MAIN" {
+		t.Errorf("loadConfig(\"\") = %+v, %v, want main config", config, err)
+	}
+	// 下单时无效的配置ID直接拒绝，不回退到主配置
+	if _, _, err := ps.CreateOrder(10, 0, "wechat", "example.com", "anonymous", "", "abc", ""); !errors.Is(err, ErrInvalidPaymentConfigID) {
+		t.Errorf("CreateOrder with garbage config id error = %v, want ErrInvalidPaymentConfigID", err)
+	}
+}
+
+func TestLoadMainConfigOrder(t *testing.T) {
+	t.Cleanup(func() { viper.Set("payment.main_config_ids", nil) })
+	seed := func(t *testing.T, ids ...uint) {
+		t.Helper()
+		setupRankingsDB(t)
+		for _, id := range ids {
+			mustCreate(t, &models.PaymentConfig{ID: id, VendorSN: "V" + strconv.Itoa(int(id)), TerminalSN: "T" + strconv.Itoa(int(id))})
+		}
+	}
+
+	// 按payment.main_config_ids的顺序选择第一个存在的配置
+	seed(t, 2, 3, 5)
+	viper.Set("payment.main_config_ids", []int{4, 5, 3})
+	if config, err := LoadMainConfig(); err != nil || config.ID != 5 {
+		t.Errorf("LoadMainConfig with ids [4 5 3] = id %d, %v, want 5", config.ID, err)
+	}
+
+	// 未配置时使用默认顺序6、1、2
+	viper.Set("payment.main_config_ids", nil)
+	if config, err := LoadMainConfig(); err != nil || config.ID != 2 {
+		t.Errorf("LoadMainConfig with default ids = id %d, %v, want 2", config.ID, err)
+	}
+
+	// 都不存在时使用第一个已激活的配置
+	seed(t, 7, 8, 9)
+	utils.DB.Model(&models.PaymentConfig{}).Where("id = ?", 7).Update("is_active", false)
+	viper.Set("payment.main_config_ids", []int{4})
+	if config, err := LoadMainConfig(); err != nil || config.ID != 8 {
+		t.Errorf("LoadMainConfig fallback = id %d, %v, want first active 8", config.ID, err)
+	}
+
+	// 没有已激活的配置时返回ErrPaymentConfigNotFound
+	utils.DB.Model(&models.PaymentConfig{}).Where("1 = 1").Update("is_active", false)
+	if _, err := LoadMainConfig(); !errors.Is(err, ErrPaymentConfigNotFound) {
+		t.Errorf("LoadMainConfig without active config error = %v, want ErrPaymentConfigNotFound", err)
+	}
+}
+
+func TestIncompleteConfigNamesMissingField(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.PaymentConfig{ID: 2, VendorSN: "V2", TerminalSN: "T2", GatewayURL: "https://gw.example.com"})
+	mustCreate(t, &models.PaymentConfig{ID: 3, VendorSN: "V3", TerminalSN: "T3", APIURL: "https://api.example.com"})
+	mustCreate(t, &models.PaymentConfig{ID: 4, VendorSN: "V4", APIURL: "https://api.example.com", GatewayURL: "https://gw.example.com"})
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	for id, field := range map[string]string{"2": "api_url", "3": "gateway_url", "4": "terminal_sn"} {
+		_, payURL, err := ps.CreateOrder(10, 0, "wechat", "example.com", "anonymous", "", id, "")
+		if !errors.Is(err, ErrPaymentConfigIncomplete) || !strings.Contains(err.Error(), field) {
+			t.Errorf("CreateOrder with config %s = %q, %v, want ErrPaymentConfigIncomplete naming %s", id, payURL, err, field)
+		}
+	}
+	var count int64
+	utils.DB.Model(&models.Donation{}).Count(&count)
+	if count != 0 {
+		t.Errorf("created %d donations with incomplete configs, want 0", count)
+	}
+
+	// 查询订单时同样校验，不请求空的网关地址
+	mustCreate(t, &models.Donation{OrderID: "O1", PaymentConfigID: "3", Status: "pending"})
+	if _, err := ps.QueryOrder("O1"); !errors.Is(err, ErrPaymentConfigIncomplete) || !strings.Contains(err.Error(), "gateway_url") {
+		t.Errorf("QueryOrder with config 3 error = %v, want ErrPaymentConfigIncomplete naming gateway_url", err)
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
+)
+
+// DonationCorrection 管理员更正捐款记录，字段为nil表示不修改
+// 金额和状态不允许通过更正修改（分别走退款和对账流程）
+type DonationCorrection struct {
+	CategoryID *string `json:"category_id"`
+	Blessing   *string `json:"blessing"`
+	OpenID     *string `json:"openid"` // 重新关联捐款人，"anonymous"表示改为匿名
+}
+
+// CorrectDonation 更正捐款记录的分类、祝福语或捐款人，并写入修改日志
+// 修改后清除受影响范围（原分类和新分类）的排行榜缓存
+func (ps *PaymentService) CorrectDonation(orderID string, correction DonationCorrection, operator string) (*models.Donation, error) {
+	var donation models.Donation
+	changes := make(map[string]map[string]interface{})
+
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("order_id = ?", orderID).First(&donation).Error; err != nil {
+			return err
+		}
+
+		updates := make(map[string]interface{})
+		if correction.CategoryID != nil {
+			categoryID := strings.TrimSpace(*correction.CategoryID)
+			if categoryID != "" {
+				var count int64
+				if err := tx.Model(&models.Category{}).Where("id = ?", categoryID).Count(&count).Error; err != nil {
+					return err
+				}
+				if count == 0 {
+					return fmt.Errorf("category %s not found", categoryID)
+				}
+			}
+			if categoryID != donation.Categories {
+				updates["Categories"] = categoryID
+				changes["category_id"] = map[string]interface{}{"from": donation.Categories, "to": categoryID}
+			}
+		}
+		if correction.Blessing != nil {
+			blessing := strings.TrimSpace(*correction.Blessing)
+			if len([]rune(blessing)) > 200 {
+				return fmt.Errorf("blessing too long")
+			}
+			if blessing != donation.Blessing {
+				// 管理员更正的祝福语视为已审核
+				updates["Blessing"] = blessing
+				updates["BlessingApproved"] = true
+				changes["blessing"] = map[string]interface{}{"from": donation.Blessing, "to": blessing}
+			}
+		}
+		if correction.OpenID != nil {
+			openid := strings.TrimSpace(*correction.OpenID)
+			if openid == "" {
+				openid = "anonymous"
+			}
+			if openid != "anonymous" {
+				if err := checkDonorExists(tx, donation.Payment, openid); err != nil {
+					return err
+				}
+			}
+			if openid != donation.OpenID {
+				updates["OpenID"] = openid
+				changes["openid"] = map[string]interface{}{"from": donation.OpenID, "to": openid}
+			}
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&donation).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		changesJSON, _ := json.Marshal(changes)
+		return tx.Create(&models.DonationAuditLog{
+			OrderID:  orderID,
+			Action:   "edit",
+			Changes:  string(changesJSON),
+			Operator: operator,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(changes) > 0 {
+		ps.invalidateRankingsCache(donation.PaymentConfigID)
+	}
+	return &donation, nil
+}
+
+// checkDonorExists 检查捐款人是否存在于对应支付方式的用户表中
+func checkDonorExists(tx *gorm.DB, payment, openid string) error {
+	var count int64
+	var err error
+	switch payment {
+	case "wechat":
+		err = tx.Model(&models.WechatUser{}).Where("open_id = ?", openid).Count(&count).Error
+	case "alipay":
+		err = tx.Model(&models.AlipayUser{}).Where("user_id = ?", openid).Count(&count).Error
+	default:
+		return fmt.Errorf("unsupported payment type: %s", payment)
+	}
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s user %s not found", payment, openid)
+	}
+	return nil
+}
+
+// invalidateRankingsCache 清除支付配置下的排行榜缓存和最新捐款缓存，paymentConfigID为空时清除全部
+func (ps *PaymentService) invalidateRankingsCache(paymentConfigID string) {
+	ps.cacheMutex.Lock()
+	defer ps.cacheMutex.Unlock()
+
+	for key := range ps.rankingsCache {
+		// 缓存key格式：paymentConfigID_categoryID_limit_offset，未按配置过滤的缓存同样受影响
+		if paymentConfigID == "" || strings.HasPrefix(key, paymentConfigID+"_") || strings.HasPrefix(key, "_") {
+			delete(ps.rankingsCache, key)
+		}
+	}
+	ps.latestDonationCache = nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+func TestCorrectDonationCategoryMovesBetweenLeaderboards(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1", Payment: "1"})
+	mustCreate(t, &models.Category{ID: 2, Name: "放生", PaymentConfigID: "1", Payment: "1"})
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, AmountCents: 1000, Payment: "wechat", OpenID: "anonymous", PaymentConfigID: "1", Categories: "1", Status: "completed"})
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	orders := func(categoryID string) []string {
+		t.Helper()
+		items, err := ps.GetRankings(10, 0, "1", categoryID, false)
+		if err != nil {
+			t.Fatalf("GetRankings(%s): %v", categoryID, err)
+		}
+		ids := []string{}
+		for _, item := range items {
+			ids = append(ids, item.OrderID)
+		}
+		return ids
+	}
+	totals := func() map[string]float64 {
+		t.Helper()
+		overviews, err := ps.GetCategoryOverview("1")
+		if err != nil {
+			t.Fatalf("GetCategoryOverview: %v", err)
+		}
+		m := make(map[string]float64)
+		for _, o := range overviews {
+			m[o.Name] = o.TotalAmount
+		}
+		return m
+	}
+
+	// 先读取一次，确保更正后不会返回缓存的旧排行榜
+	if got := orders("1"); len(got) != 1 {
+		t.Fatalf("category 1 before correction = %v, want [ORD1]", got)
+	}
+	if got := orders("2"); len(got) != 0 {
+		t.Fatalf("category 2 before correction = %v, want empty", got)
+	}
+
+	categoryID := "2"
+	if _, err := ps.CorrectDonation("ORD1", DonationCorrection{CategoryID: &categoryID}, "admin"); err != nil {
+		t.Fatalf("CorrectDonation: %v", err)
+	}
+
+	if got := orders("1"); len(got) != 0 {
+		t.Errorf("category 1 after correction = %v, want empty", got)
+	}
+	if got := orders("2"); len(got) != 1 || got[0] != "ORD1" {
+		t.Errorf("category 2 after correction = %v, want [ORD1]", got)
+	}
+	if got := totals(); got["供灯"] != 0 || got["放生"] != 10 {
+		t.Errorf("category totals = %v, want 供灯 0 and 放生 10", got)
+	}
+
+	var logs []models.DonationAuditLog
+	utils.DB.Where("order_id = ?", "ORD1").Find(&logs)
+	if len(logs) != 1 || logs[0].Action != "edit" || logs[0].Operator != "admin" {
+		t.Errorf("audit logs = %+v, want one edit by admin", logs)
+	}
+}
+
+func TestCorrectDonationRejectsUnknownCategory(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, Payment: "wechat", PaymentConfigID: "1", Categories: "1", Status: "completed"})
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	categoryID := "99"
+	if _, err := ps.CorrectDonation("ORD1", DonationCorrection{CategoryID: &categoryID}, "admin"); err == nil {
+		t.Fatal("CorrectDonation to unknown category succeeded, want error")
+	}
+	var donation models.Donation
+	utils.DB.Where("order_id = ?", "ORD1").First(&donation)
+	if donation.Categories != "1" {
+		t.Errorf("categories = %s, want unchanged 1", donation.Categories)
+	}
+}
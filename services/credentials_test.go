@@ -0,0 +1,114 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zhifu/donation-rank/models"
+)
+
+// recordingTransport 记录发往微信/支付宝接口的请求并返回固定响应
+type recordingTransport struct {
+	mutex    sync.Mutex
+	requests []*url.URL
+	body     string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mutex.Lock()
+	rt.requests = append(rt.requests, req.URL)
+	rt.mutex.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(rt.body)),
+		Request:    req,
+	}, nil
+}
+
+func (rt *recordingTransport) last() *url.URL {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	if len(rt.requests) == 0 {
+		return nil
+	}
+	return rt.requests[len(rt.requests)-1]
+}
+
+// newCredentialService 主配置与配置2使用不同的公众号和支付宝应用
+func newCredentialService(t *testing.T, rt *recordingTransport) *PaymentService {
+	t.Helper()
+	setupRankingsDB(t)
+	mustCreate(t, &models.PaymentConfig{ID: 2, VendorSN: "V2", TerminalSN: "T2", StoreName: "分院",
+		WechatAppID: "wx_second", WechatAppSecret: "second_secret", AlipayAppID: "ali_second"})
+	ps := NewPaymentService(ShouqianbaConfig{StoreName: "主院",
+		WechatAppID: "wx_main", WechatAppSecret: "main_secret", AlipayAppID: "ali_main"})
+	ps.httpClient = &http.Client{Transport: rt}
+	return ps
+}
+
+func TestWechatAccessTokenUsesConfigCredentials(t *testing.T) {
+	rt := &recordingTransport{body: `{"access_token":"token","expires_in":7200}`}
+	ps := newCredentialService(t, rt)
+
+	for _, tt := range []struct{ paymentConfigID, appID, secret string }{
+		{"", "wx_main", "main_secret"},
+		{"2", "wx_second", "second_secret"},
+	} {
+		before := len(rt.requests)
+		if _, err := ps.getWechatAccessToken(tt.paymentConfigID); err != nil {
+			t.Fatalf("getWechatAccessToken(%q): %v", tt.paymentConfigID, err)
+		}
+		if len(rt.requests) != before+1 {
+			t.Fatalf("getWechatAccessToken(%q) sent %d requests, want 1 (tokens are cached per app)", tt.paymentConfigID, len(rt.requests)-before)
+		}
+		query := rt.last().Query()
+		if query.Get("appid") != tt.appID || query.Get("secret") != tt.secret {
+			t.Errorf("getWechatAccessToken(%q) requested appid=%s secret=%s, want %s/%s",
+				tt.paymentConfigID, query.Get("appid"), query.Get("secret"), tt.appID, tt.secret)
+		}
+	}
+}
+
+func TestWechatUserInfoByCodeUsesConfigCredentials(t *testing.T) {
+	// 响应缺少openid，换取授权令牌后即返回，只检查换取令牌使用的凭证
+	rt := &recordingTransport{body: `{"access_token":"token"}`}
+	ps := newCredentialService(t, rt)
+
+	if _, err := ps.GetWechatUserInfoByCode("CODE", "2"); err == nil {
+		t.Fatal("GetWechatUserInfoByCode without openid succeeded, want error")
+	}
+	query := rt.last().Query()
+	if query.Get("appid") != "wx_second" || query.Get("secret") != "second_secret" || query.Get("code") != "CODE" {
+		t.Errorf("oauth2 access_token request = %s, want config 2 credentials", rt.last())
+	}
+}
+
+func TestAuthURLsUseConfigAppIDs(t *testing.T) {
+	ps := newCredentialService(t, &recordingTransport{})
+
+	for _, tt := range []struct{ paymentConfigID, wechat, alipay string }{
+		{"", "appid=wx_main", "app_id=ali_main"},
+		{"2", "appid=wx_second", "app_id=ali_second"},
+	} {
+		wechatURL, err := ps.GetWechatAuthURLWithRedirect("example.com", "http://example.com/pay", tt.paymentConfigID)
+		if err != nil {
+			t.Fatalf("GetWechatAuthURLWithRedirect(%q): %v", tt.paymentConfigID, err)
+		}
+		if !strings.Contains(wechatURL, tt.wechat) {
+			t.Errorf("wechat auth URL for config %q = %s, want %s", tt.paymentConfigID, wechatURL, tt.wechat)
+		}
+
+		alipayURL, err := ps.GetAlipayAuthURLWithRedirect("example.com", "http://example.com/pay", tt.paymentConfigID)
+		if err != nil {
+			t.Fatalf("GetAlipayAuthURLWithRedirect(%q): %v", tt.paymentConfigID, err)
+		}
+		if !strings.Contains(alipayURL, tt.alipay) {
+			t.Errorf("alipay auth URL for config %q = %s, want %s", tt.paymentConfigID, alipayURL, tt.alipay)
+		}
+	}
+}
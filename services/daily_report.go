@@ -0,0 +1,335 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DailySummary 每日捐款汇总（仅统计已完成订单）
+type DailySummary struct {
+	Date                 string            `json:"date"`
+	TotalCents           int64             `json:"total_cents"`
+	TotalAmount          float64           `json:"total_amount"`
+	FormattedTotalAmount string            `json:"formatted_total_amount"`
+	DonationCount        int64             `json:"donation_count"`
+	TopDonor             *TopDonor         `json:"top_donor"` // 当日累计金额最高的捐款人（不含匿名），没有时为null
+	Categories           []CategorySummary `json:"categories"`
+}
+
+// TopDonor 当日累计金额最高的捐款人
+type TopDonor struct {
+	UserName        string  `json:"user_name"`
+	Amount          float64 `json:"amount"`
+	FormattedAmount string  `json:"formatted_amount"`
+	DonationCount   int64   `json:"donation_count"`
+}
+
+// CategorySummary 分类当日汇总，未分类的捐款category_id为空
+type CategorySummary struct {
+	CategoryID           string  `json:"category_id"`
+	CategoryName         string  `json:"category_name"`
+	DonationCount        int64   `json:"donation_count"`
+	TotalAmount          float64 `json:"total_amount"`
+	FormattedTotalAmount string  `json:"formatted_total_amount"`
+}
+
+// reportLocation 报告使用的时区（config: reports.timezone，如Asia/Shanghai，默认服务器本地时区）
+func reportLocation() *time.Location {
+	name := viper.GetString("reports.timezone")
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Warning: Invalid reports.timezone %q: %v, using local time", name, err)
+		return time.Local
+	}
+	return loc
+}
+
+// BuildDailySummary 计算指定日期（按reports.timezone）的捐款汇总
+func (ps *PaymentService) BuildDailySummary(date string) (*DailySummary, error) {
+	start, err := time.ParseInLocation("2006-01-02", date, reportLocation())
+	if err != nil {
+		return nil, fmt.Errorf("invalid report date %q: %v", date, err)
+	}
+	end := start.AddDate(0, 0, 1)
+	inDay := utils.Reader().Model(&models.Donation{}).
+		Where("status = ? AND created_at >= ? AND created_at < ?", "completed", start, end)
+
+	summary := &DailySummary{Date: date, Categories: []CategorySummary{}}
+
+	var totals struct {
+		TotalCents    int64
+		DonationCount int64
+	}
+	if err := inDay.Session(&gorm.Session{}).
+		Select("COALESCE(SUM(" + netAmountCentsSQL + "), 0) AS total_cents, COUNT(*) AS donation_count").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	summary.TotalCents = totals.TotalCents
+	summary.TotalAmount = float64(totals.TotalCents) / 100
+	summary.FormattedTotalAmount = FormatCents(totals.TotalCents)
+	summary.DonationCount = totals.DonationCount
+
+	var categories []struct {
+		Categories    string
+		DonationCount int64
+		TotalCents    int64
+	}
+	if err := inDay.Session(&gorm.Session{}).
+		Select("categories, COUNT(*) AS donation_count, COALESCE(SUM(" + netAmountCentsSQL + "), 0) AS total_cents").
+		Group("categories").Order("total_cents desc, categories asc").
+		Scan(&categories).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range categories {
+		item := CategorySummary{
+			CategoryID:           c.Categories,
+			DonationCount:        c.DonationCount,
+			TotalAmount:          float64(c.TotalCents) / 100,
+			FormattedTotalAmount: FormatCents(c.TotalCents),
+		}
+		if c.Categories != "" {
+			var category models.Category
+			if err := utils.Reader().Select("name").Where("id = ?", c.Categories).First(&category).Error; err == nil {
+				item.CategoryName = category.Name
+			}
+		}
+		summary.Categories = append(summary.Categories, item)
+	}
+
+	var top []struct {
+		OpenID        string `gorm:"column:openid"`
+		DonationCount int64
+		TotalCents    int64
+	}
+	if err := inDay.Session(&gorm.Session{}).
+		Select("openid, COUNT(*) AS donation_count, COALESCE(SUM("+netAmountCentsSQL+"), 0) AS total_cents").
+		Where("openid <> '' AND openid <> ?", "anonymous").
+		Group("openid").Order("total_cents desc, openid asc").Limit(1).
+		Scan(&top).Error; err != nil {
+		return nil, err
+	}
+	if len(top) > 0 {
+		// 捐款人昵称与排行榜一致，取其当日任一笔捐款关联用户表
+		var donation models.Donation
+		if err := inDay.Session(&gorm.Session{}).Where("openid = ?", top[0].OpenID).First(&donation).Error; err == nil {
+			item := buildRankingItems([]models.Donation{donation})[0]
+			summary.TopDonor = &TopDonor{
+				UserName:        item.UserName,
+				Amount:          float64(top[0].TotalCents) / 100,
+				FormattedAmount: FormatCents(top[0].TotalCents),
+				DonationCount:   top[0].DonationCount,
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+// StartDailyReports 启动每日汇总报告任务：每天在reports.time（默认00:10，按reports.timezone）生成前一天的报告，
+// 保存到daily_reports表并发送到reports.webhook_url，配置了reports.smtp.host时同时发送邮件
+func (ps *PaymentService) StartDailyReports() {
+	runAt := viper.GetString("reports.time")
+	if runAt == "" {
+		runAt = "00:10"
+	}
+	clock, err := time.Parse("15:04", runAt)
+	if err != nil {
+		log.Printf("Warning: Invalid reports.time %q: %v, daily reports disabled", runAt, err)
+		return
+	}
+
+	go func() {
+		for {
+			loc := reportLocation()
+			now := time.Now().In(loc)
+			next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			date := next.AddDate(0, 0, -1).Format("2006-01-02")
+			if _, err := ps.GenerateDailyReport(date); err != nil {
+				log.Printf("Daily report %s failed: %v", date, err)
+			}
+		}
+	}()
+	log.Printf("Daily reports scheduled at %s (%s)", runAt, reportLocation())
+}
+
+// GenerateDailyReport 生成指定日期的汇总报告并保存（同一日期重复生成时覆盖），随后发送
+func (ps *PaymentService) GenerateDailyReport(date string) (*models.DailyReport, error) {
+	summary, err := ps.BuildDailySummary(date)
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+
+	report := models.DailyReport{ReportDate: date, Summary: string(content)}
+	if err := utils.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "report_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"summary", "updated_at"}),
+	}).Create(&report).Error; err != nil {
+		return nil, fmt.Errorf("save daily report: %v", err)
+	}
+	var saved models.DailyReport
+	if err := utils.DB.Where("report_date = ?", date).First(&saved).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("Daily report %s generated: total=%d cents, donations=%d", date, summary.TotalCents, summary.DonationCount)
+
+	ps.deliverDailyReport(&saved, summary)
+	return &saved, nil
+}
+
+// deliverDailyReport 发送报告，失败时按reports.retry_attempts（默认3）重试，间隔从reports.retry_backoff（默认1m）开始翻倍
+// 发送结果记录到daily_reports表
+func (ps *PaymentService) deliverDailyReport(report *models.DailyReport, summary *DailySummary) {
+	webhookURL := viper.GetString("reports.webhook_url")
+	smtpHost := viper.GetString("reports.smtp.host")
+	if webhookURL == "" && smtpHost == "" {
+		return
+	}
+
+	attempts := viper.GetInt("reports.retry_attempts")
+	if attempts <= 0 {
+		attempts = 3
+	}
+	backoff := viper.GetDuration("reports.retry_backoff")
+	if backoff <= 0 {
+		backoff = time.Minute
+	}
+
+	var err error
+	for i := 1; i <= attempts; i++ {
+		err = nil
+		if webhookURL != "" {
+			err = ps.postReportWebhook(webhookURL, summary)
+		}
+		if err == nil && smtpHost != "" {
+			err = sendReportEmail(summary)
+		}
+		report.Attempts++
+		if err == nil {
+			break
+		}
+		log.Printf("Warning: Daily report %s delivery attempt %d/%d failed: %v", report.ReportDate, i, attempts, err)
+		if i < attempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	updates := map[string]interface{}{"attempts": report.Attempts}
+	if err != nil {
+		updates["delivered"] = false
+		updates["delivery_error"] = truncateSubject(err.Error(), 500)
+		log.Printf("Daily report %s delivery failed after %d attempts: %v", report.ReportDate, attempts, err)
+	} else {
+		now := time.Now()
+		updates["delivered"] = true
+		updates["delivery_error"] = ""
+		updates["delivered_at"] = now
+		log.Printf("Daily report %s delivered", report.ReportDate)
+	}
+	if dbErr := utils.DB.Model(&models.DailyReport{}).Where("id = ?", report.ID).Updates(updates).Error; dbErr != nil {
+		log.Printf("Warning: Failed to save daily report %s delivery status: %v", report.ReportDate, dbErr)
+	}
+}
+
+// postReportWebhook 以JSON POST报告内容：{"type":"daily_report","report":{...}}
+func (ps *PaymentService) postReportWebhook(url string, summary *DailySummary) error {
+	return postWebhook(url, map[string]interface{}{"type": "daily_report", "report": summary})
+}
+
+// postWebhook 以JSON POST到Webhook地址，非2xx状态视为失败
+func postWebhook(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := utils.SafeHTTPPost(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendReportEmail 通过SMTP发送纯文本报告
+// config: reports.smtp.host、port（默认25）、username、password、from、to（收件人列表）
+func sendReportEmail(summary *DailySummary) error {
+	host := viper.GetString("reports.smtp.host")
+	port := viper.GetInt("reports.smtp.port")
+	if port <= 0 {
+		port = 25
+	}
+	from := viper.GetString("reports.smtp.from")
+	to := viper.GetStringSlice("reports.smtp.to")
+	if from == "" || len(to) == 0 {
+		return fmt.Errorf("smtp: reports.smtp.from and reports.smtp.to are required")
+	}
+
+	var auth smtp.Auth
+	if username := viper.GetString("reports.smtp.username"); username != "" {
+		auth = smtp.PlainAuth("", username, viper.GetString("reports.smtp.password"), host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: =?UTF-8?B?%s?=\r\n", from, strings.Join(to, ", "), base64.StdEncoding.EncodeToString([]byte("捐款日报 "+summary.Date)))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&b, "日期：%s\r\n合计：%s（%d笔）\r\n", summary.Date, summary.FormattedTotalAmount, summary.DonationCount)
+	if summary.TopDonor != nil {
+		fmt.Fprintf(&b, "最高捐款人：%s %s（%d笔）\r\n", summary.TopDonor.UserName, summary.TopDonor.FormattedAmount, summary.TopDonor.DonationCount)
+	}
+	b.WriteString("\r\n分类：\r\n")
+	for _, c := range summary.Categories {
+		name := c.CategoryName
+		if name == "" {
+			name = "未分类"
+		}
+		fmt.Fprintf(&b, "  %s：%s（%d笔）\r\n", name, c.FormattedTotalAmount, c.DonationCount)
+	}
+
+	if err := smtp.SendMail(fmt.Sprintf("%s:%d", host, port), auth, from, to, []byte(b.String())); err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	return nil
+}
+
+// GetDailyReports 获取最近的汇总报告，按日期倒序
+func (ps *PaymentService) GetDailyReports(limit int) ([]models.DailyReport, error) {
+	var reports []models.DailyReport
+	err := utils.Reader().Order("report_date desc").Limit(limit).Find(&reports).Error
+	return reports, err
+}
+
+// GetDailyReport 获取指定日期的汇总报告
+func (ps *PaymentService) GetDailyReport(date string) (*models.DailyReport, error) {
+	var report models.DailyReport
+	if err := utils.Reader().Where("report_date = ?", date).First(&report).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// DonationFilter 管理后台订单列表的筛选条件，空值表示不过滤
+type DonationFilter struct {
+	Status          string
+	PaymentConfigID string
+	Payment         string // 支付方式：wechat, alipay
+	CategoryID      string
+	OpenID          string
+	From            time.Time // 创建时间下限（含）
+	To              time.Time // 创建时间上限（不含）
+}
+
+// ListDonations 按条件分页查询订单（包含待支付、失败、已退款等所有状态），返回当页订单和符合条件的总数
+func (ps *PaymentService) ListDonations(filter DonationFilter, limit int, offset int) ([]models.Donation, int64, error) {
+	query := utils.Reader().Model(&models.Donation{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.PaymentConfigID != "" {
+		query = query.Where("payment_config_id = ?", filter.PaymentConfigID)
+	}
+	if filter.Payment != "" {
+		query = query.Where("payment = ?", filter.Payment)
+	}
+	if filter.CategoryID != "" {
+		query = query.Where("categories = ?", filter.CategoryID)
+	}
+	if filter.OpenID != "" {
+		query = query.Where("openid = ?", filter.OpenID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	donations := []models.Donation{}
+	if total > int64(offset) {
+		if err := query.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&donations).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	return donations, total, nil
+}
+
+// MaxOrderRangeRows 按订单号区间查询单次最多返回的订单数
+const MaxOrderRangeRows = 5000
+
+// ListDonationsByOrderRange 查询订单号在[fromOrder, toOrder]区间内的订单（所有状态），按订单号升序
+// 订单号格式为ORD+14位时间+4位随机数，按字典序比较即按创建时间先后；导入订单（IMP前缀）不在ORD区间内
+// 超过MaxOrderRangeRows时只返回前MaxOrderRangeRows条，truncated为true
+func (ps *PaymentService) ListDonationsByOrderRange(fromOrder, toOrder string) ([]models.Donation, bool, error) {
+	if fromOrder > toOrder {
+		fromOrder, toOrder = toOrder, fromOrder
+	}
+
+	donations := []models.Donation{}
+	if err := utils.Reader().Where("order_id BETWEEN ? AND ?", fromOrder, toOrder).
+		Order("order_id asc").Limit(MaxOrderRangeRows + 1).Find(&donations).Error; err != nil {
+		return nil, false, err
+	}
+	if len(donations) > MaxOrderRangeRows {
+		return donations[:MaxOrderRangeRows], true, nil
+	}
+	return donations, false, nil
+}
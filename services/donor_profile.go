@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
+)
+
+// ErrDonorNotFound 捐款人匿名或没有已完成捐款
+var ErrDonorNotFound = errors.New("donor not found")
+
+// DonorProfile 捐款人公开资料，只包含展示所需字段，不含openid、令牌、地区等信息
+type DonorProfile struct {
+	UserName        string    `json:"user_name"`
+	AvatarURL       string    `json:"avatar_url"`
+	Payment         string    `json:"payment"` // 支付方式（wechat/alipay），用于展示支付图标
+	DonationCount   int64     `json:"donation_count"`
+	TotalAmount     float64   `json:"total_amount"` // 已扣除部分退款
+	FormattedTotal  string    `json:"formatted_total"`
+	FirstDonationAt time.Time `json:"first_donation_at"`
+	// 各分类的捐款合计，仅在请求时返回
+	Categories []DonorCategoryTotal `json:"categories,omitempty"`
+}
+
+// DonorCategoryTotal 捐款人在单个分类的捐款合计
+type DonorCategoryTotal struct {
+	CategoryID     string  `json:"category_id"`
+	CategoryName   string  `json:"category_name"`
+	DonationCount  int64   `json:"donation_count"`
+	TotalAmount    float64 `json:"total_amount"`
+	FormattedTotal string  `json:"formatted_total"`
+}
+
+// GetDonorProfile 获取捐款人（openid或支付宝user_id）的公开资料，按支付配置过滤，统计全部已完成捐款
+// 昵称、头像与排行榜一致（缺少时使用匿名施主和默认头像）；匿名或没有已完成捐款时返回ErrDonorNotFound
+// includeCategories为true时同时返回各分类的捐款合计
+func (ps *PaymentService) GetDonorProfile(openid string, paymentConfigID string, includeCategories bool) (*DonorProfile, error) {
+	if openid == "" || openid == "anonymous" {
+		return nil, ErrDonorNotFound
+	}
+
+	query := func() *gorm.DB {
+		q := utils.Reader().Model(&models.Donation{}).Where("openid = ? AND status = ?", openid, "completed")
+		if paymentConfigID != "" {
+			q = q.Where("payment_config_id = ?", paymentConfigID)
+		}
+		return q
+	}
+
+	var first models.Donation
+	if err := query().Order("created_at asc, id asc").First(&first).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDonorNotFound
+		}
+		return nil, err
+	}
+
+	var totals struct {
+		DonationCount int64
+		TotalCents    int64
+	}
+	if err := query().Select("COUNT(*) AS donation_count, COALESCE(SUM(" + netAmountCentsSQL + "), 0) AS total_cents").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+
+	// 昵称和头像复用排行榜的用户关联逻辑
+	item := buildRankingItem(first, loadRankingLookups([]models.Donation{first}))
+	total := float64(totals.TotalCents) / 100
+	profile := &DonorProfile{
+		UserName:        item.UserName,
+		AvatarURL:       ProxiedAvatarURL(item.AvatarURL),
+		Payment:         first.Payment,
+		DonationCount:   totals.DonationCount,
+		TotalAmount:     total,
+		FormattedTotal:  FormatAmount(total),
+		FirstDonationAt: first.CreatedAt,
+	}
+
+	if includeCategories {
+		categories, err := donorCategoryTotals(query())
+		if err != nil {
+			return nil, err
+		}
+		profile.Categories = categories
+	}
+	return profile, nil
+}
+
+// donorCategoryTotals 按分类汇总捐款人的捐款，按金额从高到低排序
+func donorCategoryTotals(query *gorm.DB) ([]DonorCategoryTotal, error) {
+	var rows []struct {
+		Categories    string
+		DonationCount int64
+		TotalCents    int64
+	}
+	if err := query.Select("categories, COUNT(*) AS donation_count, COALESCE(SUM(" + netAmountCentsSQL + "), 0) AS total_cents").
+		Group("categories").Order("total_cents desc, categories asc").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, row := range rows {
+		if row.Categories != "" {
+			ids = append(ids, row.Categories)
+		}
+	}
+	names := make(map[string]string)
+	if len(ids) > 0 {
+		var categories []models.Category
+		if err := utils.Reader().Where("id IN ?", ids).Find(&categories).Error; err != nil {
+			return nil, err
+		}
+		for _, c := range categories {
+			names[strconv.FormatUint(uint64(c.ID), 10)] = c.Name
+		}
+	}
+
+	totals := make([]DonorCategoryTotal, len(rows))
+	for i, row := range rows {
+		totals[i] = DonorCategoryTotal{
+			CategoryID:     row.Categories,
+			CategoryName:   names[row.Categories],
+			DonationCount:  row.DonationCount,
+			TotalAmount:    float64(row.TotalCents) / 100,
+			FormattedTotal: FormatCents(row.TotalCents),
+		}
+	}
+	return totals, nil
+}
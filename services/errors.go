@@ -0,0 +1,32 @@
+package services
+
+import "errors"
+
+// 网关调用相关的哨兵错误，调用方可通过errors.Is区分配置错误与业务失败
+var (
+	// ErrGatewayEndpointNotFound 网关返回"Not Found"，通常是API地址配置错误
+	ErrGatewayEndpointNotFound = errors.New("gateway endpoint not found")
+	// ErrGatewayNonJSON 网关返回的不是JSON（如代理或Web服务器的HTML错误页），通常是API地址配置错误或网关故障
+	ErrGatewayNonJSON = errors.New("gateway returned non-JSON response")
+	// ErrGatewayBusinessFail 网关返回的result_code不是成功状态
+	ErrGatewayBusinessFail = errors.New("gateway business failure")
+	// ErrSignInvalid 签名无效（网关拒绝我们的签名，或回调验签失败）
+	ErrSignInvalid = errors.New("invalid sign")
+	// ErrTerminalNotActivated 终端未激活（缺少终端编号或密钥），签到重试无意义
+	ErrTerminalNotActivated = errors.New("terminal not activated")
+	// ErrSignInNotSaved 签到成功、内存中已使用新密钥，但保存到数据库失败，重启后需重新签到
+	ErrSignInNotSaved = errors.New("sign-in succeeded but payment config not saved")
+)
+
+// 支付配置ID相关错误
+var (
+	// ErrInvalidPaymentConfigID 支付配置ID不是正整数
+	ErrInvalidPaymentConfigID = errors.New("invalid payment config id")
+	// ErrPaymentConfigNotFound 指定的支付配置不存在
+	ErrPaymentConfigNotFound = errors.New("payment config not found")
+	// ErrPaymentConfigIncomplete 支付配置缺少网关地址、终端编号等必填项
+	ErrPaymentConfigIncomplete = errors.New("payment config incomplete")
+)
+
+// ErrTransactionAmbiguous 同一交易号匹配到多个支付通道的订单，需要指定payment过滤
+var ErrTransactionAmbiguous = errors.New("transaction id matches multiple donations")
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// EventDonationCompleted 捐款完成事件类型
+const EventDonationCompleted = "donation.completed"
+
+// DonationEvent 发布到消息中间件的捐款事件
+type DonationEvent struct {
+	Type      string  `json:"type"`
+	OrderID   string  `json:"order_id"`
+	Amount    float64 `json:"amount"`
+	Category  string  `json:"category"`
+	Donor     string  `json:"donor"` // 捐款人openid或支付宝user_id，匿名为anonymous
+	Payment   string  `json:"payment"`
+	Timestamp int64   `json:"timestamp"` // Unix秒
+}
+
+// EventPublisher 捐款事件发布接口，供统计分析等下游系统订阅
+type EventPublisher interface {
+	Publish(event DonationEvent) error
+}
+
+// noopPublisher 未配置消息中间件时使用，丢弃所有事件
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(DonationEvent) error { return nil }
+
+// SetEventPublisher 替换事件发布器，传nil恢复为不发布
+func (ps *PaymentService) SetEventPublisher(p EventPublisher) {
+	ps.eventsOnce.Do(func() {})
+	if p == nil {
+		p = noopPublisher{}
+	}
+	ps.events = p
+}
+
+// eventPublisher 获取事件发布器，首次调用时按配置创建
+// config: events.publisher（为空不发布，可选redis）
+func (ps *PaymentService) eventPublisher() EventPublisher {
+	ps.eventsOnce.Do(func() {
+		switch publisher := viper.GetString("events.publisher"); publisher {
+		case "", "none":
+			ps.events = noopPublisher{}
+		case "redis":
+			redis := newRedisStreamPublisher()
+			ps.events = redis
+			log.Printf("Donation events will be published to redis stream %s at %s", redis.stream, redis.addr)
+		default:
+			log.Printf("Warning: Unknown events.publisher %q, donation events disabled", publisher)
+			ps.events = noopPublisher{}
+		}
+	})
+	return ps.events
+}
+
+// publishDonationCompleted 异步发布捐款完成事件，发布失败只记录日志，不影响订单处理
+// 同时检查分类累计金额是否跨过里程碑（回调、轮询、对账完成的订单都经过这里）
+func (ps *PaymentService) publishDonationCompleted(orderID string) {
+	publisher := ps.eventPublisher()
+	_, noop := publisher.(noopPublisher)
+	if noop && ps.milestoneHandler() == nil {
+		return
+	}
+
+	go func() {
+		var donation models.Donation
+		if err := utils.DB.Where("order_id = ?", orderID).First(&donation).Error; err != nil {
+			log.Printf("Warning: Failed to load order %s for donation event: %v", orderID, err)
+			return
+		}
+
+		ps.announceMilestone(donation)
+		if noop {
+			return
+		}
+
+		event := DonationEvent{
+			Type:      EventDonationCompleted,
+			OrderID:   donation.OrderID,
+			Amount:    donation.Amount,
+			Category:  donation.Categories,
+			Donor:     donation.OpenID,
+			Payment:   donation.Payment,
+			Timestamp: time.Now().Unix(),
+		}
+		if err := publisher.Publish(event); err != nil {
+			log.Printf("Warning: Failed to publish %s event for order %s: %v", event.Type, orderID, err)
+		}
+	}()
+}
+
+// redisStreamPublisher 通过XADD将事件写入Redis Stream，连接断开时下次发布自动重连
+// config: events.redis.addr（默认127.0.0.1:6379）、events.redis.password、events.redis.db、
+// events.redis.stream（默认donation_events）、events.redis.max_len（默认0，不裁剪）
+type redisStreamPublisher struct {
+	addr     string
+	password string
+	db       int
+	stream   string
+	maxLen   int
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRedisStreamPublisher() *redisStreamPublisher {
+	addr := viper.GetString("events.redis.addr")
+	if addr == "" {
+		addr = "127.0.0.1:6379"
+	}
+	stream := viper.GetString("events.redis.stream")
+	if stream == "" {
+		stream = "donation_events"
+	}
+	return &redisStreamPublisher{
+		addr:     addr,
+		password: viper.GetString("events.redis.password"),
+		db:       viper.GetInt("events.redis.db"),
+		stream:   stream,
+		maxLen:   viper.GetInt("events.redis.max_len"),
+	}
+}
+
+// Publish 写入一条Stream消息，字段与DonationEvent的JSON字段一致
+func (p *redisStreamPublisher) Publish(event DonationEvent) error {
+	args := []string{"XADD", p.stream}
+	if p.maxLen > 0 {
+		args = append(args, "MAXLEN", "~", strconv.Itoa(p.maxLen))
+	}
+	args = append(args, "*",
+		"type", event.Type,
+		"order_id", event.OrderID,
+		"amount", strconv.FormatFloat(event.Amount, 'f', 2, 64),
+		"category", event.Category,
+		"donor", event.Donor,
+		"payment", event.Payment,
+		"timestamp", strconv.FormatInt(event.Timestamp, 10),
+	)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	if _, err := p.do(args...); err != nil {
+		// 出错后丢弃连接，避免残留的响应数据错位
+		p.close()
+		return err
+	}
+	return nil
+}
+
+// connect 建立连接并完成认证和选库
+func (p *redisStreamPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.addr, 3*time.Second)
+	if err != nil {
+		return fmt.Errorf("connect redis %s failed: %v", p.addr, err)
+	}
+	p.conn = conn
+	p.reader = bufio.NewReader(conn)
+
+	if p.password != "" {
+		if _, err := p.do("AUTH", p.password); err != nil {
+			p.close()
+			return fmt.Errorf("redis auth failed: %v", err)
+		}
+	}
+	if p.db != 0 {
+		if _, err := p.do("SELECT", strconv.Itoa(p.db)); err != nil {
+			p.close()
+			return fmt.Errorf("redis select db %d failed: %v", p.db, err)
+		}
+	}
+	return nil
+}
+
+func (p *redisStreamPublisher) close() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.reader = nil
+	}
+}
+
+// do 以RESP协议发送命令并读取单行响应（XADD返回消息ID，AUTH/SELECT返回OK）
+func (p *redisStreamPublisher) do(args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	p.conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := p.conn.Write([]byte(b.String())); err != nil {
+		return "", err
+	}
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis error: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("unexpected redis reply: %s", line)
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(p.reader, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	default:
+		return "", fmt.Errorf("unexpected redis reply: %s", line)
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis 模拟Redis服务端，记录收到的命令并按命令名应答
+// dropNextXADD为true时读到下一条XADD后直接断开连接，用于测试重连
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mutex        sync.Mutex
+	commands     [][]string
+	connections  int
+	dropNextXADD bool
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{listener: listener, password: password}
+	t.Cleanup(func() { listener.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mutex.Lock()
+		f.connections++
+		f.mutex.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		args, err := readRESPCommand(reader)
+		if err != nil {
+			return
+		}
+		f.mutex.Lock()
+		f.commands = append(f.commands, args)
+		drop := args[0] == "XADD" && f.dropNextXADD
+		if drop {
+			f.dropNextXADD = false
+		}
+		f.mutex.Unlock()
+
+		switch {
+		case drop:
+			return
+		case args[0] == "AUTH":
+			if args[1] != f.password {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authed = true
+			io.WriteString(conn, "+OK\r\n")
+		case !authed:
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+		case args[0] == "SELECT":
+			io.WriteString(conn, "+OK\r\n")
+		case args[0] == "XADD":
+			id := "1700000000000-0"
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(id), id)
+		default:
+			io.WriteString(conn, "-ERR unknown command\r\n")
+		}
+	}
+}
+
+// readRESPCommand 读取一条RESP数组格式的命令
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("not an array: %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) received() ([][]string, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([][]string(nil), f.commands...), f.connections
+}
+
+func testDonationEvent() DonationEvent {
+	return DonationEvent{
+		Type:      EventDonationCompleted,
+		OrderID:   "ORD1",
+		Amount:    9.9,
+		Category:  "1",
+		Donor:     "wx user", // 含空格，按长度前缀编码
+		Payment:   "wechat",
+		Timestamp: 1700000000,
+	}
+}
+
+func TestRedisStreamPublisherXADD(t *testing.T) {
+	server := newFakeRedis(t, "")
+	p := &redisStreamPublisher{addr: server.listener.Addr().String(), stream: "donation_events", maxLen: 1000}
+
+	if err := p.Publish(testDonationEvent()); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	commands, _ := server.received()
+	want := [][]string{{"XADD", "donation_events", "MAXLEN", "~", "1000", "*",
+		"type", "donation.completed",
+		"order_id", "ORD1",
+		"amount", "9.90",
+		"category", "1",
+		"donor", "wx user",
+		"payment", "wechat",
+		"timestamp", "1700000000",
+	}}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("commands = %q, want %q", commands, want)
+	}
+}
+
+func TestRedisStreamPublisherAuthAndSelect(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	p := &redisStreamPublisher{addr: server.listener.Addr().String(), password: "secret", db: 2, stream: "events"}
+
+	if err := p.Publish(testDonationEvent()); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	commands, _ := server.received()
+	if len(commands) != 3 || !reflect.DeepEqual(commands[0], []string{"AUTH", "secret"}) ||
+		!reflect.DeepEqual(commands[1], []string{"SELECT", "2"}) || commands[2][0] != "XADD" {
+		t.Errorf("commands = %q, want AUTH, SELECT, XADD", commands)
+	}
+
+	// 密码错误时返回认证失败且不发送XADD
+	wrong := &redisStreamPublisher{addr: server.listener.Addr().String(), password: "wrong", stream: "events"}
+	err := wrong.Publish(testDonationEvent())
+	if err == nil || !strings.Contains(err.Error(), "redis auth failed") {
+		t.Errorf("Publish with wrong password = %v, want auth error", err)
+	}
+	if wrong.conn != nil {
+		t.Error("connection kept after auth failure")
+	}
+}
+
+func TestRedisStreamPublisherReconnects(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	p := &redisStreamPublisher{addr: server.listener.Addr().String(), password: "secret", stream: "events"}
+
+	if err := p.Publish(testDonationEvent()); err != nil {
+		t.Fatalf("first Publish: %v", err)
+	}
+
+	// 服务端断开连接，本次发布失败并丢弃连接
+	server.mutex.Lock()
+	server.dropNextXADD = true
+	server.mutex.Unlock()
+	if err := p.Publish(testDonationEvent()); err == nil {
+		t.Fatal("Publish on dropped connection succeeded, want error")
+	}
+	if p.conn != nil {
+		t.Error("broken connection kept after error")
+	}
+
+	// 下次发布重新连接并重新认证
+	if err := p.Publish(testDonationEvent()); err != nil {
+		t.Fatalf("Publish after reconnect: %v", err)
+	}
+	commands, connections := server.received()
+	if connections != 2 {
+		t.Errorf("connections = %d, want 2", connections)
+	}
+	var names []string
+	for _, c := range commands {
+		names = append(names, c[0])
+	}
+	if want := []string{"AUTH", "XADD", "XADD", "AUTH", "XADD"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("commands = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// donorHistory 短时缓存"已有已完成捐款"的捐款人，减少每次支付成功时的计数查询
+type donorHistory struct {
+	mutex   sync.Mutex
+	donated map[string]time.Time // key为openid，value为缓存时间
+}
+
+// IsFirstDonation 判断该订单是否为捐款人的首笔已完成捐款（用于广播中的首捐庆祝效果）
+// 匿名捐款人始终返回false；金额低于broadcast.first_donation_min_amount（默认0，不限制）时不视为首捐
+// config: broadcast.first_donation_cache_ttl（已捐款标记的缓存时间，默认10m）
+func (ps *PaymentService) IsFirstDonation(openid string, orderID string, amount float64) bool {
+	if openid == "" || openid == "anonymous" {
+		return false
+	}
+
+	ttl := viper.GetDuration("broadcast.first_donation_cache_ttl")
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	if ps.donorHistory.recent(openid, ttl) {
+		return false
+	}
+
+	var count int64
+	if err := utils.DB.Model(&models.Donation{}).
+		Where("openid = ? AND status = ? AND order_id <> ?", openid, "completed", orderID).
+		Count(&count).Error; err != nil {
+		log.Printf("Warning: Failed to count donations for %s: %v", openid, err)
+		return false
+	}
+
+	// 无论是否首捐，该捐款人此后都已有已完成捐款
+	ps.donorHistory.mark(openid, ttl)
+
+	if count > 0 {
+		return false
+	}
+	return amount >= viper.GetFloat64("broadcast.first_donation_min_amount")
+}
+
+// recent 捐款人是否在ttl内被标记为已捐款
+func (h *donorHistory) recent(openid string, ttl time.Duration) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	markedAt, ok := h.donated[openid]
+	if !ok {
+		return false
+	}
+	if time.Since(markedAt) > ttl {
+		delete(h.donated, openid)
+		return false
+	}
+	return true
+}
+
+// mark 标记捐款人已有已完成捐款，条目过多时清理已过期的标记
+func (h *donorHistory) mark(openid string, ttl time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.donated == nil {
+		h.donated = make(map[string]time.Time)
+	}
+	if len(h.donated) >= 10000 {
+		for id, markedAt := range h.donated {
+			if time.Since(markedAt) > ttl {
+				delete(h.donated, id)
+			}
+		}
+	}
+	h.donated[openid] = time.Now()
+}
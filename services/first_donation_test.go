@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestIsFirstDonation(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Donation{OpenID: "donor_old", OrderID: "O1", Amount: 10, Status: "completed"})
+	mustCreate(t, &models.Donation{OpenID: "donor_old", OrderID: "O2", Amount: 10, Status: "completed"})
+	mustCreate(t, &models.Donation{OpenID: "donor_new", OrderID: "O3", Amount: 10, Status: "completed"})
+	// 未完成的订单不算已捐款
+	mustCreate(t, &models.Donation{OpenID: "donor_new", OrderID: "O0", Amount: 10, Status: "failed"})
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	if !ps.IsFirstDonation("donor_new", "O3", 10) {
+		t.Error("first completed donation not flagged, want first")
+	}
+	if ps.IsFirstDonation("donor_old", "O2", 10) {
+		t.Error("repeat donor flagged, want not first")
+	}
+
+	// 首捐后同一捐款人的下一笔捐款不再是首捐（命中缓存，不查询）
+	mustCreate(t, &models.Donation{OpenID: "donor_new", OrderID: "O4", Amount: 10, Status: "completed"})
+	if queries := countQueries(t, func() {
+		if ps.IsFirstDonation("donor_new", "O4", 10) {
+			t.Error("second donation flagged, want not first")
+		}
+	}); queries != 0 {
+		t.Errorf("cached repeat donor ran %d queries, want 0", queries)
+	}
+
+	// 匿名捐款人不判断首捐，也不查询
+	mustCreate(t, &models.Donation{OpenID: "anonymous", OrderID: "O5", Amount: 10, Status: "completed"})
+	if queries := countQueries(t, func() {
+		for _, openid := range []string{"anonymous", ""} {
+			if ps.IsFirstDonation(openid, "O5", 10) {
+				t.Errorf("IsFirstDonation(%q) = true, want false", openid)
+			}
+		}
+	}); queries != 0 {
+		t.Errorf("anonymous donor ran %d queries, want 0", queries)
+	}
+}
+
+func TestIsFirstDonationMinAmount(t *testing.T) {
+	setupRankingsDB(t)
+	viper.Set("broadcast.first_donation_min_amount", 5)
+	t.Cleanup(func() { viper.Set("broadcast.first_donation_min_amount", 0) })
+	mustCreate(t, &models.Donation{OpenID: "donor_small", OrderID: "O1", Amount: 1, Status: "completed"})
+	mustCreate(t, &models.Donation{OpenID: "donor_big", OrderID: "O2", Amount: 5, Status: "completed"})
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	if ps.IsFirstDonation("donor_small", "O1", 1) {
+		t.Error("first donation below min amount flagged, want not first")
+	}
+	if !ps.IsFirstDonation("donor_big", "O2", 5) {
+		t.Error("first donation at min amount not flagged, want first")
+	}
+}
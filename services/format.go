@@ -0,0 +1,65 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+// FormatAmount 将金额格式化为展示用字符串（如"¥9.90"），先换算为分再格式化，避免浮点数精度问题
+// 货币符号通过display.currency_symbol配置，默认"¥"
+func FormatAmount(amount float64) string {
+	return FormatCents(ToCents(amount))
+}
+
+// ToCents 将金额（元）换算为分，四舍五入
+func ToCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// FormatCents 将金额（分）格式化为展示用字符串，合计金额统一以分计算后调用
+// display.hide_whole_cents为true时整数金额省略".00"（如¥100），带角分的金额仍保留两位小数（如¥9.90）
+func FormatCents(cents int64) string {
+	symbol := viper.GetString("display.currency_symbol")
+	if symbol == "" {
+		symbol = "¥"
+	}
+
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	if cents%100 == 0 && viper.GetBool("display.hide_whole_cents") {
+		return fmt.Sprintf("%s%s%d", sign, symbol, cents/100)
+	}
+	return fmt.Sprintf("%s%s%d.%02d", sign, symbol, cents/100, cents%100)
+}
+
+// truncateSubject 将交易概述截断到不超过maxBytes字节，不截断多字节字符
+func truncateSubject(subject string, maxBytes int) string {
+	if len(subject) <= maxBytes {
+		return subject
+	}
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(subject[end]) {
+		end--
+	}
+	return subject[:end]
+}
+
+// sanitizeGatewayText 清理写入网关参数的文本（门店名、分类名等）：去除控制字符（含换行），
+// 并去除&和=，使签名原文与URL编码前的参数值一致，避免参数被截断或注入
+func sanitizeGatewayText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '&' || r == '=' || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.TrimSpace(text)
+}
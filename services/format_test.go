@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestFormatCentsHideWholeCents(t *testing.T) {
+	tests := []struct {
+		cents     int64
+		hide      bool
+		want      string
+		wantFloat float64
+	}{
+		{10000, false, "¥100.00", 100},
+		{10000, true, "¥100", 100},
+		{990, false, "¥9.90", 9.9},
+		{990, true, "¥9.90", 9.9},
+		{1, true, "¥0.01", 0.01},
+		{0, true, "¥0", 0},
+		{0, false, "¥0.00", 0},
+		{-500, true, "-¥5", -5},
+		{-1050, true, "-¥10.50", -10.5},
+	}
+	t.Cleanup(func() { viper.Set("display.hide_whole_cents", false) })
+	for _, tt := range tests {
+		viper.Set("display.hide_whole_cents", tt.hide)
+		if got := FormatCents(tt.cents); got != tt.want {
+			t.Errorf("FormatCents(%d) hide_whole_cents=%t = %q, want %q", tt.cents, tt.hide, got, tt.want)
+		}
+		// 元金额先四舍五入到分再格式化
+		if got := FormatAmount(tt.wantFloat); got != tt.want {
+			t.Errorf("FormatAmount(%v) hide_whole_cents=%t = %q, want %q", tt.wantFloat, tt.hide, got, tt.want)
+		}
+	}
+}
+
+func TestFormatAmountRounding(t *testing.T) {
+	viper.Set("display.hide_whole_cents", true)
+	t.Cleanup(func() { viper.Set("display.hide_whole_cents", false) })
+
+	// 浮点误差不应让整数金额显示出角分，也不应让9.90显示为整数
+	for amount, want := range map[float64]string{
+		99.999999: "¥100",
+		100.004:   "¥100",
+		9.899999:  "¥9.90",
+		0.1 + 0.2: "¥0.30",
+	} {
+		if got := FormatAmount(amount); got != want {
+			t.Errorf("FormatAmount(%v) = %q, want %q", amount, got, want)
+		}
+	}
+}
+
+func TestFormatCentsCurrencySymbol(t *testing.T) {
+	viper.Set("display.currency_symbol", "RMB ")
+	t.Cleanup(func() { viper.Set("display.currency_symbol", "") })
+	if got := FormatCents(12345); got != "RMB 123.45" {
+		t.Errorf("FormatCents with custom symbol = %q, want RMB 123.45", got)
+	}
+}
+
+func TestTruncateSubject(t *testing.T) {
+	tests := []struct {
+		subject  string
+		maxBytes int
+		want     string
+	}{
+		{"捐款", 50, "捐款"},
+		{"abcdef", 4, "abcd"},
+		// 截断位置在多字节字符中间时退回到字符起始处
+		{"捐款-本院", 4, "捐"},
+		{"捐款-本院", 5, "捐"},
+		{"捐款-本院", 6, "捐款"},
+		{"a捐款", 3, "a"},
+	}
+	for _, tt := range tests {
+		if got := truncateSubject(tt.subject, tt.maxBytes); got != tt.want {
+			t.Errorf("truncateSubject(%q, %d) = %q, want %q", tt.subject, tt.maxBytes, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newGateway 模拟网关，每个请求返回固定的状态码、Content-Type和响应体
+func newGateway(t *testing.T, status int, contentType, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCallUpayGatewayErrors(t *testing.T) {
+	htmlPage := "<html>\n<head><title>502 Bad Gateway</title></head>\n<body>" + strings.Repeat("<p>nginx</p>\n", 100) + "</body>\n</html>"
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        error
+	}{
+		{"html error page", http.StatusBadGateway, "text/html", htmlPage, ErrGatewayNonJSON},
+		{"html without content type", http.StatusOK, "", "  <!DOCTYPE html><html></html>", ErrGatewayNonJSON},
+		{"html content type", http.StatusOK, "text/html; charset=utf-8", "Service Unavailable", ErrGatewayNonJSON},
+		{"plain text", http.StatusOK, "text/plain", "upstream timeout", ErrGatewayNonJSON},
+		{"endpoint not found", http.StatusNotFound, "application/json", `{"message":"Not Found"}`, ErrGatewayEndpointNotFound},
+		{"illegal sign", http.StatusOK, "application/json", `{"result_code":"400","error_code":"ILLEGAL_SIGN","error_message":"签名错误"}`, ErrSignInvalid},
+		{"business failure", http.StatusOK, "application/json", `{"result_code":"400","error_message":"终端未激活"}`, ErrGatewayBusinessFail},
+		{"success", http.StatusOK, "application/json", `{"result_code":"200","biz_response":{}}`, nil},
+	}
+	ps := NewPaymentService(ShouqianbaConfig{})
+	for _, tt := range tests {
+		gateway := newGateway(t, tt.status, tt.contentType, tt.body)
+		result, err := ps.callUpay("Test", gateway.URL, "/upay/v2/query", "T1", "key", map[string]interface{}{"terminal_sn": "T1"})
+		if tt.want == nil {
+			if err != nil || result["result_code"] != "200" {
+				t.Errorf("%s: callUpay = %v, %v, want success", tt.name, result, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: callUpay error = %v, want %v", tt.name, err, tt.want)
+		}
+		// HTML错误页只保留开头部分
+		if errors.Is(err, ErrGatewayNonJSON) && len(err.Error()) > 400 {
+			t.Errorf("%s: error message is %d bytes, want a short snippet", tt.name, len(err.Error()))
+		}
+	}
+}
+
+func TestResponseSnippet(t *testing.T) {
+	if got := responseSnippet([]byte("  <html>\n\t<body> error </body>  ")); got != "<html> <body> error </body>" {
+		t.Errorf("responseSnippet = %q, want whitespace collapsed", got)
+	}
+	// 截断时不切断多字节字符
+	long := []byte(strings.Repeat("错", 100))
+	got := responseSnippet(long)
+	if !strings.HasSuffix(got, "...") || len(got) > 203 || !strings.HasPrefix(string(long), strings.TrimSuffix(got, "...")) {
+		t.Errorf("responseSnippet(long) = %q, want valid UTF-8 prefix of at most 200 bytes", got)
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// ErrUntrustedHost 请求的Host不在允许列表中
+var ErrUntrustedHost = errors.New("untrusted host")
+
+// publicHost 获取构建回调和跳转地址使用的主机名，防止伪造Host头把支付回调指向其他服务器
+// 配置了server.public_host时始终使用该值；否则校验请求Host的格式，并在配置了server.allowed_hosts时要求在列表中
+func publicHost(host string) (string, error) {
+	if configured := viper.GetString("server.public_host"); configured != "" {
+		return configured, nil
+	}
+
+	if !utils.IsValidHost(host) {
+		return "", fmt.Errorf("%w: %q", ErrUntrustedHost, host)
+	}
+
+	allowed := viper.GetStringSlice("server.allowed_hosts")
+	if len(allowed) == 0 {
+		return host, nil
+	}
+	for _, h := range allowed {
+		if strings.EqualFold(h, host) {
+			return host, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUntrustedHost, host)
+}
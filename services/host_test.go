@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPublicHost(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Set("server.public_host", "")
+		viper.Set("server.allowed_hosts", nil)
+	})
+	tests := []struct {
+		publicHost string
+		allowed    []string
+		host       string
+		want       string
+		err        bool
+	}{
+		// 配置了公开主机名时始终使用配置值，忽略请求中的Host
+		{"pay.example.com", nil, "evil.example.net", "pay.example.com", false},
+		{"pay.example.com", nil, "evil.example.net/api?x=", "pay.example.com", false},
+		{"", nil, "example.com:8080", "example.com:8080", false},
+		{"", nil, "evil.example.net/steal", "", true},
+		{"", nil, "user@evil.example.net", "", true},
+		{"", nil, "", "", true},
+		{"", []string{"Example.com"}, "example.com", "example.com", false},
+		{"", []string{"example.com"}, "evil.example.net", "", true},
+	}
+	for _, tt := range tests {
+		viper.Set("server.public_host", tt.publicHost)
+		viper.Set("server.allowed_hosts", tt.allowed)
+		got, err := publicHost(tt.host)
+		if tt.err {
+			if !errors.Is(err, ErrUntrustedHost) {
+				t.Errorf("publicHost(%q) = %q, %v, want ErrUntrustedHost", tt.host, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("publicHost(%q) public_host=%q = %q, %v, want %q", tt.host, tt.publicHost, got, err, tt.want)
+		}
+	}
+}
+
+func TestCreateOrderReplacesForgedHost(t *testing.T) {
+	ps := newOrderService(t, ShouqianbaConfig{})
+	viper.Set("server.public_host", "pay.example.com")
+	t.Cleanup(func() { viper.Set("server.public_host", "") })
+
+	_, payURL, err := ps.CreateOrder(10, 0, "wechat", "evil.example.net", "anonymous", "", "", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	params := orderParams(t, payURL)
+	if got := params.Get("notify_url"); got != "http://pay.example.com/api/callback" {
+		t.Errorf("notify_url = %q, want configured public host", got)
+	}
+	if got := params.Get("return_url"); got != "http://pay.example.com" {
+		t.Errorf("return_url = %q, want configured public host", got)
+	}
+}
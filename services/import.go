@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
+)
+
+// ImportDonation 历史捐款导入记录
+type ImportDonation struct {
+	ExternalID      string  `json:"external_id"` // 原系统中的订单ID，用于去重
+	Amount          float64 `json:"amount"`
+	Payment         string  `json:"payment"` // wechat, alipay
+	PaymentConfigID string  `json:"payment_config_id"`
+	Category        string  `json:"category"`
+	DonorName       string  `json:"donor_name"` // 为空时显示为匿名施主
+	Blessing        string  `json:"blessing"`
+	CreatedAt       string  `json:"created_at"` // 格式：2006-01-02 15:04:05
+	Status          string  `json:"status"`     // 仅支持completed，为空时默认completed
+}
+
+// ImportError 导入失败的记录
+type ImportError struct {
+	Index      int    `json:"index"`
+	ExternalID string `json:"external_id"`
+	Error      string `json:"error"`
+}
+
+// ImportResult 导入结果汇总
+type ImportResult struct {
+	Inserted int           `json:"inserted"`
+	Skipped  int           `json:"skipped"` // external_id已存在的重复记录
+	Errored  int           `json:"errored"`
+	Errors   []ImportError `json:"errors"`
+}
+
+// ImportDonations 批量导入历史捐款，导入后均为已完成状态
+// 校验失败的记录跳过并报告，其余记录在同一事务中写入，数据库出错时整批回滚
+func (ps *PaymentService) ImportDonations(records []ImportDonation) (*ImportResult, error) {
+	result := &ImportResult{Errors: []ImportError{}}
+
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		seen := make(map[string]bool)
+		for i, rec := range records {
+			createdAt, err := validateImportDonation(rec)
+			if err != nil {
+				result.Errored++
+				result.Errors = append(result.Errors, ImportError{Index: i, ExternalID: rec.ExternalID, Error: err.Error()})
+				continue
+			}
+
+			// 以外部订单号去重（同一批次内和数据库中已有的记录）
+			orderID := "IMP" + rec.ExternalID
+			if seen[orderID] {
+				result.Skipped++
+				continue
+			}
+			seen[orderID] = true
+
+			var count int64
+			if err := tx.Model(&models.Donation{}).Where("order_id = ?", orderID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				result.Skipped++
+				continue
+			}
+
+			openid := "anonymous"
+			if rec.DonorName != "" {
+				openid, err = importPlaceholderUser(tx, rec.Payment, rec.DonorName)
+				if err != nil {
+					return err
+				}
+			}
+
+			donation := models.Donation{
+				OpenID:           openid,
+				Amount:           rec.Amount,
+				AmountCents:      ToCents(rec.Amount),
+				Payment:          rec.Payment,
+				PaymentConfigID:  rec.PaymentConfigID,
+				Categories:       rec.Category,
+				Blessing:         rec.Blessing,
+				BlessingApproved: true, // 历史数据视为已审核
+				OrderID:          orderID,
+				Status:           "completed",
+				CreatedAt:        createdAt,
+			}
+			if err := tx.Create(&donation).Error; err != nil {
+				return err
+			}
+			result.Inserted++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("import donations failed: %v", err)
+	}
+
+	return result, nil
+}
+
+// validateImportDonation 校验导入记录，返回解析后的创建时间
+func validateImportDonation(rec ImportDonation) (time.Time, error) {
+	if rec.ExternalID == "" {
+		return time.Time{}, fmt.Errorf("external_id is required")
+	}
+	if len(rec.ExternalID) > 47 {
+		return time.Time{}, fmt.Errorf("external_id too long")
+	}
+	if rec.Amount < 0.01 || rec.Amount > 10000 {
+		return time.Time{}, fmt.Errorf("amount must be between 0.01 and 10000")
+	}
+	if rec.Payment != "wechat" && rec.Payment != "alipay" {
+		return time.Time{}, fmt.Errorf("invalid payment type: %s", rec.Payment)
+	}
+	if rec.Status != "" && rec.Status != "completed" {
+		return time.Time{}, fmt.Errorf("unsupported status: %s", rec.Status)
+	}
+	if len([]rune(rec.Blessing)) > 200 {
+		return time.Time{}, fmt.Errorf("blessing too long")
+	}
+	if rec.CreatedAt == "" {
+		return time.Time{}, fmt.Errorf("created_at is required")
+	}
+	createdAt, err := time.ParseInLocation("2006-01-02 15:04:05", rec.CreatedAt, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid created_at: %v", err)
+	}
+	return createdAt, nil
+}
+
+// importPlaceholderUser 为导入的具名捐款人创建占位用户，同名捐款人复用同一用户
+func importPlaceholderUser(tx *gorm.DB, payment, donorName string) (string, error) {
+	hash := md5.Sum([]byte(donorName))
+	userID := "import_" + hex.EncodeToString(hash[:])
+
+	if payment == "wechat" {
+		user := models.WechatUser{OpenID: userID, Nickname: donorName}
+		if err := tx.Where("open_id = ?", userID).FirstOrCreate(&user).Error; err != nil {
+			return "", err
+		}
+	} else {
+		user := models.AlipayUser{UserID: userID, Nickname: donorName}
+		if err := tx.Where("user_id = ?", userID).FirstOrCreate(&user).Error; err != nil {
+			return "", err
+		}
+	}
+	return userID, nil
+}
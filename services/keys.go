@@ -0,0 +1,162 @@
+package services
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// ErrInvalidKey 配置中的RSA密钥格式无效
+var ErrInvalidKey = errors.New("invalid rsa key")
+
+// keyNoise 从后台或文档复制密钥时常混入的字符：BOM、零宽字符、中英文引号
+var keyNoise = strings.NewReplacer(
+	"\ufeff", "", "\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "",
+	"\u201c", "", "\u201d", "", "\u2018", "", "\u2019", "", "\"", "", "'", "", "`", "",
+)
+
+// normalizeKey 规范化配置中的密钥：去除BOM、引号和多余空白，统一为标准PEM格式（每行64字符）
+// 没有PEM标记的密钥按defaultType补全标记；空字符串原样返回
+func normalizeKey(raw string, defaultType string) string {
+	key := strings.TrimSpace(keyNoise.Replace(raw))
+	if key == "" {
+		return ""
+	}
+	key = strings.ReplaceAll(key, "\\n", "\n")
+
+	blockType := defaultType
+	if strings.HasPrefix(key, "-----BEGIN ") {
+		header := key[len("-----BEGIN "):]
+		if end := strings.Index(header, "-----"); end > 0 {
+			blockType = header[:end]
+		}
+	}
+
+	// 去除PEM标记和所有空白，只保留base64内容
+	body := key
+	for _, marker := range []string{"-----BEGIN " + blockType + "-----", "-----END " + blockType + "-----"} {
+		body = strings.ReplaceAll(body, marker, "")
+	}
+	body = strings.Join(strings.Fields(body), "")
+
+	var b strings.Builder
+	b.WriteString("-----BEGIN " + blockType + "-----\n")
+	for len(body) > 64 {
+		b.WriteString(body[:64] + "\n")
+		body = body[64:]
+	}
+	b.WriteString(body + "\n-----END " + blockType + "-----\n")
+	return b.String()
+}
+
+// decodeKeyBlock 解码规范化后的PEM密钥，错误信息指明具体问题
+func decodeKeyBlock(name string, key string) (*pem.Block, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%w: %s is empty", ErrInvalidKey, name)
+	}
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		var body strings.Builder
+		for _, line := range strings.Split(key, "\n") {
+			if !strings.HasPrefix(line, "-----") {
+				body.WriteString(strings.TrimSpace(line))
+			}
+		}
+		if _, err := base64.StdEncoding.DecodeString(body.String()); err != nil {
+			return nil, fmt.Errorf("%w: %s is not valid base64: %v", ErrInvalidKey, name, err)
+		}
+		return nil, fmt.Errorf("%w: %s is not a valid PEM block", ErrInvalidKey, name)
+	}
+	return block, nil
+}
+
+// parseRSAPrivateKey 解析RSA私钥，支持PKCS8和PKCS1格式
+func parseRSAPrivateKey(name string, key string) (*rsa.PrivateKey, error) {
+	block, err := decodeKeyBlock(name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	privKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		rsaKey, pkcs1Err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if pkcs1Err != nil {
+			return nil, fmt.Errorf("%w: %s is neither PKCS8 (%v) nor PKCS1 (%v)", ErrInvalidKey, name, err, pkcs1Err)
+		}
+		return rsaKey, nil
+	}
+	rsaKey, ok := privKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not an RSA key", ErrInvalidKey, name)
+	}
+	return rsaKey, nil
+}
+
+// parseRSAPublicKey 解析RSA公钥（PKIX格式）
+func parseRSAPublicKey(name string, key string) (*rsa.PublicKey, error) {
+	block, err := decodeKeyBlock(name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidKey, name, err)
+	}
+	rsaKey, ok := pubKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not an RSA key", ErrInvalidKey, name)
+	}
+	return rsaKey, nil
+}
+
+// defaultCallbackPublicKey 收钱吧提供的回调验签公钥
+const defaultCallbackPublicKey = `-----BEGIN PUBLIC KEY-----
+MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA5+MNqcjgw4bsSWhJfw2M
++gQB7P+pEiYOfvRmA6kt7Wisp0J3JbOtsLXGnErn5ZY2D8KkSAHtMYbeddphFZQJ
+zUbiaDi75GUAG9XS3MfoKAhvNkK15VcCd8hFgNYCZdwEjZrvx6Zu1B7c29S64LQP
+HceS0nyXF8DwMIVRcIWKy02cexgX0UmUPE0A2sJFoV19ogAHaBIhx5FkTy+eeBJE
+bU03Do97q5G9IN1O3TssvbYBAzugz+yUPww2LadaKexhJGg+5+ufoDd0+V3oFL0/
+ebkJvD0uiBzdE3/ci/tANpInHAUDIHoWZCKxhn60f3/3KiR8xuj2vASgEqphxT5O
+fwIDAQAB
+-----END PUBLIC KEY-----`
+
+var (
+	callbackKey     *rsa.PublicKey
+	callbackKeyErr  error
+	callbackKeyOnce sync.Once
+)
+
+// callbackPublicKey 回调验签公钥，首次使用时解析并缓存
+// config: callback.public_key（为空时使用收钱吧默认公钥）
+func callbackPublicKey() (*rsa.PublicKey, error) {
+	callbackKeyOnce.Do(func() {
+		key := viper.GetString("callback.public_key")
+		if strings.TrimSpace(key) == "" {
+			key = defaultCallbackPublicKey
+		}
+		callbackKey, callbackKeyErr = parseRSAPublicKey("callback.public_key", normalizeKey(key, "PUBLIC KEY"))
+	})
+	return callbackKey, callbackKeyErr
+}
+
+// validateAlipayKeys 校验支付宝应用私钥和支付宝公钥，未配置支付宝时跳过
+func validateAlipayKeys(config ShouqianbaConfig) error {
+	if config.AlipayPrivateKey == "" && config.AlipayPublicKey == "" {
+		return nil
+	}
+	if _, err := parseRSAPrivateKey("alipay_private_key", config.AlipayPrivateKey); err != nil {
+		return err
+	}
+	if _, err := parseRSAPublicKey("alipay_public_key", config.AlipayPublicKey); err != nil {
+		return err
+	}
+	return nil
+}
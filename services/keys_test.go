@@ -0,0 +1,90 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// pastedVariants 模拟从后台或文档复制密钥时的各种格式
+func pastedVariants(canonical string, body string, blockType string) map[string]string {
+	return map[string]string{
+		"canonical":        canonical,
+		"bare base64":      body,
+		"BOM":              "\ufeff" + canonical,
+		"smart quotes":     "\u201c" + body + "\u201d",
+		"single quotes":    "\u2018" + canonical + "\u2019",
+		"ascii quotes":     `"` + canonical + `"`,
+		"zero width":       body[:10] + "\u200b" + body[10:],
+		"escaped newlines": strings.ReplaceAll(strings.TrimSpace(canonical), "\n", `\n`),
+		"crlf and indent":  "  " + strings.ReplaceAll(canonical, "\n", "\r\n    "),
+		"single line":      "-----BEGIN " + blockType + "-----" + body + "-----END " + blockType + "-----",
+	}
+}
+
+func TestNormalizeKeyRSA(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	privatePEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+
+	for name, raw := range pastedVariants(privatePEM, base64.StdEncoding.EncodeToString(privateDER), "PRIVATE KEY") {
+		key := normalizeKey(raw, "PRIVATE KEY")
+		if key != privatePEM {
+			t.Errorf("private key %s: normalizeKey = %q, want canonical PEM", name, key)
+			continue
+		}
+		parsed, err := parseRSAPrivateKey("alipay_private_key", key)
+		if err != nil || !parsed.Equal(privateKey) {
+			t.Errorf("private key %s: parse = %v, want original key", name, err)
+		}
+	}
+
+	for name, raw := range pastedVariants(publicPEM, base64.StdEncoding.EncodeToString(publicDER), "PUBLIC KEY") {
+		key := normalizeKey(raw, "PUBLIC KEY")
+		if key != publicPEM {
+			t.Errorf("public key %s: normalizeKey = %q, want canonical PEM", name, key)
+			continue
+		}
+		parsed, err := parseRSAPublicKey("alipay_public_key", key)
+		if err != nil || !parsed.Equal(&privateKey.PublicKey) {
+			t.Errorf("public key %s: parse = %v, want original key", name, err)
+		}
+	}
+
+	// PKCS1格式保留原有的PEM标记
+	pkcs1PEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+	if key := normalizeKey("\ufeff"+strings.ReplaceAll(pkcs1PEM, "\n", `\n`), "PRIVATE KEY"); key != pkcs1PEM {
+		t.Errorf("PKCS1 key normalized to %q, want RSA PRIVATE KEY block", key)
+	}
+}
+
+func TestNormalizeKeyInvalid(t *testing.T) {
+	for _, raw := range []string{"", "   ", "\ufeff", "\u201c\u201d"} {
+		if key := normalizeKey(raw, "PUBLIC KEY"); key != "" {
+			t.Errorf("normalizeKey(%q) = %q, want empty", raw, key)
+		}
+	}
+
+	if _, err := parseRSAPublicKey("alipay_public_key", normalizeKey("not a key!", "PUBLIC KEY")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("parse garbage key = %v, want ErrInvalidKey", err)
+	}
+	if _, err := parseRSAPrivateKey("alipay_private_key", ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("parse empty key = %v, want ErrInvalidKey", err)
+	}
+}
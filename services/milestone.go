@@ -0,0 +1,106 @@
+package services
+
+import (
+	"log"
+	"math"
+	"sync"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// Milestone 分类累计金额跨过的里程碑
+type Milestone struct {
+	CategoryID     string
+	TotalCents     int64 // 本笔捐款完成后的分类累计金额（分）
+	MilestoneCents int64 // 跨过的里程碑金额（分），为步长的整数倍
+}
+
+// milestoneTracker 记录每个分类已广播的最高里程碑，避免并发完成的订单重复广播同一里程碑
+type milestoneTracker struct {
+	mutex     sync.Mutex
+	announced map[string]int64 // key为分类ID，value为已广播的里程碑金额（分）
+	handler   func(Milestone, models.Donation)
+}
+
+// SetMilestoneHandler 设置里程碑回调，捐款完成（回调、轮询、对账）后分类累计金额跨过里程碑时调用
+func (ps *PaymentService) SetMilestoneHandler(handler func(Milestone, models.Donation)) {
+	ps.milestones.mutex.Lock()
+	defer ps.milestones.mutex.Unlock()
+	ps.milestones.handler = handler
+}
+
+// milestoneHandler 获取里程碑回调，未设置时返回nil
+func (ps *PaymentService) milestoneHandler() func(Milestone, models.Donation) {
+	ps.milestones.mutex.Lock()
+	defer ps.milestones.mutex.Unlock()
+	return ps.milestones.handler
+}
+
+// announceMilestone 捐款完成后检查里程碑，跨过时调用里程碑回调
+func (ps *PaymentService) announceMilestone(donation models.Donation) {
+	handler := ps.milestoneHandler()
+	if handler == nil {
+		return
+	}
+	if milestone, ok := ps.CheckMilestone(donation); ok {
+		handler(*milestone, donation)
+	}
+}
+
+// CheckMilestone 判断已完成的捐款是否使所在分类的累计金额跨过里程碑（步长的整数倍）
+// 本笔之前的累计金额只统计ID更小的已完成捐款，不用当前合计减去本笔金额：
+// 同时完成的订单各自检查时，当前合计已包含对方，相减得到的"之前"可能都已越过里程碑而漏报
+// 步长优先使用categories.milestone_step，未配置时使用broadcast.milestone_step（元，默认0，不广播）
+func (ps *PaymentService) CheckMilestone(donation models.Donation) (*Milestone, bool) {
+	if donation.Categories == "" || donation.Status != "completed" {
+		return nil, false
+	}
+
+	step := milestoneStepCents(donation.Categories)
+	if step <= 0 {
+		return nil, false
+	}
+
+	var totals struct {
+		BeforeCents int64
+		TotalCents  int64
+	}
+	if err := utils.DB.Model(&models.Donation{}).
+		Select("COALESCE(SUM(CASE WHEN id < ? THEN "+netAmountCentsSQL+" ELSE 0 END), 0) AS before_cents, "+
+			"COALESCE(SUM("+netAmountCentsSQL+"), 0) AS total_cents", donation.ID).
+		Where("status = ? AND categories = ?", "completed", donation.Categories).
+		Scan(&totals).Error; err != nil {
+		log.Printf("Warning: Failed to sum category %s total for milestone: %v", donation.Categories, err)
+		return nil, false
+	}
+
+	before, total := totals.BeforeCents, totals.TotalCents
+	if before/step >= total/step {
+		return nil, false
+	}
+	milestone := total / step * step
+
+	ps.milestones.mutex.Lock()
+	defer ps.milestones.mutex.Unlock()
+	if ps.milestones.announced == nil {
+		ps.milestones.announced = make(map[string]int64)
+	}
+	if milestone <= ps.milestones.announced[donation.Categories] {
+		return nil, false
+	}
+	ps.milestones.announced[donation.Categories] = milestone
+
+	return &Milestone{CategoryID: donation.Categories, TotalCents: total, MilestoneCents: milestone}, true
+}
+
+// milestoneStepCents 获取分类的里程碑步长（分）
+func milestoneStepCents(categoryID string) int64 {
+	step := viper.GetFloat64("broadcast.milestone_step")
+	var category models.Category
+	if err := utils.Reader().Select("milestone_step").Where("id = ?", categoryID).First(&category).Error; err == nil && category.MilestoneStep > 0 {
+		step = category.MilestoneStep
+	}
+	return int64(math.Round(step * 100))
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestCheckMilestoneSingleDonationCrossing(t *testing.T) {
+	setupRankingsDB(t)
+
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1", MilestoneStep: 100})
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 90, AmountCents: 9000, Categories: "1", Status: "completed"})
+	crossing := models.Donation{OrderID: "ORD2", Amount: 20, AmountCents: 2000, Categories: "1", Status: "completed"}
+	mustCreate(t, &crossing)
+
+	ps := NewPaymentService(ShouqianbaConfig{})
+	milestone, ok := ps.CheckMilestone(crossing)
+	if !ok {
+		t.Fatalf("CheckMilestone(ORD2) = false, want crossing of 100")
+	}
+	if milestone.MilestoneCents != 10000 || milestone.TotalCents != 11000 || milestone.CategoryID != "1" {
+		t.Errorf("milestone = %+v, want 10000 of total 11000 in category 1", *milestone)
+	}
+
+	// 已广播的里程碑不再重复
+	if _, ok := ps.CheckMilestone(crossing); ok {
+		t.Errorf("CheckMilestone repeated the announced milestone")
+	}
+}
+
+func TestCheckMilestoneConcurrentCompletion(t *testing.T) {
+	setupRankingsDB(t)
+
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1", MilestoneStep: 100})
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 90, AmountCents: 9000, Categories: "1", Status: "completed"})
+	// 两笔订单同时完成后才检查：合计已包含对方，仍应由ID较小的一笔报告里程碑
+	first := models.Donation{OrderID: "ORD2", Amount: 20, AmountCents: 2000, Categories: "1", Status: "completed"}
+	second := models.Donation{OrderID: "ORD3", Amount: 20, AmountCents: 2000, Categories: "1", Status: "completed"}
+	mustCreate(t, &first)
+	mustCreate(t, &second)
+
+	ps := NewPaymentService(ShouqianbaConfig{})
+	if _, ok := ps.CheckMilestone(second); ok {
+		t.Errorf("CheckMilestone(ORD3) = true, its preceding total is already past 100")
+	}
+	if milestone, ok := ps.CheckMilestone(first); !ok || milestone.MilestoneCents != 10000 {
+		t.Errorf("CheckMilestone(ORD2) = %v, %v, want milestone 10000", milestone, ok)
+	}
+}
+
+func TestCheckMilestoneNoCrossing(t *testing.T) {
+	setupRankingsDB(t)
+
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1", MilestoneStep: 100})
+	donation := models.Donation{OrderID: "ORD1", Amount: 50, AmountCents: 5000, Categories: "1", Status: "completed"}
+	mustCreate(t, &donation)
+
+	ps := NewPaymentService(ShouqianbaConfig{})
+	if milestone, ok := ps.CheckMilestone(donation); ok {
+		t.Errorf("CheckMilestone = %+v, want no milestone below 100", *milestone)
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// BlessingModerationEnabled 是否开启祝福语审核（config: moderation.enabled，默认关闭）
+func BlessingModerationEnabled() bool {
+	return viper.GetBool("moderation.enabled")
+}
+
+// publicBlessing 返回可公开展示的祝福语，未审核通过的祝福语返回空字符串
+func publicBlessing(donation models.Donation) string {
+	if !donation.BlessingApproved {
+		return ""
+	}
+	return donation.Blessing
+}
+
+// GetPendingBlessings 获取待审核的祝福语（有祝福语且尚未审核通过的订单）
+func (ps *PaymentService) GetPendingBlessings(limit int) ([]models.Donation, error) {
+	var donations []models.Donation
+	err := utils.DB.Where("blessing_approved = ? AND blessing <> ?", false, "").
+		Order("created_at asc, id asc").Limit(limit).Find(&donations).Error
+	return donations, err
+}
+
+// ModerateBlessing 审核订单的祝福语
+// 通过：标记为已审核；驳回：清空祝福语，订单金额和捐款人仍计入统计
+func (ps *PaymentService) ModerateBlessing(orderID string, approve bool) error {
+	var donation models.Donation
+	if err := utils.DB.Where("order_id = ?", orderID).First(&donation).Error; err != nil {
+		return fmt.Errorf("order not found: %v", err)
+	}
+
+	updateData := map[string]interface{}{
+		"BlessingApproved": approve,
+	}
+	if !approve {
+		updateData["Blessing"] = ""
+	}
+
+	return utils.DB.Model(&donation).Updates(updateData).Error
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// recordingPublisher 把发布的事件转发到通道，用于统计发布次数
+type recordingPublisher chan DonationEvent
+
+func (p recordingPublisher) Publish(event DonationEvent) error {
+	p <- event
+	return nil
+}
+
+// runConcurrently 同时执行n次fn
+func runConcurrently(n int, fn func()) {
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			start.Wait()
+			fn()
+		}()
+	}
+	start.Done()
+	done.Wait()
+}
+
+func TestUpdateOrderStatusConcurrentCompletionPublishesOnce(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, Payment: "wechat", Status: "pending"})
+	ps := NewPaymentService(ShouqianbaConfig{})
+	events := make(recordingPublisher, 10)
+	ps.SetEventPublisher(events)
+
+	// 回调和轮询同时把订单标记为完成
+	runConcurrently(10, func() { ps.updateOrderStatus("ORD1", "completed") })
+
+	select {
+	case event := <-events:
+		if event.OrderID != "ORD1" {
+			t.Errorf("published order %s, want ORD1", event.OrderID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("completion event not published")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("completion published twice: %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestApplyCallbackUpdateSkipsCompletedOrder(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, Payment: "wechat", Status: "pending"})
+
+	// 重复回调同时到达，只有一次更新成功
+	var mutex sync.Mutex
+	updated := 0
+	runConcurrently(10, func() {
+		ok, err := applyCallbackUpdate("ORD1", map[string]interface{}{"Status": "completed", "TransactionID": "T1"})
+		if err != nil {
+			t.Errorf("applyCallbackUpdate: %v", err)
+		}
+		if ok {
+			mutex.Lock()
+			updated++
+			mutex.Unlock()
+		}
+	})
+	if updated != 1 {
+		t.Errorf("concurrent callbacks updated %d times, want 1", updated)
+	}
+
+	// 迟到的失败回调不覆盖已完成的订单
+	if ok, err := applyCallbackUpdate("ORD1", map[string]interface{}{"Status": "failed"}); ok || err != nil {
+		t.Errorf("failed callback on completed order = %t, %v, want false, nil", ok, err)
+	}
+	var donation models.Donation
+	utils.DB.Where("order_id = ?", "ORD1").First(&donation)
+	if donation.Status != "completed" || donation.TransactionID != "T1" {
+		t.Errorf("donation = %s/%s, want completed/T1", donation.Status, donation.TransactionID)
+	}
+}
+
+func TestReconcileOrderKeepsStatusChangedDuringQuery(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, Payment: "wechat", Status: "pending"})
+	// 查询期间回调把订单标记为完成，查询结果为已取消
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		utils.DB.Model(&models.Donation{}).Where("order_id = ?", "ORD1").Update("status", "completed")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result_code":"200","biz_response":{"result_code":"SUCCESS","data":{"order_status":"PAY_CANCELED"}}}`))
+	}))
+	t.Cleanup(gateway.Close)
+	ps := newRefundService(gateway.URL)
+
+	settled, err := ps.reconcileOrder("ORD1")
+	if err != nil || settled {
+		t.Errorf("reconcileOrder = %t, %v, want false, nil", settled, err)
+	}
+	var donation models.Donation
+	utils.DB.Where("order_id = ?", "ORD1").First(&donation)
+	if donation.Status != "completed" {
+		t.Errorf("status = %s, want completed kept", donation.Status)
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// newOrderService 创建已完成当天签到的支付服务，下单时不访问网关，只生成支付链接
+func newOrderService(t *testing.T, config ShouqianbaConfig) *PaymentService {
+	t.Helper()
+	setupRankingsDB(t)
+	if config.GatewayURL == "" {
+		config.GatewayURL = "https://gw.example.com/wap"
+	}
+	if config.APIURL == "" {
+		config.APIURL = "https://api.example.com"
+	}
+	if config.TerminalSN == "" {
+		config.TerminalSN, config.TerminalKey = "T1", "key"
+	}
+	ps := NewPaymentService(config)
+	ps.lastSignInDate = time.Now().Format("2006-01-02")
+	return ps
+}
+
+// orderParams 解析支付链接中的网关参数
+func orderParams(t *testing.T, payURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(payURL)
+	if err != nil {
+		t.Fatalf("parse pay url %q: %v", payURL, err)
+	}
+	return u.Query()
+}
+
+func TestCreateOrderSubjectPrefix(t *testing.T) {
+	ps := newOrderService(t, ShouqianbaConfig{StoreName: "本院", SubjectPrefix: "【本院】"})
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯"})
+	mustCreate(t, &models.Category{ID: 2, Name: "放生", SubjectPrefix: "【放生】"})
+
+	tests := []struct {
+		categoryID string
+		want       string
+	}{
+		{"", "【本院】捐款-本院"},
+		{"1", "【本院】捐款-本院-供灯"},
+		// 分类的前缀优先于支付配置的前缀
+		{"2", "【放生】捐款-本院-放生"},
+	}
+	for _, tt := range tests {
+		_, payURL, err := ps.CreateOrder(10, 0, "wechat", "example.com", "anonymous", tt.categoryID, "", "")
+		if err != nil {
+			t.Fatalf("CreateOrder category %q: %v", tt.categoryID, err)
+		}
+		if got := orderParams(t, payURL).Get("subject"); got != tt.want {
+			t.Errorf("category %q subject = %q, want %q", tt.categoryID, got, tt.want)
+		}
+	}
+}
+
+func TestCreateOrderSubjectTruncatedOnRuneBoundary(t *testing.T) {
+	// 中文字符3字节，前缀和门店名使subject超过50字节时在字符边界截断
+	ps := newOrderService(t, ShouqianbaConfig{StoreName: strings.Repeat("寺", 20), SubjectPrefix: "【法会】"})
+	_, payURL, err := ps.CreateOrder(10, 0, "wechat", "example.com", "anonymous", "", "", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	subject := orderParams(t, payURL).Get("subject")
+	if len(subject) > 50 || !utf8.ValidString(subject) {
+		t.Errorf("subject = %q (%d bytes), want valid UTF-8 within 50 bytes", subject, len(subject))
+	}
+	if !strings.HasPrefix(subject, "【法会】捐款-寺") {
+		t.Errorf("subject = %q, want prefix kept", subject)
+	}
+}
+
+func TestCreateOrderUncategorizedModes(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Set("donation.uncategorized", "")
+		viper.Set("donation.default_category_id", "")
+	})
+	tests := []struct {
+		mode, defaultID string
+		err             error
+		want            string
+	}{
+		{"", "", nil, ""},
+		{"allow", "", nil, ""},
+		{"reject", "", ErrCategoryRequired, ""},
+		// 使用默认分类时分类ID随订单保存，返回地址也带上该分类
+		{"default", "3", nil, "3"},
+		{"default", "", nil, ""},
+	}
+	for _, tt := range tests {
+		ps := newOrderService(t, ShouqianbaConfig{})
+		mustCreate(t, &models.Category{ID: 3, Name: "随喜"})
+		viper.Set("donation.uncategorized", tt.mode)
+		viper.Set("donation.default_category_id", tt.defaultID)
+
+		orderID, payURL, err := ps.CreateOrder(10, 0, "wechat", "example.com", "anonymous", "", "", "")
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("mode %q: error = %v, want %v", tt.mode, err, tt.err)
+			}
+			var count int64
+			utils.DB.Model(&models.Donation{}).Count(&count)
+			if count != 0 {
+				t.Errorf("mode %q: created %d donations, want 0", tt.mode, count)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("mode %q: CreateOrder: %v", tt.mode, err)
+		}
+		var donation models.Donation
+		utils.DB.Where("order_id = ?", orderID).First(&donation)
+		if donation.Categories != tt.want {
+			t.Errorf("mode %q: saved category = %q, want %q", tt.mode, donation.Categories, tt.want)
+		}
+		if tt.want != "" && !strings.Contains(orderParams(t, payURL).Get("subject"), "随喜") {
+			t.Errorf("mode %q: subject = %q, want default category name", tt.mode, orderParams(t, payURL).Get("subject"))
+		}
+	}
+}
+
+func TestCreateOrderSanitizesStoreNameForSignature(t *testing.T) {
+	// 门店名和分类名中的&、=和控制字符会截断参数或使签名原文与URL中的值不一致
+	ps := newOrderService(t, ShouqianbaConfig{StoreName: "东&院=\n分院\t"})
+	mustCreate(t, &models.Category{ID: 1, Name: "供\r灯&"})
+	_, payURL, err := ps.CreateOrder(10, 0, "wechat", "example.com", "anonymous", "1", "", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	query := orderParams(t, payURL)
+	if got := query.Get("subject"); got != "捐款-东院分院-供灯" {
+		t.Errorf("subject = %q, want 捐款-东院分院-供灯", got)
+	}
+	if got := query.Get("reflect"); got != "东院分院-供灯" {
+		t.Errorf("reflect = %q, want 东院分院-供灯", got)
+	}
+
+	// 网关按URL解码后的参数验签，结果应与链接中的签名一致
+	params := make(map[string]string)
+	for k, v := range query {
+		if len(v) != 1 {
+			t.Fatalf("param %s appears %d times, want once", k, len(v))
+		}
+		params[k] = v[0]
+	}
+	if want := generateSign(ps.Config(), params, "terminal"); query.Get("sign") != want {
+		t.Errorf("sign = %q, want %q recomputed from decoded params", query.Get("sign"), want)
+	}
+}
+
+func TestCreateOrderValidSecondsParam(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Set("payment.order_valid_seconds", 0)
+		viper.Set("payment.order_valid_param", "")
+	})
+	tests := []struct {
+		seconds int
+		param   string
+		want    map[string]string // 期望的有效期参数，为空时不传
+	}{
+		{0, "", nil},
+		{-30, "", nil},
+		{360, "", map[string]string{"time_expire": "360"}},
+		{600, "expire_seconds", map[string]string{"expire_seconds": "600"}},
+	}
+	for _, tt := range tests {
+		viper.Set("payment.order_valid_seconds", tt.seconds)
+		viper.Set("payment.order_valid_param", tt.param)
+		ps := newOrderService(t, ShouqianbaConfig{})
+		_, payURL, err := ps.CreateOrder(10, 0, "wechat", "example.com", "anonymous", "", "", "")
+		if err != nil {
+			t.Fatalf("CreateOrder with %d seconds: %v", tt.seconds, err)
+		}
+
+		query := orderParams(t, payURL)
+		for _, name := range []string{"time_expire", "expire_seconds"} {
+			if got, want := query.Get(name), tt.want[name]; got != want {
+				t.Errorf("order_valid_seconds=%d param %q: %s = %q, want %q", tt.seconds, tt.param, name, got, want)
+			}
+		}
+		// 有效期参数参与签名
+		params := make(map[string]string)
+		for k := range query {
+			params[k] = query.Get(k)
+		}
+		if want := generateSign(ps.Config(), params, "terminal"); query.Get("sign") != want {
+			t.Errorf("order_valid_seconds=%d: sign = %q, want %q", tt.seconds, query.Get("sign"), want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrPaymentMethodDisabled 支付配置未开通该支付方式
+var ErrPaymentMethodDisabled = errors.New("payment method not enabled for this config")
+
+// AllowedPayments 支付配置可用的支付方式（wechat、alipay）
+// 配置了EnabledPayments时以其为准；否则按已配置的授权凭证推断（微信公众号/小程序AppID、支付宝AppID），
+// 都未配置时两种方式均可用，与未区分支付方式时的行为一致
+func AllowedPayments(cfg ShouqianbaConfig) []string {
+	if cfg.EnabledPayments != "" {
+		var payments []string
+		for _, p := range strings.Split(cfg.EnabledPayments, ",") {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if (p == "wechat" || p == "alipay") && !containsPayment(payments, p) {
+				payments = append(payments, p)
+			}
+		}
+		return payments
+	}
+
+	var payments []string
+	if cfg.WechatAppID != "" || cfg.WechatMiniAppID != "" {
+		payments = append(payments, "wechat")
+	}
+	if cfg.AlipayAppID != "" {
+		payments = append(payments, "alipay")
+	}
+	if len(payments) == 0 {
+		return []string{"wechat", "alipay"}
+	}
+	return payments
+}
+
+// paymentAllowed 支付方式是否在配置的可用列表中
+func paymentAllowed(cfg ShouqianbaConfig, payment string) bool {
+	return containsPayment(AllowedPayments(cfg), payment)
+}
+
+func containsPayment(payments []string, payment string) bool {
+	for _, p := range payments {
+		if p == payment {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+func TestAllowedPayments(t *testing.T) {
+	tests := []struct {
+		cfg  ShouqianbaConfig
+		want []string
+	}{
+		{ShouqianbaConfig{}, []string{"wechat", "alipay"}},
+		{ShouqianbaConfig{WechatAppID: "wx"}, []string{"wechat"}},
+		{ShouqianbaConfig{WechatMiniAppID: "mini"}, []string{"wechat"}},
+		{ShouqianbaConfig{AlipayAppID: "ali"}, []string{"alipay"}},
+		{ShouqianbaConfig{WechatAppID: "wx", AlipayAppID: "ali"}, []string{"wechat", "alipay"}},
+		// EnabledPayments优先于按凭证推断，忽略未知和重复的项
+		{ShouqianbaConfig{WechatAppID: "wx", AlipayAppID: "ali", EnabledPayments: "wechat"}, []string{"wechat"}},
+		{ShouqianbaConfig{EnabledPayments: " Alipay , unionpay, alipay"}, []string{"alipay"}},
+	}
+	for _, tt := range tests {
+		if got := AllowedPayments(tt.cfg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AllowedPayments(%+v) = %v, want %v", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestCreateOrderRejectsDisabledPayment(t *testing.T) {
+	// 只配置了微信凭证的主配置，以及显式只开通微信的分配置
+	ps := newOrderService(t, ShouqianbaConfig{WechatAppID: "wx"})
+	mustCreate(t, &models.PaymentConfig{ID: 2, VendorSN: "V2", TerminalSN: "T2", TerminalKey: "key", StoreName: "分院",
+		APIURL: "https://api.example.com", GatewayURL: "https://gw.example.com/wap", AlipayAppID: "ali", EnabledPayments: "wechat"})
+
+	for _, paymentConfigID := range []string{"", "2"} {
+		if _, _, err := ps.CreateOrder(10, 0, "alipay", "example.com", "anonymous", "", paymentConfigID, ""); !errors.Is(err, ErrPaymentMethodDisabled) {
+			t.Errorf("alipay order on config %q error = %v, want ErrPaymentMethodDisabled", paymentConfigID, err)
+		}
+	}
+	var count int64
+	utils.DB.Model(&models.Donation{}).Count(&count)
+	if count != 0 {
+		t.Errorf("created %d donations for disabled payment, want 0", count)
+	}
+
+	if _, _, err := ps.CreateOrder(10, 0, "wechat", "example.com", "anonymous", "", "", ""); err != nil {
+		t.Errorf("wechat order on wechat-only config: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// maxDonorPendingOrders 返回的未完成订单数上限
+const maxDonorPendingOrders = 10
+
+// DonorPendingOrder 捐款人未完成的订单（待支付、状态未知、已失败等），供前端提供"继续支付"或"查询状态"
+type DonorPendingOrder struct {
+	OrderID         string    `json:"order_id"`
+	Amount          float64   `json:"amount"`
+	FormattedAmount string    `json:"formatted_amount"`
+	Payment         string    `json:"payment"`
+	PaymentConfigID string    `json:"payment_config_id"`
+	CategoryID      string    `json:"category_id"`
+	Status          string    `json:"status"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// pendingRequery 捐款人重新查单的节流，key为payment_openid，value为上次查单时间
+type pendingRequery struct {
+	mutex   sync.Mutex
+	queries map[string]time.Time
+}
+
+// GetDonorPendingOrders 获取捐款人最近未完成的订单，待支付和状态未知的订单先向网关重新查询（复用对账逻辑）
+// 匿名捐款人返回空列表；查询后已完成的订单不再返回
+// config: my_pending.window（查询时间范围，默认24h）、my_pending.requery_interval（同一捐款人重新查单的最小间隔，默认30s）
+func (ps *PaymentService) GetDonorPendingOrders(payment string, openid string) ([]DonorPendingOrder, error) {
+	orders := []DonorPendingOrder{}
+	if openid == "" || openid == "anonymous" {
+		return orders, nil
+	}
+
+	window := viper.GetDuration("my_pending.window")
+	if window <= 0 {
+		window = 24 * time.Hour
+	}
+	load := func() ([]models.Donation, error) {
+		var donations []models.Donation
+		err := utils.DB.Where("openid = ? AND payment = ? AND status <> ? AND created_at >= ?", openid, payment, "completed", time.Now().Add(-window)).
+			Order("created_at desc, id desc").Limit(maxDonorPendingOrders).Find(&donations).Error
+		return donations, err
+	}
+
+	donations, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	if ps.allowPendingRequery(payment + "_" + openid) {
+		requeried := false
+		for _, donation := range donations {
+			if donation.Status != "pending" && donation.Status != "unknown" {
+				continue
+			}
+			requeried = true
+			if _, err := ps.reconcileOrder(donation.OrderID); err != nil {
+				log.Printf("Warning: Failed to requery pending order %s for donor: %v", donation.OrderID, err)
+			}
+		}
+		if requeried {
+			if donations, err = load(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, donation := range donations {
+		orders = append(orders, DonorPendingOrder{
+			OrderID:         donation.OrderID,
+			Amount:          donation.Amount,
+			FormattedAmount: FormatAmount(donation.Amount),
+			Payment:         donation.Payment,
+			PaymentConfigID: donation.PaymentConfigID,
+			CategoryID:      donation.Categories,
+			Status:          donation.Status,
+			CreatedAt:       donation.CreatedAt,
+		})
+	}
+	return orders, nil
+}
+
+// allowPendingRequery 同一捐款人在my_pending.requery_interval内只向网关重新查单一次
+func (ps *PaymentService) allowPendingRequery(key string) bool {
+	interval := viper.GetDuration("my_pending.requery_interval")
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	r := &ps.pendingRequery
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if r.queries == nil {
+		r.queries = make(map[string]time.Time)
+	}
+	if last, ok := r.queries[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+	// 顺带清理过期的记录，避免持续增长
+	for k, last := range r.queries {
+		if now.Sub(last) >= interval {
+			delete(r.queries, k)
+		}
+	}
+	r.queries[key] = now
+	return true
+}
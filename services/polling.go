@@ -0,0 +1,262 @@
+package services
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// pollingPool 支付结果轮询工作池，限制同时轮询的订单数量
+// 队列已满时订单不再轮询，由后台对账任务补查
+type pollingPool struct {
+	once     sync.Once
+	queue    chan pollingJob
+	workers  int
+	maxQueue int
+	active   int64 // 正在轮询的订单数
+	dropped  int64 // 因队列已满未能轮询的订单数
+
+	mutex   sync.Mutex
+	configs map[string]*configPolling // key为支付配置ID
+}
+
+// pollingJob 轮询任务
+type pollingJob struct {
+	orderID         string
+	paymentConfigID string
+}
+
+// configPolling 单个支付配置的轮询占用情况
+type configPolling struct {
+	admitted int      // 已进入工作池（排队或轮询中）的订单数
+	waiting  []string // 超过polling.max_per_config，等待进入工作池的订单
+}
+
+// PollingStats 轮询工作池指标
+type PollingStats struct {
+	Workers       int                           `json:"workers"`
+	ActiveWorkers int64                         `json:"active_workers"`
+	QueueDepth    int                           `json:"queue_depth"`
+	QueueCapacity int                           `json:"queue_capacity"`
+	Dropped       int64                         `json:"dropped"`
+	PerConfig     map[string]ConfigPollingStats `json:"per_config"` // key为支付配置ID（主配置为""）
+}
+
+// ConfigPollingStats 单个支付配置的轮询指标
+type ConfigPollingStats struct {
+	Active  int `json:"active"`  // 已进入工作池（排队或轮询中）的订单数
+	Waiting int `json:"waiting"` // 超过上限等待的订单数
+}
+
+// StartPolling 启动轮询工作池和后台对账任务（服务启动时调用，重复调用无效）
+// config: polling.workers（默认100）、polling.queue_size（默认1000）、polling.reconcile_interval（默认5m）
+func (ps *PaymentService) StartPolling() {
+	ps.polling.once.Do(func() {
+		workers := viper.GetInt("polling.workers")
+		if workers <= 0 {
+			workers = 100
+		}
+		queueSize := viper.GetInt("polling.queue_size")
+		if queueSize <= 0 {
+			queueSize = 1000
+		}
+
+		ps.polling.workers = workers
+		ps.polling.maxQueue = queueSize
+		ps.polling.queue = make(chan pollingJob, queueSize)
+		for i := 0; i < workers; i++ {
+			go ps.pollingWorker()
+		}
+
+		interval := viper.GetDuration("polling.reconcile_interval")
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+		go ps.startReconciler(interval)
+
+		log.Printf("Payment polling pool started: workers=%d, queue_size=%d, reconcile_interval=%v", workers, queueSize, interval)
+	})
+}
+
+// enqueuePolling 将订单加入轮询队列，队列已满时不阻塞下单
+// 同一支付配置进入工作池的订单超过polling.max_per_config时先在该配置的等待列表中排队，避免单个商户占满工作池
+func (ps *PaymentService) enqueuePolling(orderID string, paymentConfigID string) {
+	if ps.polling.queue == nil {
+		log.Printf("Warning: Polling pool not started, order %s will not be polled", orderID)
+		return
+	}
+
+	if !ps.polling.admit(orderID, paymentConfigID) {
+		return
+	}
+	if !ps.polling.push(pollingJob{orderID: orderID, paymentConfigID: paymentConfigID}) {
+		ps.releasePolling(paymentConfigID)
+	}
+}
+
+// pollingWorker 从队列中取出订单并轮询
+func (ps *PaymentService) pollingWorker() {
+	for job := range ps.polling.queue {
+		atomic.AddInt64(&ps.polling.active, 1)
+		ps.startPaymentPolling(job.orderID)
+		atomic.AddInt64(&ps.polling.active, -1)
+		ps.releasePolling(job.paymentConfigID)
+	}
+}
+
+// releasePolling 支付配置的一个订单结束轮询，将该配置等待中的订单放入工作池
+func (ps *PaymentService) releasePolling(paymentConfigID string) {
+	for {
+		orderID, ok := ps.polling.release(paymentConfigID)
+		if !ok {
+			return
+		}
+		if ps.polling.push(pollingJob{orderID: orderID, paymentConfigID: paymentConfigID}) {
+			return
+		}
+	}
+}
+
+// maxPollsPerConfig 单个支付配置同时进入工作池的订单上限（config: polling.max_per_config，默认0，不限制）
+func maxPollsPerConfig() int {
+	return viper.GetInt("polling.max_per_config")
+}
+
+// admit 占用支付配置的轮询名额，达到上限时加入等待列表并返回false；等待列表超过队列长度时丢弃，由后台对账补查
+func (p *pollingPool) admit(orderID string, paymentConfigID string) bool {
+	limit := maxPollsPerConfig()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.configs == nil {
+		p.configs = make(map[string]*configPolling)
+	}
+	c, ok := p.configs[paymentConfigID]
+	if !ok {
+		c = &configPolling{}
+		p.configs[paymentConfigID] = c
+	}
+	if limit > 0 && c.admitted >= limit {
+		if len(c.waiting) >= p.maxQueue {
+			atomic.AddInt64(&p.dropped, 1)
+			log.Printf("Warning: Polling backlog full for config %q, order %s will be reconciled later", paymentConfigID, orderID)
+			return false
+		}
+		c.waiting = append(c.waiting, orderID)
+		return false
+	}
+	c.admitted++
+	return true
+}
+
+// release 释放支付配置的轮询名额，有等待中的订单时返回该订单（名额转给它）
+func (p *pollingPool) release(paymentConfigID string) (string, bool) {
+	limit := maxPollsPerConfig()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	c, ok := p.configs[paymentConfigID]
+	if !ok {
+		return "", false
+	}
+	c.admitted--
+	if len(c.waiting) > 0 && (limit <= 0 || c.admitted < limit) {
+		orderID := c.waiting[0]
+		c.waiting = c.waiting[1:]
+		c.admitted++
+		return orderID, true
+	}
+	if c.admitted <= 0 && len(c.waiting) == 0 {
+		delete(p.configs, paymentConfigID)
+	}
+	return "", false
+}
+
+// push 将任务放入工作池队列，队列已满时返回false
+func (p *pollingPool) push(job pollingJob) bool {
+	select {
+	case p.queue <- job:
+		return true
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+		log.Printf("Warning: Polling queue full, order %s will be reconciled later", job.orderID)
+		return false
+	}
+}
+
+// PollingStats 获取轮询工作池指标
+func (ps *PaymentService) PollingStats() PollingStats {
+	stats := PollingStats{
+		Workers:       ps.polling.workers,
+		ActiveWorkers: atomic.LoadInt64(&ps.polling.active),
+		QueueDepth:    len(ps.polling.queue),
+		QueueCapacity: cap(ps.polling.queue),
+		Dropped:       atomic.LoadInt64(&ps.polling.dropped),
+		PerConfig:     make(map[string]ConfigPollingStats),
+	}
+
+	ps.polling.mutex.Lock()
+	defer ps.polling.mutex.Unlock()
+	for id, c := range ps.polling.configs {
+		stats.PerConfig[id] = ConfigPollingStats{Active: c.admitted, Waiting: len(c.waiting)}
+	}
+	return stats
+}
+
+// pollingJitter 轮询间隔的随机抖动比例（config: polling.jitter，默认0.2，即±20%，取值0~1，设为0关闭）
+// 同一时刻创建的大量订单（如活动现场集中扫码）错开查询时间，避免对网关造成集中压力
+func pollingJitter() float64 {
+	if !viper.IsSet("polling.jitter") {
+		return 0.2
+	}
+	jitter := viper.GetFloat64("polling.jitter")
+	if jitter < 0 {
+		return 0
+	}
+	if jitter > 1 {
+		return 1
+	}
+	return jitter
+}
+
+// jitterDuration 在d的基础上随机增减不超过fraction比例的时长，平均值仍为d
+func jitterDuration(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+	delta := (rand.Float64()*2 - 1) * fraction * float64(d)
+	return d + time.Duration(delta)
+}
+
+// startReconciler 定期补查超过轮询窗口仍未确定状态的订单（最近24小时内）
+func (ps *PaymentService) startReconciler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var donations []models.Donation
+		now := time.Now()
+		if err := utils.DB.Where("status IN ? AND created_at BETWEEN ? AND ?", []string{"pending", "unknown"}, now.Add(-24*time.Hour), now.Add(-6*time.Minute)).
+			Order("created_at asc").Limit(200).Find(&donations).Error; err != nil {
+			log.Printf("Reconcile: failed to load pending orders: %v", err)
+			continue
+		}
+
+		for _, donation := range donations {
+			result, err := ps.QueryOrder(donation.OrderID)
+			if err != nil {
+				log.Printf("Reconcile: query order %s failed: %v", donation.OrderID, err)
+				continue
+			}
+			if updated, status := ps.updateOrderStatusFromQuery(donation.OrderID, result, "pending", "unknown"); updated {
+				log.Printf("Reconcile: order %s status updated to %s", donation.OrderID, status)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestPollingAdmitOverflowDoesNotBlockOtherConfig(t *testing.T) {
+	viper.Set("polling.max_per_config", 2)
+	t.Cleanup(func() { viper.Set("polling.max_per_config", 0) })
+	p := &pollingPool{maxQueue: 10}
+
+	// 配置1占满名额，后续订单进入等待列表
+	for _, orderID := range []string{"A1", "A2"} {
+		if !p.admit(orderID, "1") {
+			t.Fatalf("admit(%s, 1) = false, want true", orderID)
+		}
+	}
+	for _, orderID := range []string{"A3", "A4"} {
+		if p.admit(orderID, "1") {
+			t.Fatalf("admit(%s, 1) = true, want waiting", orderID)
+		}
+	}
+
+	// 配置2和主配置不受配置1积压影响
+	for _, config := range []string{"2", "2", ""} {
+		if !p.admit("B", config) {
+			t.Errorf("admit for config %q blocked by config 1 overflow", config)
+		}
+	}
+
+	// 配置1释放名额时按顺序放行等待中的订单
+	if orderID, ok := p.release("1"); !ok || orderID != "A3" {
+		t.Errorf("release(1) = %q, %t, want A3", orderID, ok)
+	}
+	if orderID, ok := p.release("1"); !ok || orderID != "A4" {
+		t.Errorf("release(1) = %q, %t, want A4", orderID, ok)
+	}
+	// 配置2释放不会放行配置1的订单
+	if orderID, ok := p.release("2"); ok {
+		t.Errorf("release(2) = %q, want nothing waiting", orderID)
+	}
+
+	for i := 0; i < 2; i++ {
+		p.release("1")
+	}
+	p.release("2")
+	p.release("")
+	if len(p.configs) != 0 {
+		t.Errorf("configs = %v, want all released", p.configs)
+	}
+}
+
+func TestPollingAdmitDropsWhenBacklogFull(t *testing.T) {
+	viper.Set("polling.max_per_config", 1)
+	t.Cleanup(func() { viper.Set("polling.max_per_config", 0) })
+	p := &pollingPool{maxQueue: 1}
+
+	p.admit("A1", "1")
+	p.admit("A2", "1") // 等待
+	if p.admit("A3", "1") {
+		t.Fatal("admit beyond backlog = true, want dropped")
+	}
+	if p.dropped != 1 {
+		t.Errorf("dropped = %d, want 1", p.dropped)
+	}
+	if !p.admit("B1", "2") {
+		t.Error("admit for config 2 blocked by config 1 backlog")
+	}
+}
+
+func TestReleasePollingPushesWaitingOrderForSameConfig(t *testing.T) {
+	viper.Set("polling.max_per_config", 1)
+	t.Cleanup(func() { viper.Set("polling.max_per_config", 0) })
+	ps := NewPaymentService(ShouqianbaConfig{})
+	ps.polling.maxQueue = 10
+	ps.polling.queue = make(chan pollingJob, 10)
+
+	ps.enqueuePolling("A1", "1")
+	ps.enqueuePolling("A2", "1")
+	ps.enqueuePolling("B1", "2")
+	if got := len(ps.polling.queue); got != 2 {
+		t.Fatalf("queue depth = %d, want 2 (A1 and B1)", got)
+	}
+	<-ps.polling.queue
+	<-ps.polling.queue
+
+	ps.releasePolling("1")
+	select {
+	case job := <-ps.polling.queue:
+		if job.orderID != "A2" || job.paymentConfigID != "1" {
+			t.Errorf("released job = %+v, want A2 for config 1", job)
+		}
+	default:
+		t.Error("waiting order not pushed after release")
+	}
+	if stats := ps.PollingStats(); stats.PerConfig["1"].Active != 1 || stats.PerConfig["2"].Active != 1 {
+		t.Errorf("per config stats = %+v, want one active order each", stats.PerConfig)
+	}
+}
+
+func TestFinalPollingStatusWithMissingData(t *testing.T) {
+	paid := &QueryResult{BizResponse: &QueryBizResponse{Data: &QueryData{OrderStatus: "PAID"}}}
+	canceled := &QueryResult{BizResponse: &QueryBizResponse{Data: &QueryData{OrderStatus: "PAY_CANCELED"}}}
+	tests := []struct {
+		name          string
+		result        *QueryResult
+		currentStatus string
+		want          string
+		update        bool
+	}{
+		{"paid", paid, "pending", "completed", true},
+		{"canceled", canceled, "pending", "failed", true},
+		{"nil result", nil, "pending", "unknown", true},
+		{"missing biz_response", &QueryResult{ResultCode: "200"}, "pending", "unknown", true},
+		{"missing data", &QueryResult{BizResponse: &QueryBizResponse{ResultCode: "SUCCESS"}}, "pending", "unknown", true},
+		{"empty order_status", &QueryResult{BizResponse: &QueryBizResponse{Data: &QueryData{}}}, "pending", "unknown", true},
+		{"in progress", &QueryResult{BizResponse: &QueryBizResponse{Data: &QueryData{OrderStatus: "CREATED"}}}, "pending", "unknown", true},
+		// 回调已将订单置为最终状态时，缺少数据不应改为unknown
+		{"missing data after completed", nil, "completed", "", false},
+		{"missing data after failed", &QueryResult{}, "failed", "", false},
+		{"paid after failed", paid, "failed", "completed", true},
+	}
+	for _, tt := range tests {
+		got, update := finalPollingStatus(tt.result, tt.currentStatus)
+		if got != tt.want || update != tt.update {
+			t.Errorf("%s: finalPollingStatus = (%q, %t), want (%q, %t)", tt.name, got, update, tt.want, tt.update)
+		}
+	}
+}
+
+func TestJitterDurationBounds(t *testing.T) {
+	const d = 10 * time.Second
+	for _, fraction := range []float64{0.1, 0.5, 1} {
+		low, high := d-time.Duration(fraction*float64(d)), d+time.Duration(fraction*float64(d))
+		var sum time.Duration
+		var below, above bool
+		const n = 2000
+		for i := 0; i < n; i++ {
+			got := jitterDuration(d, fraction)
+			if got < low || got > high {
+				t.Fatalf("jitterDuration(%v, %v) = %v, want within [%v, %v]", d, fraction, got, low, high)
+			}
+			below = below || got < d
+			above = above || got > d
+			sum += got
+		}
+		// 随机增减，平均值接近d
+		if !below || !above {
+			t.Errorf("jitterDuration(%v, %v) never went both below and above d", d, fraction)
+		}
+		if mean := sum / n; mean < d-d/10 || mean > d+d/10 {
+			t.Errorf("jitterDuration(%v, %v) mean = %v, want about %v", d, fraction, mean, d)
+		}
+	}
+
+	// 比例或时长不为正时原样返回
+	for _, tt := range []struct {
+		d        time.Duration
+		fraction float64
+	}{{d, 0}, {d, -0.5}, {0, 0.5}, {-time.Second, 0.5}} {
+		if got := jitterDuration(tt.d, tt.fraction); got != tt.d {
+			t.Errorf("jitterDuration(%v, %v) = %v, want unchanged", tt.d, tt.fraction, got)
+		}
+	}
+}
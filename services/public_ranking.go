@@ -0,0 +1,49 @@
+package services
+
+import "time"
+
+// PublicRankingItem 公开排行榜接口返回的记录，只包含展示所需字段
+// 不含捐款人openid/user_id、支付配置ID等内部字段，内部关联和补全仍使用RankingItem
+type PublicRankingItem struct {
+	ID              uint      `json:"id"`
+	Rank            int       `json:"rank"` // 在结果中的序号，从1开始（分页时接续上一页）
+	UserName        string    `json:"user_name"`
+	AvatarURL       string    `json:"avatar_url"`
+	Amount          float64   `json:"amount"`
+	FormattedAmount string    `json:"formatted_amount"`
+	Payment         string    `json:"payment"` // 支付方式（wechat/alipay），用于展示支付图标
+	CategoryID      string    `json:"category_id"`
+	CategoryName    string    `json:"category_name"`
+	StoreName       string    `json:"store_name"`
+	Blessing        string    `json:"blessing"`
+	CreatedAt       time.Time `json:"created_at"`
+	Refunded        bool      `json:"refunded,omitempty"` // 已全部退款
+}
+
+// NewPublicRankingItem 将排行榜项转换为公开记录
+func NewPublicRankingItem(item RankingItem, rank int) PublicRankingItem {
+	return PublicRankingItem{
+		ID:              item.ID,
+		Rank:            rank,
+		UserName:        item.UserName,
+		AvatarURL:       ProxiedAvatarURL(item.AvatarURL),
+		Amount:          item.Amount,
+		FormattedAmount: item.FormattedAmount,
+		Payment:         item.Payment,
+		CategoryID:      item.CategoryID,
+		CategoryName:    item.CategoryName,
+		StoreName:       item.StoreName,
+		Blessing:        item.Blessing,
+		CreatedAt:       item.CreatedAt,
+		Refunded:        item.Refunded,
+	}
+}
+
+// NewPublicRankingItems 批量转换排行榜项，offset为分页偏移量，序号从offset+1开始
+func NewPublicRankingItems(items []RankingItem, offset int) []PublicRankingItem {
+	public := make([]PublicRankingItem, len(items))
+	for i, item := range items {
+		public[i] = NewPublicRankingItem(item, offset+i+1)
+	}
+	return public
+}
@@ -0,0 +1,82 @@
+package services
+
+import "encoding/json"
+
+// QueryResult 查单接口（/upay/v2/query）响应，只包含状态同步需要的字段
+// 网关响应中缺少biz_response或data时对应字段为nil，通过访问方法读取不会panic
+type QueryResult struct {
+	ResultCode  string            `json:"result_code"`
+	BizResponse *QueryBizResponse `json:"biz_response"`
+}
+
+// QueryBizResponse 查单业务响应
+type QueryBizResponse struct {
+	ResultCode   string     `json:"result_code"`
+	ErrorCode    string     `json:"error_code"`
+	ErrorMessage string     `json:"error_message"`
+	Data         *QueryData `json:"data"`
+}
+
+// QueryData 查单返回的订单数据
+type QueryData struct {
+	OrderStatus string     `json:"order_status"`
+	TotalAmount flexString `json:"total_amount"` // 分
+	TradeNo     string     `json:"trade_no"`
+}
+
+// BizResultCode 业务结果码，缺少biz_response时为空
+func (r *QueryResult) BizResultCode() string {
+	if r == nil || r.BizResponse == nil {
+		return ""
+	}
+	return r.BizResponse.ResultCode
+}
+
+// ErrorCode 业务错误码，缺少biz_response时为空
+func (r *QueryResult) ErrorCode() string {
+	if r == nil || r.BizResponse == nil {
+		return ""
+	}
+	return r.BizResponse.ErrorCode
+}
+
+// Data 订单数据，缺少biz_response或data时为nil
+func (r *QueryResult) Data() *QueryData {
+	if r == nil || r.BizResponse == nil {
+		return nil
+	}
+	return r.BizResponse.Data
+}
+
+// OrderStatus 订单状态码（如PAID、PAY_CANCELED），缺少时为空
+func (r *QueryResult) OrderStatus() string {
+	if data := r.Data(); data != nil {
+		return data.OrderStatus
+	}
+	return ""
+}
+
+// TradeNo 支付通道交易号，缺少时为空
+func (r *QueryResult) TradeNo() string {
+	if data := r.Data(); data != nil {
+		return data.TradeNo
+	}
+	return ""
+}
+
+// flexString 兼容网关以字符串或数字返回的字段
+type flexString string
+
+func (s *flexString) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		*s = flexString(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(b, &num); err != nil {
+		return err
+	}
+	*s = flexString(num.String())
+	return nil
+}
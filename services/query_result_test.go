@@ -0,0 +1,64 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestQueryResultAccessorsWithMissingFields(t *testing.T) {
+	tests := []struct {
+		body                                           string
+		bizResultCode, errorCode, orderStatus, tradeNo string
+		hasData                                        bool
+	}{
+		{`{"result_code":"200"}`, "", "", "", "", false},
+		{`{"result_code":"200","biz_response":null}`, "", "", "", "", false},
+		{`{"result_code":"200","biz_response":{"result_code":"FAIL","error_code":"UPAY_ORDER_NOT_EXISTS"}}`, "FAIL", "UPAY_ORDER_NOT_EXISTS", "", "", false},
+		{`{"result_code":"200","biz_response":{"result_code":"SUCCESS","data":null}}`, "SUCCESS", "", "", "", false},
+		{`{"result_code":"200","biz_response":{"result_code":"SUCCESS","data":{}}}`, "SUCCESS", "", "", "", true},
+		{`{"result_code":"200","biz_response":{"result_code":"SUCCESS","data":{"order_status":"PAID","trade_no":"T1","total_amount":990}}}`, "SUCCESS", "", "PAID", "T1", true},
+	}
+	for _, tt := range tests {
+		var result QueryResult
+		if err := json.Unmarshal([]byte(tt.body), &result); err != nil {
+			t.Fatalf("unmarshal %s: %v", tt.body, err)
+		}
+		if got := result.BizResultCode(); got != tt.bizResultCode {
+			t.Errorf("%s: BizResultCode = %q, want %q", tt.body, got, tt.bizResultCode)
+		}
+		if got := result.ErrorCode(); got != tt.errorCode {
+			t.Errorf("%s: ErrorCode = %q, want %q", tt.body, got, tt.errorCode)
+		}
+		if got := result.OrderStatus(); got != tt.orderStatus {
+			t.Errorf("%s: OrderStatus = %q, want %q", tt.body, got, tt.orderStatus)
+		}
+		if got := result.TradeNo(); got != tt.tradeNo {
+			t.Errorf("%s: TradeNo = %q, want %q", tt.body, got, tt.tradeNo)
+		}
+		if got := result.Data() != nil; got != tt.hasData {
+			t.Errorf("%s: Data() != nil is %t, want %t", tt.body, got, tt.hasData)
+		}
+	}
+
+	// nil结果同样安全
+	var result *QueryResult
+	if result.BizResultCode() != "" || result.ErrorCode() != "" || result.OrderStatus() != "" || result.TradeNo() != "" || result.Data() != nil {
+		t.Error("nil QueryResult accessors returned values, want zero values")
+	}
+}
+
+func TestQueryDataTotalAmountStringOrNumber(t *testing.T) {
+	for _, body := range []string{`{"total_amount":990}`, `{"total_amount":"990"}`} {
+		var data QueryData
+		if err := json.Unmarshal([]byte(body), &data); err != nil {
+			t.Fatalf("unmarshal %s: %v", body, err)
+		}
+		if data.TotalAmount != "990" {
+			t.Errorf("%s: TotalAmount = %q, want 990", body, data.TotalAmount)
+		}
+	}
+	var data QueryData
+	if err := json.Unmarshal([]byte(`{"total_amount":true}`), &data); err == nil {
+		t.Error("unmarshal boolean total_amount succeeded, want error")
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// GetDonorRank 获取捐款人在累计金额排行中的名次（按支付配置和分类过滤）
+// 名次 = 累计金额严格大于该捐款人的人数 + 1；匿名或没有已完成捐款时返回0；只统计当前活动周期
+func (ps *PaymentService) GetDonorRank(openid string, paymentConfigID string, categoryID string) (int64, float64, error) {
+	if openid == "" || openid == "anonymous" {
+		return 0, 0, nil
+	}
+
+	conditions := []string{"status = ?"}
+	args := []interface{}{"completed"}
+	if paymentConfigID != "" {
+		conditions = append(conditions, "payment_config_id = ?")
+		args = append(args, paymentConfigID)
+	}
+	if categoryID != "" {
+		conditions = append(conditions, "categories = ?")
+		args = append(args, categoryID)
+	}
+	if start, ok := campaignStart(paymentConfigID, categoryID); ok {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, start)
+	}
+	filter := strings.Join(conditions, " AND ")
+
+	// 单条查询：当前捐款人的累计金额，左连接累计金额更高的其他捐款人并计数
+	sql := "SELECT mine.total AS total, COUNT(higher.openid) AS higher FROM " +
+		"(SELECT COALESCE(SUM(" + netAmountCentsSQL + "), 0) AS total FROM donations WHERE " + filter + " AND openid = ?) mine " +
+		"LEFT JOIN (SELECT openid, SUM(" + netAmountCentsSQL + ") AS total FROM donations WHERE " + filter + " AND openid <> 'anonymous' GROUP BY openid) higher " +
+		"ON higher.total > mine.total GROUP BY mine.total"
+
+	queryArgs := append(append(append([]interface{}{}, args...), openid), args...)
+	var result struct {
+		Total  int64 // 累计金额（分）
+		Higher int64
+	}
+	if err := utils.Reader().Raw(sql, queryArgs...).Scan(&result).Error; err != nil {
+		return 0, 0, err
+	}
+
+	if result.Total <= 0 {
+		return 0, 0, nil
+	}
+	return result.Higher + 1, float64(result.Total) / 100, nil
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
+)
+
+// setupRankingsDB 为每个测试创建独立的内存SQLite数据库并替换utils.DB
+func setupRankingsDB(t *testing.T) {
+	t.Helper()
+	t.Cleanup(utils.InitTestDB())
+}
+
+func mustCreate(t *testing.T, value interface{}) {
+	t.Helper()
+	if err := utils.DB.Create(value).Error; err != nil {
+		t.Fatalf("seed %T: %v", value, err)
+	}
+}
+
+// seedRankings 写入覆盖各种关联情况的捐款记录，created_at递减以固定排序
+func seedRankings(t *testing.T) {
+	t.Helper()
+
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1", Payment: "1"})
+	mustCreate(t, &models.WechatUser{OpenID: "wx_user", Nickname: "微信施主", AvatarURL: "https://example.com/wx.png"})
+	mustCreate(t, &models.AlipayUser{UserID: "ali_user", Nickname: "支付宝施主", AvatarURL: "https://example.com/ali.png"})
+	mustCreate(t, &models.WechatUser{OpenID: "wx_no_avatar", Nickname: "无头像"})
+
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	donations := []models.Donation{
+		{OpenID: "wx_user", Amount: 10, Payment: "wechat", PaymentConfigID: "1", Categories: "1", Blessing: "阿弥陀佛", BlessingApproved: true, OrderID: "ORD1", Status: "completed"},
+		{OpenID: "ali_user", Amount: 20, Payment: "alipay", PaymentConfigID: "1", Categories: "1", OrderID: "ORD2", Status: "completed"},
+		{OpenID: "anonymous", Amount: 30, Payment: "wechat", PaymentConfigID: "1", Categories: "2", OrderID: "ORD3", Status: "completed"},
+		{OpenID: "wx_missing", Amount: 40, Payment: "wechat", PaymentConfigID: "2", Categories: "1", OrderID: "ORD4", Status: "completed"},
+		{OpenID: "wx_no_avatar", Amount: 50, Payment: "wechat", PaymentConfigID: "2", Categories: "99", Blessing: "待审核", BlessingApproved: false, OrderID: "ORD5", Status: "completed"},
+		{OpenID: "ali_user", Amount: 60, Payment: "alipay", PaymentConfigID: "1", Categories: "1", OrderID: "ORD6", Status: "pending"},
+		// openid属于支付宝用户但支付方式为微信，不应串表关联
+		{OpenID: "ali_user", Amount: 70, Payment: "wechat", PaymentConfigID: "1", Categories: "1", OrderID: "ORD7", Status: "completed"},
+	}
+	for i := range donations {
+		donations[i].CreatedAt = base.Add(-time.Duration(i) * time.Minute)
+		mustCreate(t, &donations[i])
+	}
+}
+
+func rankingsByOrder(items []RankingItem) map[string]RankingItem {
+	m := make(map[string]RankingItem, len(items))
+	for _, item := range items {
+		m[item.OrderID] = item
+	}
+	return m
+}
+
+func TestGetRankingsEnrichment(t *testing.T) {
+	setupRankingsDB(t)
+	seedRankings(t)
+
+	ps := NewPaymentService(ShouqianbaConfig{})
+	items, err := ps.GetRankings(10, 0, "", "", false)
+	if err != nil {
+		t.Fatalf("GetRankings: %v", err)
+	}
+
+	// 只返回已完成订单，按创建时间倒序
+	wantOrder := []string{"ORD1", "ORD2", "ORD3", "ORD4", "ORD5", "ORD7"}
+	if len(items) != len(wantOrder) {
+		t.Fatalf("got %d items, want %d", len(items), len(wantOrder))
+	}
+	for i, id := range wantOrder {
+		if items[i].OrderID != id {
+			t.Errorf("items[%d].OrderID = %s, want %s", i, items[i].OrderID, id)
+		}
+	}
+
+	tests := []struct {
+		orderID      string
+		userID       string
+		userName     string
+		avatarURL    string
+		categoryName string
+		blessing     string
+	}{
+		{"ORD1", "wx_user", "微信施主", "https://example.com/wx.png", "供灯", "阿弥陀佛"},
+		{"ORD2", "ali_user", "支付宝施主", "https://example.com/ali.png", "供灯", ""},
+		{"ORD3", "", "匿名施主", "./static/avatar.jpeg", "", ""},
+		{"ORD4", "", "匿名施主", "./static/avatar.jpeg", "供灯", ""},
+		{"ORD5", "wx_no_avatar", "无头像", "./static/avatar.jpeg", "", ""},
+		{"ORD7", "", "匿名施主", "./static/avatar.jpeg", "供灯", ""},
+	}
+
+	byOrder := rankingsByOrder(items)
+	for _, tt := range tests {
+		t.Run(tt.orderID, func(t *testing.T) {
+			item := byOrder[tt.orderID]
+			if item.UserID != tt.userID {
+				t.Errorf("UserID = %q, want %q", item.UserID, tt.userID)
+			}
+			if item.UserName != tt.userName {
+				t.Errorf("UserName = %q, want %q", item.UserName, tt.userName)
+			}
+			if item.AvatarURL != tt.avatarURL {
+				t.Errorf("AvatarURL = %q, want %q", item.AvatarURL, tt.avatarURL)
+			}
+			if item.CategoryName != tt.categoryName {
+				t.Errorf("CategoryName = %q, want %q", item.CategoryName, tt.categoryName)
+			}
+			if item.Blessing != tt.blessing {
+				t.Errorf("Blessing = %q, want %q", item.Blessing, tt.blessing)
+			}
+			if item.CategoryID != item.Categories {
+				t.Errorf("CategoryID = %q, Categories = %q, want equal", item.CategoryID, item.Categories)
+			}
+		})
+	}
+}
+
+func TestGetRankingsFilters(t *testing.T) {
+	setupRankingsDB(t)
+	seedRankings(t)
+
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	tests := []struct {
+		name            string
+		paymentConfigID string
+		categoryID      string
+		limit, offset   int
+		want            []string
+	}{
+		{"payment config", "2", "", 10, 0, []string{"ORD4", "ORD5"}},
+		{"category", "", "1", 10, 0, []string{"ORD1", "ORD2", "ORD4", "ORD7"}},
+		{"payment and category", "1", "1", 10, 0, []string{"ORD1", "ORD2", "ORD7"}},
+		{"pagination", "", "", 2, 2, []string{"ORD3", "ORD4"}},
+		{"no match", "3", "", 10, 0, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := ps.GetRankings(tt.limit, tt.offset, tt.paymentConfigID, tt.categoryID, false)
+			if err != nil {
+				t.Fatalf("GetRankings: %v", err)
+			}
+			if len(items) != len(tt.want) {
+				t.Fatalf("got %d items, want %d", len(items), len(tt.want))
+			}
+			for i, id := range tt.want {
+				if items[i].OrderID != id {
+					t.Errorf("items[%d].OrderID = %s, want %s", i, items[i].OrderID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestGetRankingsSameTimestamp(t *testing.T) {
+	setupRankingsDB(t)
+
+	// 同一秒内的捐款按id倒序，多次查询和分页结果一致
+	createdAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	for _, orderID := range []string{"ORD1", "ORD2", "ORD3", "ORD4"} {
+		mustCreate(t, &models.Donation{OpenID: "anonymous", Amount: 10, Payment: "wechat", OrderID: orderID, Status: "completed", CreatedAt: createdAt})
+	}
+
+	ps := NewPaymentService(ShouqianbaConfig{})
+	want := []string{"ORD4", "ORD3", "ORD2", "ORD1"}
+	for page := 0; page < 2; page++ {
+		items, err := ps.GetRankings(2, page*2, "", "", false)
+		if err != nil {
+			t.Fatalf("GetRankings: %v", err)
+		}
+		if len(items) != 2 {
+			t.Fatalf("page %d: got %d items, want 2", page, len(items))
+		}
+		for i, item := range items {
+			if item.OrderID != want[page*2+i] {
+				t.Errorf("page %d items[%d].OrderID = %s, want %s", page, i, item.OrderID, want[page*2+i])
+			}
+		}
+	}
+}
+
+func TestGetBlessingWall(t *testing.T) {
+	setupRankingsDB(t)
+	seedRankings(t)
+
+	ps := NewPaymentService(ShouqianbaConfig{})
+	items, err := ps.GetBlessingWall(10, "", "")
+	if err != nil {
+		t.Fatalf("GetBlessingWall: %v", err)
+	}
+
+	// 没有祝福语（ORD2等）和祝福语未审核通过（ORD5）的捐款不返回
+	if len(items) != 1 || items[0].OrderID != "ORD1" {
+		t.Fatalf("got %d items, want only ORD1", len(items))
+	}
+	if items[0].Blessing != "阿弥陀佛" {
+		t.Errorf("Blessing = %q, want %q", items[0].Blessing, "阿弥陀佛")
+	}
+}
+
+// 退款降低分类合计，全部退款的捐款默认不在排行榜中
+func TestRefundLowersCategoryTotalAndHidesFromRanking(t *testing.T) {
+	setupRankingsDB(t)
+
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯", PaymentConfigID: "1", Payment: "1"})
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	donations := []models.Donation{
+		{OpenID: "anonymous", Amount: 10, AmountCents: 1000, Payment: "wechat", PaymentConfigID: "1", Categories: "1", OrderID: "ORD1", Status: "completed"},
+		// 部分退款，仍为已完成
+		{OpenID: "wx_user", Amount: 20, AmountCents: 2000, RefundedAmount: 5, Payment: "wechat", PaymentConfigID: "1", Categories: "1", OrderID: "ORD2", Status: "completed"},
+		{OpenID: "anonymous", Amount: 30, AmountCents: 3000, RefundedAmount: 30, Payment: "wechat", PaymentConfigID: "1", Categories: "1", OrderID: "ORD3", Status: "refunded"},
+	}
+	for i := range donations {
+		donations[i].CreatedAt = base.Add(-time.Duration(i) * time.Minute)
+		mustCreate(t, &donations[i])
+	}
+
+	ps := NewPaymentService(ShouqianbaConfig{})
+	overviews, err := ps.GetCategoryOverview("")
+	if err != nil {
+		t.Fatalf("GetCategoryOverview: %v", err)
+	}
+	if len(overviews) != 1 || overviews[0].TotalAmount != 25 || overviews[0].DonationCount != 2 {
+		t.Fatalf("category overview = %+v, want total 25 from 2 donations", overviews)
+	}
+
+	// 我的名次和每日报告同样扣除部分退款
+	if _, total, err := ps.GetDonorRank("wx_user", "", ""); err != nil || total != 15 {
+		t.Errorf("GetDonorRank total = %v, %v, want 15", total, err)
+	}
+	summary, err := ps.BuildDailySummary("2026-01-01")
+	if err != nil {
+		t.Fatalf("BuildDailySummary: %v", err)
+	}
+	if summary.TotalCents != 2500 || len(summary.Categories) != 1 || summary.Categories[0].TotalAmount != 25 {
+		t.Errorf("daily summary = %+v, want total 2500 cents", summary)
+	}
+
+	items, err := ps.GetRankings(10, 0, "", "", false)
+	if err != nil {
+		t.Fatalf("GetRankings: %v", err)
+	}
+	if _, ok := rankingsByOrder(items)["ORD3"]; ok || len(items) != 2 {
+		t.Errorf("default rankings returned %d items, want 2 without refunded ORD3", len(items))
+	}
+
+	items, err = ps.GetRankings(10, 0, "", "", true)
+	if err != nil {
+		t.Fatalf("GetRankings include refunded: %v", err)
+	}
+	byOrder := rankingsByOrder(items)
+	if len(items) != 3 || !byOrder["ORD3"].Refunded || byOrder["ORD2"].Refunded {
+		t.Errorf("rankings with refunded = %+v, want ORD3 marked refunded", items)
+	}
+}
+
+// countQueries 统计fn执行期间的查询语句数
+func countQueries(t *testing.T, fn func()) int64 {
+	t.Helper()
+	var count int64
+	name := fmt.Sprintf("test:count_queries_%d", time.Now().UnixNano())
+	if err := utils.DB.Callback().Query().After("gorm:query").Register(name, func(*gorm.DB) {
+		atomic.AddInt64(&count, 1)
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	defer utils.DB.Callback().Query().Remove(name)
+	fn()
+	return atomic.LoadInt64(&count)
+}
+
+func TestBuildRankingItemsBatchesLookupsAcrossScopes(t *testing.T) {
+	setupRankingsDB(t)
+
+	// 多个支付配置、类目和两种支付方式混合，每种关联只查询一次
+	var donations []models.Donation
+	for config := 1; config <= 3; config++ {
+		configID := fmt.Sprint(config)
+		mustCreate(t, &models.PaymentConfig{ID: uint(config), VendorSN: "V" + configID, TerminalSN: "T" + configID, StoreName: "门店" + configID})
+		mustCreate(t, &models.Category{ID: uint(config), Name: "类目" + configID, PaymentConfigID: configID})
+		mustCreate(t, &models.WechatUser{OpenID: "wx_" + configID, Nickname: "微信" + configID})
+		mustCreate(t, &models.AlipayUser{UserID: "ali_" + configID, Nickname: "支付宝" + configID})
+		donations = append(donations,
+			models.Donation{OrderID: "W" + configID, OpenID: "wx_" + configID, Payment: "wechat", PaymentConfigID: configID, Categories: configID, Status: "completed"},
+			models.Donation{OrderID: "A" + configID, OpenID: "ali_" + configID, Payment: "alipay", PaymentConfigID: configID, Categories: configID, Status: "completed"},
+			models.Donation{OrderID: "N" + configID, OpenID: "anonymous", Payment: "wechat", PaymentConfigID: configID, Categories: configID, Status: "completed"},
+		)
+	}
+
+	var items []RankingItem
+	queries := countQueries(t, func() { items = buildRankingItems(donations) })
+	// 类目、微信用户、支付宝用户、门店名称各一次
+	if queries != 4 {
+		t.Errorf("buildRankingItems ran %d queries, want 4", queries)
+	}
+
+	byOrder := rankingsByOrder(items)
+	for config := 1; config <= 3; config++ {
+		configID := fmt.Sprint(config)
+		for orderID, userName := range map[string]string{"W" + configID: "微信" + configID, "A" + configID: "支付宝" + configID, "N" + configID: "匿名施主"} {
+			item := byOrder[orderID]
+			if item.UserName != userName || item.CategoryName != "类目"+configID || item.StoreName != "门店"+configID {
+				t.Errorf("%s: user=%q category=%q store=%q, want %q 类目%s 门店%s", orderID, item.UserName, item.CategoryName, item.StoreName, userName, configID, configID)
+			}
+		}
+	}
+}
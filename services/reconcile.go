@@ -0,0 +1,169 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// ErrReconcileRunning 已有对账任务在运行
+var ErrReconcileRunning = errors.New("reconcile job already running")
+
+// ReconcileJob 手动对账任务，补查时间窗口内待支付/状态未知的订单
+type ReconcileJob struct {
+	ID         string     `json:"job_id"`
+	Status     string     `json:"status"` // running、done、error
+	Window     string     `json:"window"`
+	Total      int        `json:"total"`     // 待补查订单数
+	Processed  int        `json:"processed"` // 已处理订单数
+	Settled    int        `json:"settled"`   // 更新为completed/failed的订单数
+	Failed     int        `json:"failed"`    // 查询失败的订单数
+	Unchanged  int        `json:"unchanged"` // 状态未变化的订单数
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// reconcileJobs 手动对账任务记录，只保留最近的任务
+type reconcileJobs struct {
+	mutex   sync.Mutex
+	jobs    map[string]*ReconcileJob
+	order   []string
+	running string
+}
+
+const maxReconcileJobs = 20
+
+// StartReconcile 启动手动对账任务，返回任务快照；同一时间只允许一个任务运行
+// window为0时使用reconcile.window（默认24h）；不补查最近6分钟内创建的订单（仍在轮询中）
+// 补查间隔config: reconcile.query_interval（默认200ms），避免对网关造成压力
+func (ps *PaymentService) StartReconcile(window time.Duration) (ReconcileJob, error) {
+	if window <= 0 {
+		window = viper.GetDuration("reconcile.window")
+	}
+	if window <= 0 {
+		window = 24 * time.Hour
+	}
+
+	rj := &ps.reconcileJobs
+	rj.mutex.Lock()
+	defer rj.mutex.Unlock()
+
+	if rj.running != "" {
+		return *rj.jobs[rj.running], ErrReconcileRunning
+	}
+
+	job := &ReconcileJob{
+		ID:        utils.GenerateConnID(),
+		Status:    "running",
+		Window:    window.String(),
+		StartedAt: time.Now(),
+	}
+	if rj.jobs == nil {
+		rj.jobs = make(map[string]*ReconcileJob)
+	}
+	rj.jobs[job.ID] = job
+	rj.order = append(rj.order, job.ID)
+	if len(rj.order) > maxReconcileJobs {
+		delete(rj.jobs, rj.order[0])
+		rj.order = rj.order[1:]
+	}
+	rj.running = job.ID
+
+	go ps.runReconcile(job, window)
+	return *job, nil
+}
+
+// GetReconcileJob 获取对账任务快照
+func (ps *PaymentService) GetReconcileJob(id string) (ReconcileJob, bool) {
+	rj := &ps.reconcileJobs
+	rj.mutex.Lock()
+	defer rj.mutex.Unlock()
+
+	job, ok := rj.jobs[id]
+	if !ok {
+		return ReconcileJob{}, false
+	}
+	return *job, true
+}
+
+// runReconcile 执行对账任务，逐个补查订单并更新状态；已是最终状态的订单不会被改回
+func (ps *PaymentService) runReconcile(job *ReconcileJob, window time.Duration) {
+	rj := &ps.reconcileJobs
+	update := func(fn func()) {
+		rj.mutex.Lock()
+		fn()
+		rj.mutex.Unlock()
+	}
+	defer update(func() {
+		now := time.Now()
+		job.FinishedAt = &now
+		if job.Status == "running" {
+			job.Status = "done"
+		}
+		rj.running = ""
+	})
+
+	var donations []models.Donation
+	now := time.Now()
+	if err := utils.DB.Where("status IN ? AND created_at BETWEEN ? AND ?", []string{"pending", "unknown"}, now.Add(-window), now.Add(-6*time.Minute)).
+		Order("created_at asc").Find(&donations).Error; err != nil {
+		log.Printf("Reconcile job %s: failed to load pending orders: %v", job.ID, err)
+		update(func() {
+			job.Status = "error"
+			job.Error = err.Error()
+		})
+		return
+	}
+	update(func() { job.Total = len(donations) })
+	log.Printf("Reconcile job %s started: window=%v, orders=%d", job.ID, window, len(donations))
+
+	interval := viper.GetDuration("reconcile.query_interval")
+	if interval <= 0 {
+		interval = 200 * time.Millisecond
+	}
+
+	for i, donation := range donations {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		settled, err := ps.reconcileOrder(donation.OrderID)
+		update(func() {
+			job.Processed++
+			switch {
+			case err != nil:
+				job.Failed++
+			case settled:
+				job.Settled++
+			default:
+				job.Unchanged++
+			}
+		})
+	}
+
+	update(func() {
+		log.Printf("Reconcile job %s finished: total=%d, settled=%d, failed=%d, unchanged=%d", job.ID, job.Total, job.Settled, job.Failed, job.Unchanged)
+	})
+}
+
+// reconcileOrder 补查单个订单，订单已更新为completed/failed时返回true
+// 查询期间订单可能已由回调更新为最终状态，状态条件放在UPDATE中，不再使用查询结果覆盖
+func (ps *PaymentService) reconcileOrder(orderID string) (bool, error) {
+	result, err := ps.QueryOrder(orderID)
+	if err != nil {
+		log.Printf("Reconcile: query order %s failed: %v", orderID, err)
+		return false, err
+	}
+
+	updated, status := ps.updateOrderStatusFromQuery(orderID, result, "pending", "unknown")
+	if updated && (status == "completed" || status == "failed") {
+		log.Printf("Reconcile: order %s status updated to %s", orderID, status)
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestBuildSuccessRedirectURL(t *testing.T) {
+	viper.Set("redirect.allowed_hosts", []string{"thanks.example.org"})
+	t.Cleanup(func() { viper.Set("redirect.allowed_hosts", nil) })
+
+	tests := []struct {
+		successURL, paymentConfigID, categoryID string
+		want                                    string
+		ok                                      bool
+	}{
+		// 已有查询参数时保留原参数并追加payment和categories
+		{"https://example.com/thanks?from=wx&payment=9", "2", "1", "https://example.com/thanks?categories=1&from=wx&payment=2", true},
+		{"https://thanks.example.org/done?lang=zh", "2", "", "https://thanks.example.org/done?lang=zh&payment=2", true},
+		// 没有查询参数时新建
+		{"https://example.com/thanks", "2", "1", "https://example.com/thanks?categories=1&payment=2", true},
+		{"https://example.com/thanks", "", "", "https://example.com/thanks", true},
+		// 站内相对路径使用当前域名
+		{"/thanks", "2", "1", "http://example.com/thanks?categories=1&payment=2", true},
+		{"/thanks?from=wx", "2", "", "http://example.com/thanks?from=wx&payment=2", true},
+		// 不在白名单中的地址不跳转
+		{"https://evil.example.net/thanks", "2", "1", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := buildSuccessRedirectURL(tt.successURL, "example.com", tt.paymentConfigID, tt.categoryID)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("buildSuccessRedirectURL(%q, %q, %q) = %q, %t, want %q, %t", tt.successURL, tt.paymentConfigID, tt.categoryID, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// ReenrichResult 补全历史捐款捐款人的结果
+type ReenrichResult struct {
+	Scanned int `json:"scanned"` // 缺少openid但有回调payer_uid的已完成捐款数
+	Updated int `json:"updated"` // 已关联到用户的捐款数
+	Skipped int `json:"skipped"` // payer_uid没有对应用户，保持不变的捐款数
+}
+
+// ReenrichDonations 补全历史捐款的捐款人：openid为空的已完成捐款，payer_uid已有对应的用户时将openid设为payer_uid
+// 排行榜读取时实时关联用户表，关联后即显示授权后的昵称和头像；openid为"anonymous"的捐款（未授权或选择匿名）不会被改写
+func (ps *PaymentService) ReenrichDonations() (ReenrichResult, error) {
+	var result ReenrichResult
+	var donations []models.Donation
+	if err := utils.DB.Select("id", "payment", "payer_uid", "payment_config_id").
+		Where("status = ? AND openid = ? AND payer_uid <> ?", "completed", "", "").
+		Find(&donations).Error; err != nil {
+		return result, err
+	}
+	result.Scanned = len(donations)
+
+	configs := make(map[string]bool)
+	for _, donation := range donations {
+		var count int64
+		switch donation.Payment {
+		case "wechat":
+			utils.DB.Model(&models.WechatUser{}).Where("open_id = ?", donation.PayerUID).Count(&count)
+		case "alipay":
+			utils.DB.Model(&models.AlipayUser{}).Where("user_id = ?", donation.PayerUID).Count(&count)
+		}
+		if count == 0 {
+			result.Skipped++
+			continue
+		}
+
+		if err := utils.DB.Model(&models.Donation{}).Where("id = ? AND openid = ?", donation.ID, "").
+			Update("openid", donation.PayerUID).Error; err != nil {
+			return result, err
+		}
+		result.Updated++
+		configs[donation.PaymentConfigID] = true
+	}
+
+	for paymentConfigID := range configs {
+		ps.invalidateRankingsCache(paymentConfigID)
+	}
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestReenrichDonationsLinksUserThatArrivedLater(t *testing.T) {
+	setupRankingsDB(t)
+	ps := NewPaymentService(ShouqianbaConfig{})
+	// 回调记录了payer_uid，但下单时用户尚未授权，openid为空
+	mustCreate(t, &models.Donation{Amount: 10, Payment: "wechat", PaymentConfigID: "1", PayerUID: "wx_late", OrderID: "ORD1", Status: "completed"})
+	mustCreate(t, &models.Donation{Amount: 20, Payment: "alipay", PaymentConfigID: "1", PayerUID: "ali_late", OrderID: "ORD2", Status: "completed"})
+	// 选择匿名的捐款即使payer_uid有对应用户也保持匿名
+	mustCreate(t, &models.Donation{OpenID: "anonymous", Amount: 30, Payment: "wechat", PaymentConfigID: "1", PayerUID: "wx_late", OrderID: "ORD3", Status: "completed"})
+
+	// 用户尚未授权时保持不变
+	result, err := ps.ReenrichDonations()
+	if err != nil {
+		t.Fatalf("ReenrichDonations: %v", err)
+	}
+	if result != (ReenrichResult{Scanned: 2, Updated: 0, Skipped: 2}) {
+		t.Errorf("first run = %+v, want 2 scanned and skipped", result)
+	}
+
+	// 用户之后授权，再次补全时关联到捐款
+	mustCreate(t, &models.WechatUser{OpenID: "wx_late", Nickname: "后来的微信施主"})
+	mustCreate(t, &models.AlipayUser{UserID: "ali_late", Nickname: "后来的支付宝施主"})
+	result, err = ps.ReenrichDonations()
+	if err != nil {
+		t.Fatalf("ReenrichDonations: %v", err)
+	}
+	if result != (ReenrichResult{Scanned: 2, Updated: 2, Skipped: 0}) {
+		t.Errorf("second run = %+v, want 2 updated", result)
+	}
+
+	items, err := ps.GetRankings(10, 0, "1", "", false)
+	if err != nil {
+		t.Fatalf("GetRankings: %v", err)
+	}
+	byOrder := rankingsByOrder(items)
+	for orderID, want := range map[string]string{"ORD1": "后来的微信施主", "ORD2": "后来的支付宝施主", "ORD3": "匿名施主"} {
+		if got := byOrder[orderID].UserName; got != want {
+			t.Errorf("%s user name = %q, want %q", orderID, got, want)
+		}
+	}
+
+	// 已关联的捐款不再重复扫描
+	result, err = ps.ReenrichDonations()
+	if err != nil {
+		t.Fatalf("ReenrichDonations: %v", err)
+	}
+	if result != (ReenrichResult{}) {
+		t.Errorf("third run = %+v, want nothing to do", result)
+	}
+}
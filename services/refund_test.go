@@ -0,0 +1,166 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// newRefundGateway 模拟网关退款接口，delay用于让并发请求在网关调用期间重叠
+func newRefundGateway(t *testing.T, calls *int32, delay time.Duration) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result_code":"200","biz_response":{"result_code":"REFUND_SUCCESS"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newRefundService(apiURL string) *PaymentService {
+	return NewPaymentService(ShouqianbaConfig{APIURL: apiURL, GatewayURL: apiURL, TerminalSN: "T1", TerminalKey: "key"})
+}
+
+func TestRefundOrderConcurrentRefundsOnce(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, AmountCents: 1000, Payment: "wechat", Status: "completed"})
+	var calls int32
+	ps := newRefundService(newRefundGateway(t, &calls, 50*time.Millisecond).URL)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = ps.RefundOrder("ORD1", 0, false)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("got %d successful refunds (errs=%v), want 1", succeeded, errs)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("gateway called %d times, want 1", n)
+	}
+
+	var donation models.Donation
+	utils.DB.Where("order_id = ?", "ORD1").First(&donation)
+	if donation.RefundedAmount != 10 || donation.Status != "refunded" {
+		t.Errorf("donation refunded_amount=%v status=%s, want 10 refunded", donation.RefundedAmount, donation.Status)
+	}
+}
+
+func TestRefundOrderReleasesClaimOnGatewayFailure(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, AmountCents: 1000, Payment: "wechat", Status: "completed"})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result_code":"400","error_message":"余额不足"}`))
+	}))
+	defer gateway.Close()
+	ps := newRefundService(gateway.URL)
+
+	if _, err := ps.RefundOrder("ORD1", 4, false); err == nil {
+		t.Fatal("RefundOrder succeeded, want gateway error")
+	}
+
+	var donation models.Donation
+	utils.DB.Where("order_id = ?", "ORD1").First(&donation)
+	if donation.RefundedAmount != 0 || donation.Status != "completed" {
+		t.Errorf("donation refunded_amount=%v status=%s, want claim released", donation.RefundedAmount, donation.Status)
+	}
+}
+
+func TestRefundOrderClientSNUnique(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, AmountCents: 1000, Payment: "wechat", Status: "completed"})
+	mustCreate(t, &models.Donation{OrderID: "ORD2", Amount: 10, AmountCents: 1000, Payment: "wechat", Status: "completed"})
+	var calls int32
+	ps := newRefundService(newRefundGateway(t, &calls, 0).URL)
+
+	// 同一秒内对不同订单退款，退款流水号不能重复
+	seen := make(map[string]bool)
+	for _, orderID := range []string{"ORD1", "ORD2"} {
+		result, err := ps.RefundOrder(orderID, 1, false)
+		if err != nil {
+			t.Fatalf("RefundOrder(%s): %v", orderID, err)
+		}
+		if seen[result.ClientSN] {
+			t.Errorf("client_sn %s reused", result.ClientSN)
+		}
+		seen[result.ClientSN] = true
+	}
+}
+
+func TestRefundOrderCents(t *testing.T) {
+	tests := []struct {
+		name        string
+		donation    models.Donation
+		amount      float64
+		wantCents   int64
+		wantRemains float64
+	}{
+		// 0.29*100=28.999...，不能少退1分
+		{"full 0.29", models.Donation{Amount: 0.29, AmountCents: 29}, 0, 29, 0},
+		{"full 0.29 without amount_cents", models.Donation{Amount: 0.29}, 0, 29, 0},
+		{"partial 0.29", models.Donation{Amount: 1.1, AmountCents: 110}, 0.29, 29, 0.81},
+		{"full 1.1", models.Donation{Amount: 1.1, AmountCents: 110}, 0, 110, 0},
+		{"partial 1.1 after refund", models.Donation{Amount: 2.2, AmountCents: 220, RefundedAmount: 1.1}, 1.1, 110, 0},
+		// 2.675与下单时一样按ToCents换算，全额退款金额与订单金额（分）一致
+		{"full 2.675", models.Donation{Amount: 2.675, AmountCents: ToCents(2.675)}, 0, ToCents(2.675), 0},
+		{"partial 2.675", models.Donation{Amount: 5, AmountCents: 500}, 2.675, ToCents(2.675), float64(500-ToCents(2.675)) / 100},
+		// 全额退款包含随捐款一并支付的手续费
+		{"full with fee", models.Donation{Amount: 10, AmountCents: 1000, Fee: 0.3}, 0, 1030, 0},
+		{"explicit full with fee", models.Donation{Amount: 10, AmountCents: 1000, Fee: 0.3}, 10.3, 1030, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupRankingsDB(t)
+			donation := tt.donation
+			donation.OrderID, donation.Payment, donation.Status = "ORD1", "wechat", "completed"
+			mustCreate(t, &donation)
+			ps := newRefundService("http://gateway.invalid")
+
+			result, err := ps.RefundOrder("ORD1", tt.amount, true)
+			if err != nil {
+				t.Fatalf("RefundOrder: %v", err)
+			}
+			if result.RefundAmountCents != tt.wantCents || result.Params["refund_amount"] != strconv.FormatInt(tt.wantCents, 10) {
+				t.Errorf("refund cents = %d (param %v), want %d", result.RefundAmountCents, result.Params["refund_amount"], tt.wantCents)
+			}
+			if ToCents(result.RemainingRefundable) != ToCents(tt.wantRemains) {
+				t.Errorf("remaining = %v, want %v", result.RemainingRefundable, tt.wantRemains)
+			}
+		})
+	}
+}
+
+func TestRefundOrderRejectsMoreThanRefundable(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Donation{OrderID: "ORD1", Amount: 10, AmountCents: 1000, Fee: 0.3, RefundedAmount: 0.29, Payment: "wechat", Status: "completed"})
+	ps := newRefundService("http://gateway.invalid")
+
+	if _, err := ps.RefundOrder("ORD1", 10.02, true); err == nil {
+		t.Error("refund of 10.02 with 10.01 refundable allowed, want error")
+	}
+	if result, err := ps.RefundOrder("ORD1", 10.01, true); err != nil || result.RefundAmountCents != 1001 {
+		t.Errorf("refund of remaining 10.01 = %+v, %v, want 1001 cents", result, err)
+	}
+}
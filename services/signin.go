@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm/clause"
+)
+
+// StartupSignIn 启动时终端签到，失败时按退避重试；重试用尽仍失败则转入后台定期重试，直到签到成功
+// config: signin.startup_attempts（默认3）、signin.startup_backoff（首次重试间隔，默认2s，每次翻倍）、
+// signin.retry_interval（后台重试间隔，默认1m，每次翻倍，最长30m）
+// 返回启动时的签到结果（用于启动自检汇总），转入后台重试时返回最后一次的错误
+func (ps *PaymentService) StartupSignIn() error {
+	attempts := viper.GetInt("signin.startup_attempts")
+	if attempts <= 0 {
+		attempts = 3
+	}
+	backoff := viper.GetDuration("signin.startup_backoff")
+	if backoff <= 0 {
+		backoff = 2 * time.Second
+	}
+
+	terminalSN := ps.Config().TerminalSN
+	err := ps.signInWithRetry(attempts, backoff)
+	if err == nil {
+		log.Printf("Terminal sign-in successful: %s", terminalSN)
+		return nil
+	}
+	if errors.Is(err, ErrTerminalNotActivated) {
+		log.Printf("Terminal sign-in skipped for %s: %v", terminalSN, err)
+		return err
+	}
+
+	interval := viper.GetDuration("signin.retry_interval")
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	log.Printf("Warning: Terminal sign-in failed for %s after %d attempts: %v, retrying in background every %v", terminalSN, attempts, err, interval)
+	ps.alertSignInFailure("", terminalSN, err)
+	go ps.retrySignIn(interval)
+	return err
+}
+
+// signInWithRetry 签到，失败时最多尝试attempts次，间隔从backoff开始翻倍；终端未激活时不重试
+func (ps *PaymentService) signInWithRetry(attempts int, backoff time.Duration) error {
+	var err error
+	for i := 1; i <= attempts; i++ {
+		if err = ps.SignIn(); err == nil || errors.Is(err, ErrTerminalNotActivated) {
+			return err
+		}
+		if i < attempts {
+			log.Printf("Terminal sign-in attempt %d/%d failed: %v, retrying in %v", i, attempts, err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+// retrySignIn 后台重试签到直到成功
+func (ps *PaymentService) retrySignIn(interval time.Duration) {
+	const maxInterval = 30 * time.Minute
+	for attempt := 1; ; attempt++ {
+		time.Sleep(interval)
+		err := ps.SignIn()
+		if err == nil {
+			log.Printf("Terminal sign-in successful for %s after %d background attempts", ps.Config().TerminalSN, attempt)
+			return
+		}
+		log.Printf("Warning: Background terminal sign-in attempt %d failed: %v", attempt, err)
+		ps.alertSignInFailure("", ps.Config().TerminalSN, err)
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// saveSignInConfig 保存签到后的支付配置，以唯一列upsert，多个实例同时签到同一终端时只保留一行
+// 先将同一终端（签到可能返回新的terminal_sn，按原编号匹配）或同一开发者（vendor_sn唯一）的已有记录改为新的终端编号，
+// 再按terminal_sn插入，冲突时更新已有记录；只更新非空字段，网关未返回的门店名等不会被清空
+func saveSignInConfig(previousTerminalSN string, paymentConfig models.PaymentConfig) error {
+	var conditions []string
+	var args []interface{}
+	if previousTerminalSN != "" && previousTerminalSN != paymentConfig.TerminalSN {
+		conditions = append(conditions, "terminal_sn = ?")
+		args = append(args, previousTerminalSN)
+	}
+	if paymentConfig.VendorSN != "" {
+		conditions = append(conditions, "vendor_sn = ?")
+		args = append(args, paymentConfig.VendorSN)
+	}
+	if len(conditions) > 0 {
+		if err := utils.DB.Model(&models.PaymentConfig{}).
+			Where("terminal_sn <> ?", paymentConfig.TerminalSN).
+			Where(strings.Join(conditions, " OR "), args...).
+			Update("terminal_sn", paymentConfig.TerminalSN).Error; err != nil {
+			return err
+		}
+	}
+
+	return utils.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "terminal_sn"}},
+		DoUpdates: clause.AssignmentColumns(signInUpdateColumns(paymentConfig)),
+	}).Create(&paymentConfig).Error
+}
+
+// signInUpdateColumns 签到upsert冲突时更新的列：非空的字符串字段及激活状态、签到时间
+func signInUpdateColumns(paymentConfig models.PaymentConfig) []string {
+	fields := []struct {
+		column string
+		value  string
+	}{
+		{"vendor_key", paymentConfig.VendorKey},
+		{"app_id", paymentConfig.AppID},
+		{"terminal_key", paymentConfig.TerminalKey},
+		{"merchant_sn", paymentConfig.MerchantSN},
+		{"merchant_name", paymentConfig.MerchantName},
+		{"store_sn", paymentConfig.StoreSN},
+		{"store_name", paymentConfig.StoreName},
+		{"device_id", paymentConfig.DeviceID},
+		{"api_url", paymentConfig.APIURL},
+		{"gateway_url", paymentConfig.GatewayURL},
+		{"merchant_id", paymentConfig.MerchantID},
+		{"store_id", paymentConfig.StoreID},
+	}
+	columns := []string{"is_active", "last_sign_in_at", "updated_at"}
+	for _, f := range fields {
+		if f.value != "" {
+			columns = append(columns, f.column)
+		}
+	}
+	return columns
+}
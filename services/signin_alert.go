@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// signInAlerts 签到失败告警的节流，key为支付配置ID（未知时为终端编号），value为上次告警时间
+type signInAlerts struct {
+	mutex  sync.Mutex
+	sentAt map[string]time.Time
+}
+
+// SignInAlert 签到失败告警内容，终端编号已脱敏
+type SignInAlert struct {
+	Type            string    `json:"type"` // signin_failed
+	PaymentConfigID string    `json:"payment_config_id"`
+	TerminalSN      string    `json:"terminal_sn"`
+	Error           string    `json:"error"`
+	Time            time.Time `json:"time"`
+}
+
+// alertSignInFailure 启动签到、后台重试签到或每日签到失败时发送告警到alerts.webhook_url，终端未激活不告警
+// 同一配置在alerts.signin_throttle（默认1h）内只告警一次；paymentConfigID为空时按终端编号查找配置ID
+// config: alerts.webhook_url（默认为空，不告警）、alerts.signin_throttle
+func (ps *PaymentService) alertSignInFailure(paymentConfigID string, terminalSN string, err error) {
+	webhookURL := viper.GetString("alerts.webhook_url")
+	if webhookURL == "" || errors.Is(err, ErrTerminalNotActivated) {
+		return
+	}
+
+	if paymentConfigID == "" && terminalSN != "" && utils.DB != nil {
+		var config models.PaymentConfig
+		if utils.DB.Select("id").Where("terminal_sn = ?", terminalSN).First(&config).Error == nil {
+			paymentConfigID = strconv.FormatUint(uint64(config.ID), 10)
+		}
+	}
+	key := paymentConfigID
+	if key == "" {
+		key = terminalSN
+	}
+	if !ps.signInAlerts.allow(key) {
+		return
+	}
+
+	alert := SignInAlert{
+		Type:            "signin_failed",
+		PaymentConfigID: paymentConfigID,
+		TerminalSN:      maskSecret(terminalSN),
+		Error:           err.Error(),
+		Time:            time.Now(),
+	}
+	go func() {
+		if err := postWebhook(webhookURL, alert); err != nil {
+			log.Printf("Warning: Failed to send sign-in alert for config %s: %v", key, err)
+			return
+		}
+		log.Printf("Sign-in failure alert sent for config %s", key)
+	}()
+}
+
+// allow 同一配置在alerts.signin_throttle内只允许告警一次
+func (a *signInAlerts) allow(key string) bool {
+	throttle := viper.GetDuration("alerts.signin_throttle")
+	if throttle <= 0 {
+		throttle = time.Hour
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	if a.sentAt == nil {
+		a.sentAt = make(map[string]time.Time)
+	}
+	if last, ok := a.sentAt[key]; ok && now.Sub(last) < throttle {
+		return false
+	}
+	a.sentAt[key] = now
+	return true
+}
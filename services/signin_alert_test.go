@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestSignInAlertsThrottle(t *testing.T) {
+	viper.Set("alerts.signin_throttle", "1h")
+	t.Cleanup(func() { viper.Set("alerts.signin_throttle", "") })
+	var a signInAlerts
+
+	if !a.allow("1") {
+		t.Fatal("first alert throttled, want allowed")
+	}
+	for i := 0; i < 3; i++ {
+		if a.allow("1") {
+			t.Errorf("repeated alert #%d within throttle allowed, want throttled", i)
+		}
+	}
+	// 节流按配置区分
+	if !a.allow("2") {
+		t.Error("alert for another config throttled, want allowed")
+	}
+
+	// 超过节流时间后再次告警
+	a.mutex.Lock()
+	a.sentAt["1"] = time.Now().Add(-2 * time.Hour)
+	a.mutex.Unlock()
+	if !a.allow("1") {
+		t.Error("alert after throttle window throttled, want allowed")
+	}
+	if a.allow("1") {
+		t.Error("alert right after re-alerting allowed, want throttled")
+	}
+}
+
+func TestSignInAlertsDefaultThrottle(t *testing.T) {
+	var a signInAlerts
+	a.allow("1")
+	a.mutex.Lock()
+	a.sentAt["1"] = time.Now().Add(-59 * time.Minute)
+	a.mutex.Unlock()
+	if a.allow("1") {
+		t.Error("alert within default 1h throttle allowed, want throttled")
+	}
+}
+
+func TestAlertSignInFailureThrottleKey(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.PaymentConfig{ID: 3, VendorSN: "V3", TerminalSN: "T3"})
+	// 回环地址会被webhook的SSRF校验拒绝，只验证节流，不实际发送
+	viper.Set("alerts.webhook_url", "http://127.0.0.1:1/alert")
+	t.Cleanup(func() { viper.Set("alerts.webhook_url", "") })
+	ps := NewPaymentService(ShouqianbaConfig{})
+	failure := fmt.Errorf("gateway down")
+
+	sentKeys := func() map[string]bool {
+		ps.signInAlerts.mutex.Lock()
+		defer ps.signInAlerts.mutex.Unlock()
+		keys := make(map[string]bool)
+		for key := range ps.signInAlerts.sentAt {
+			keys[key] = true
+		}
+		return keys
+	}
+
+	// 终端未激活不告警，也不占用节流
+	ps.alertSignInFailure("3", "T3", fmt.Errorf("%w: code expired", ErrTerminalNotActivated))
+	if keys := sentKeys(); len(keys) != 0 {
+		t.Errorf("not-activated failure recorded alert keys %v, want none", keys)
+	}
+
+	// 未提供配置ID时按终端编号查找，与按配置ID告警共用节流
+	ps.alertSignInFailure("", "T3", failure)
+	ps.alertSignInFailure("3", "T3", failure)
+	// 找不到配置的终端按终端编号节流
+	ps.alertSignInFailure("", "T_UNKNOWN", failure)
+	if keys := sentKeys(); len(keys) != 2 || !keys["3"] || !keys["T_UNKNOWN"] {
+		t.Errorf("alert keys = %v, want config 3 and T_UNKNOWN", keys)
+	}
+	if ps.signInAlerts.allow("3") {
+		t.Error("config 3 alert not throttled after alerting by terminal SN")
+	}
+}
+
+func TestAlertSignInFailureWithoutWebhook(t *testing.T) {
+	ps := NewPaymentService(ShouqianbaConfig{})
+	ps.alertSignInFailure("1", "T1", errors.New("gateway down"))
+	if !ps.signInAlerts.allow("1") {
+		t.Error("alert without webhook consumed the throttle, want untouched")
+	}
+}
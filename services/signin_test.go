@@ -0,0 +1,205 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// newSignInGateway 模拟网关签到接口，返回新的终端密钥和门店信息
+func newSignInGateway(t *testing.T, terminalSN string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result_code":"200","biz_response":{"terminal_sn":"` + terminalSN + `","terminal_key":"new_key","store_name":"门店"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSignInConcurrentCreatesOneRow(t *testing.T) {
+	setupRankingsDB(t)
+	gateway := newSignInGateway(t, "T1")
+
+	// 模拟两个实例同时签到同一终端
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ps := NewPaymentService(ShouqianbaConfig{VendorSN: "V1", TerminalSN: "T1", TerminalKey: "old_key", APIURL: gateway.URL})
+			errs[i] = ps.SignIn()
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("sign-in %d: %v", i, err)
+		}
+	}
+
+	var configs []models.PaymentConfig
+	if err := utils.DB.Find(&configs).Error; err != nil {
+		t.Fatalf("load configs: %v", err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("got %d payment configs, want exactly 1", len(configs))
+	}
+	if configs[0].TerminalKey != "new_key" || configs[0].StoreName != "门店" {
+		t.Errorf("config = %+v, want new terminal key and store name", configs[0])
+	}
+}
+
+func TestSignInUpdatesExistingVendorConfig(t *testing.T) {
+	setupRankingsDB(t)
+	// 同一开发者已有配置（vendor_sn唯一），签到返回新的终端编号时更新该记录而不是插入失败
+	mustCreate(t, &models.PaymentConfig{VendorSN: "V1", TerminalSN: "T_OLD", TerminalKey: "old_key", StoreName: "原门店", LogoURL: "logo.png"})
+	gateway := newSignInGateway(t, "T_NEW")
+
+	ps := NewPaymentService(ShouqianbaConfig{VendorSN: "V1", TerminalSN: "T_OLD", TerminalKey: "old_key", APIURL: gateway.URL})
+	if err := ps.SignIn(); err != nil {
+		t.Fatalf("SignIn: %v", err)
+	}
+
+	var configs []models.PaymentConfig
+	if err := utils.DB.Find(&configs).Error; err != nil {
+		t.Fatalf("load configs: %v", err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("got %d payment configs, want 1", len(configs))
+	}
+	got := configs[0]
+	if got.TerminalSN != "T_NEW" || got.TerminalKey != "new_key" || got.StoreName != "门店" || got.LogoURL != "logo.png" {
+		t.Errorf("config = %+v, want renamed terminal with new key and untouched branding", got)
+	}
+}
+
+func TestSignInConfigRotatesKeyWhileRequestsRead(t *testing.T) {
+	setupRankingsDB(t)
+	gateway := newSignInGateway(t, "T1")
+	mustCreate(t, &models.PaymentConfig{ID: 2, VendorSN: "V1", TerminalSN: "T1", TerminalKey: "old_key", APIURL: gateway.URL})
+	ps := NewPaymentService(ShouqianbaConfig{VendorSN: "V1", TerminalSN: "T1", TerminalKey: "old_key", APIURL: gateway.URL})
+
+	// 签到更换密钥的同时，请求并发读取主配置和配置2
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					ps.GenerateSign(map[string]string{"a": "1"}, "terminal")
+					ps.resolveConfig("")
+					ps.loadConfig("2")
+				}
+			}
+		}()
+	}
+	result, err := ps.SignInConfig("2")
+	close(stop)
+	readers.Wait()
+	if err != nil {
+		t.Fatalf("SignInConfig: %v", err)
+	}
+
+	if !result.Rotated || result.TerminalKey == "new_key" {
+		t.Errorf("result = %+v, want rotated with masked key", result)
+	}
+	var saved models.PaymentConfig
+	utils.DB.First(&saved, 2)
+	if saved.TerminalKey != "new_key" {
+		t.Errorf("saved terminal key = %q, want new_key", saved.TerminalKey)
+	}
+	if config, err := ps.loadConfig("2"); err != nil || config.TerminalKey != "new_key" {
+		t.Errorf("loadConfig(2) = %+v, %v, want new_key", config, err)
+	}
+	// 主配置使用同一终端，同步更换
+	if key := ps.Config().TerminalKey; key != "new_key" {
+		t.Errorf("main terminal key = %q, want new_key", key)
+	}
+}
+
+// newFlakySignInGateway 模拟前failures次签到失败、之后成功的网关，返回收到的签到请求数
+func newFlakySignInGateway(t *testing.T, failures int32) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.Write([]byte(`{"result_code":"400","error_message":"gateway busy"}`))
+			return
+		}
+		w.Write([]byte(`{"result_code":"200","biz_response":{"terminal_sn":"T1","terminal_key":"new_key","store_name":"门店"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestStartupSignInRetriesUntilSuccess(t *testing.T) {
+	setupRankingsDB(t)
+	gateway, requests := newFlakySignInGateway(t, 2)
+	viper.Set("signin.startup_backoff", "1ms")
+	t.Cleanup(func() { viper.Set("signin.startup_backoff", "") })
+
+	// 前两次失败，第三次（默认尝试3次）签到成功并更新终端密钥
+	ps := NewPaymentService(ShouqianbaConfig{VendorSN: "V1", TerminalSN: "T1", TerminalKey: "old_key", APIURL: gateway.URL})
+	if err := ps.StartupSignIn(); err != nil {
+		t.Fatalf("StartupSignIn: %v", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Errorf("sign-in requests = %d, want 3", n)
+	}
+	if key := ps.Config().TerminalKey; key != "new_key" {
+		t.Errorf("terminal key = %q, want new_key", key)
+	}
+}
+
+func TestStartupSignInFallsBackToBackgroundRetry(t *testing.T) {
+	setupRankingsDB(t)
+	gateway, requests := newFlakySignInGateway(t, 2)
+	viper.Set("signin.startup_attempts", 1)
+	viper.Set("signin.startup_backoff", "1ms")
+	viper.Set("signin.retry_interval", "1ms")
+	t.Cleanup(func() {
+		viper.Set("signin.startup_attempts", 0)
+		viper.Set("signin.startup_backoff", "")
+		viper.Set("signin.retry_interval", "")
+	})
+
+	// 启动时的尝试用尽后返回错误，后台继续重试直到成功
+	ps := NewPaymentService(ShouqianbaConfig{VendorSN: "V1", TerminalSN: "T1", TerminalKey: "old_key", APIURL: gateway.URL})
+	if err := ps.StartupSignIn(); err == nil {
+		t.Fatal("StartupSignIn succeeded, want error after startup attempts")
+	}
+	// 等待新密钥保存到数据库，后台签到结束后再清理测试数据库
+	saved := func() bool {
+		var count int64
+		utils.DB.Model(&models.PaymentConfig{}).Where("terminal_sn = ? AND terminal_key = ?", "T1", "new_key").Count(&count)
+		return count == 1
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !saved() {
+		if time.Now().After(deadline) {
+			t.Fatalf("background sign-in did not succeed, requests = %d", atomic.LoadInt32(requests))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Errorf("sign-in requests = %d, want 3", n)
+	}
+	if key := ps.Config().TerminalKey; key != "new_key" {
+		t.Errorf("terminal key = %q, want new_key", key)
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// StartupReport 启动自检汇总，启动完成后记录为一行JSON，便于排查"为什么不能用"；不含任何密钥
+type StartupReport struct {
+	Database     string              `json:"database"`     // ok、failed
+	ReadReplica  string              `json:"read_replica"` // ok、failed、disabled
+	MainConfigID uint                `json:"main_config_id"`
+	Configs      []StartupConfigInfo `json:"configs"`
+	StaticDir    string              `json:"static_dir"`
+	TemplateDir  string              `json:"template_dir"`
+	PublicHost   string              `json:"public_host"`
+	ListenAddr   string              `json:"listen_addr"`
+	// 独立管理端口的监听地址，未配置admin.port时省略
+	AdminListenAddr string `json:"admin_listen_addr,omitempty"`
+}
+
+// StartupConfigInfo 启动时各支付配置的状态，终端编号已脱敏
+type StartupConfigInfo struct {
+	ID           uint      `json:"id"`
+	StoreName    string    `json:"store_name"`
+	Active       bool      `json:"active"`
+	TerminalSN   string    `json:"terminal_sn"`
+	SignIn       string    `json:"sign_in"` // 主配置：ok、skipped（终端未激活）、failed: ...；其他配置：on_demand（下单时签到）
+	LastSignInAt time.Time `json:"last_sign_in_at"`
+}
+
+// StartupConfigs 汇总数据库中的支付配置，signInErr为主配置启动签到的结果
+func StartupConfigs(mainConfigID uint, signInErr error) []StartupConfigInfo {
+	var configs []models.PaymentConfig
+	if err := utils.DB.Order("id asc").Find(&configs).Error; err != nil {
+		log.Printf("Warning: Failed to load payment configs for startup report: %v", err)
+		return nil
+	}
+
+	infos := make([]StartupConfigInfo, len(configs))
+	for i, cfg := range configs {
+		signIn := "on_demand"
+		if cfg.ID == mainConfigID {
+			switch {
+			case signInErr == nil:
+				signIn = "ok"
+			case errors.Is(signInErr, ErrTerminalNotActivated):
+				signIn = "skipped"
+			default:
+				signIn = "failed: " + signInErr.Error()
+			}
+		}
+		infos[i] = StartupConfigInfo{
+			ID:           cfg.ID,
+			StoreName:    cfg.StoreName,
+			Active:       cfg.IsActive,
+			TerminalSN:   maskSecret(cfg.TerminalSN),
+			SignIn:       signIn,
+			LastSignInAt: cfg.LastSignInAt,
+		}
+	}
+	return infos
+}
+
+// StartupPublicHost 回调和跳转地址使用的主机名：配置了server.public_host时为该值，否则取自请求Host
+func StartupPublicHost() string {
+	if host := viper.GetString("server.public_host"); host != "" {
+		return host
+	}
+	return "(request host)"
+}
+
+// StartupDir 目录存在时原样返回，不存在时标注missing
+func StartupDir(dir string) string {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return dir + " (missing)"
+	}
+	return dir
+}
+
+// Log 以一行JSON记录启动自检结果
+func (r StartupReport) Log() {
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("Warning: Failed to encode startup report: %v", err)
+		return
+	}
+	log.Printf("Startup self-check: %s", data)
+}
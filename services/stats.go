@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+// netAmountCentsSQL 扣除部分退款后的捐款金额（分），退款金额超过捐款金额（含手续费退款）时为0
+// 全部退款的订单状态为refunded，不在已完成订单的统计中
+const netAmountCentsSQL = "CASE WHEN ROUND(refunded_amount * 100) < amount_cents THEN amount_cents - ROUND(refunded_amount * 100) ELSE 0 END"
+
+// FeeStats 手续费统计（仅统计已完成订单）
+type FeeStats struct {
+	PaymentConfigID string  `json:"payment_config_id"`
+	TotalAmount     float64 `gorm:"-" json:"total_amount"` // 捐款金额合计（不含手续费）
+	TotalFee        float64 `gorm:"-" json:"total_fee"`    // 手续费合计
+	TotalCents      int64   `json:"total_cents"`           // 捐款金额合计（分），已扣除部分退款
+	FeeCents        int64   `json:"fee_cents"`             // 手续费合计（分）
+	OrderCount      int64   `json:"order_count"`
+	FeeOrderCount   int64   `json:"fee_order_count"` // 含手续费的订单数
+
+	FormattedTotalAmount string `gorm:"-" json:"formatted_total_amount"`
+	FormattedTotalFee    string `gorm:"-" json:"formatted_total_fee"`
+}
+
+// GetFeeStats 按支付配置统计手续费，paymentConfigID为空时统计全部配置
+func (ps *PaymentService) GetFeeStats(paymentConfigID string) ([]FeeStats, error) {
+	query := utils.Reader().Model(&models.Donation{}).Where("status = ?", "completed")
+	if paymentConfigID != "" {
+		query = query.Where("payment_config_id = ?", paymentConfigID)
+	}
+
+	var stats []FeeStats
+	err := query.Select("payment_config_id, " +
+		"COALESCE(SUM(" + netAmountCentsSQL + "), 0) AS total_cents, " +
+		"COALESCE(SUM(ROUND(fee * 100)), 0) AS fee_cents, " +
+		"COUNT(*) AS order_count, " +
+		"SUM(CASE WHEN fee > 0 THEN 1 ELSE 0 END) AS fee_order_count").
+		Group("payment_config_id").
+		Order("payment_config_id").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 合计以分计算，仅在展示时换算为元
+	for i := range stats {
+		stats[i].TotalAmount = float64(stats[i].TotalCents) / 100
+		stats[i].TotalFee = float64(stats[i].FeeCents) / 100
+		stats[i].FormattedTotalAmount = FormatCents(stats[i].TotalCents)
+		stats[i].FormattedTotalFee = FormatCents(stats[i].FeeCents)
+	}
+	return stats, nil
+}
+
+// DailyStats 当日已完成订单统计
+type DailyStats struct {
+	TotalAmount          float64 `gorm:"-" json:"total_amount"`
+	TotalFee             float64 `gorm:"-" json:"total_fee"`
+	TotalCents           int64   `json:"total_cents"`
+	FeeCents             int64   `json:"fee_cents"`
+	OrderCount           int64   `json:"order_count"`
+	FormattedTotalAmount string  `gorm:"-" json:"formatted_total_amount"`
+}
+
+// GetTodayStats 统计今日（服务器本地时间）已完成订单的金额（扣除部分退款）、手续费和订单数
+func (ps *PaymentService) GetTodayStats(ctx context.Context) (DailyStats, error) {
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var stats DailyStats
+	err := utils.Reader().WithContext(ctx).Model(&models.Donation{}).
+		Where("status = ? AND created_at >= ?", "completed", start).
+		Select("COALESCE(SUM(" + netAmountCentsSQL + "), 0) AS total_cents, " +
+			"COALESCE(SUM(ROUND(fee * 100)), 0) AS fee_cents, " +
+			"COUNT(*) AS order_count").
+		Scan(&stats).Error
+	if err != nil {
+		return DailyStats{}, err
+	}
+	stats.TotalAmount = float64(stats.TotalCents) / 100
+	stats.TotalFee = float64(stats.FeeCents) / 100
+	stats.FormattedTotalAmount = FormatCents(stats.TotalCents)
+	return stats, nil
+}
+
+// CountDonationsByStatus 统计指定状态的订单数
+func (ps *PaymentService) CountDonationsByStatus(ctx context.Context, status string) (int64, error) {
+	var count int64
+	err := utils.Reader().WithContext(ctx).Model(&models.Donation{}).Where("status = ?", status).Count(&count).Error
+	return count, err
+}
+
+// CountActivePaymentConfigs 统计已激活的支付配置数
+func (ps *PaymentService) CountActivePaymentConfigs(ctx context.Context) (int64, error) {
+	var count int64
+	err := utils.Reader().WithContext(ctx).Model(&models.PaymentConfig{}).Where("is_active = ?", true).Count(&count).Error
+	return count, err
+}
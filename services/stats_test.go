@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+)
+
+func TestStatsSumFractionalAmountsExactly(t *testing.T) {
+	setupRankingsDB(t)
+	mustCreate(t, &models.Category{ID: 1, Name: "供灯"})
+
+	// 0.1、0.07等金额以float64逐笔累加会产生误差，合计应与分的整数和完全一致
+	amounts := []float64{0.1, 0.07, 0.01, 19.99, 0.3}
+	var donations []models.Donation
+	var wantCents int64
+	var floatSum float64
+	for i := 0; i < 200; i++ {
+		amount := amounts[i%len(amounts)]
+		donations = append(donations, models.Donation{
+			OpenID:          "donor_a",
+			OrderID:         fmt.Sprintf("O%d", i),
+			Amount:          amount,
+			AmountCents:     ToCents(amount),
+			PaymentConfigID: "1",
+			Categories:      "1",
+			Status:          "completed",
+		})
+		wantCents += ToCents(amount)
+		floatSum += amount
+	}
+	if ToCents(floatSum) == wantCents && floatSum == float64(wantCents)/100 {
+		t.Fatalf("float sum %v is exact, test amounts do not exercise rounding error", floatSum)
+	}
+	if err := utils.DB.CreateInBatches(donations, 200).Error; err != nil {
+		t.Fatalf("seed donations: %v", err)
+	}
+	want := float64(wantCents) / 100
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	fees, err := ps.GetFeeStats("")
+	if err != nil || len(fees) != 1 {
+		t.Fatalf("GetFeeStats = %+v, %v, want one config", fees, err)
+	}
+	if fees[0].TotalCents != wantCents || fees[0].TotalAmount != want || fees[0].FormattedTotalAmount != FormatCents(wantCents) {
+		t.Errorf("GetFeeStats total = %d cents, %v, %q, want %d cents", fees[0].TotalCents, fees[0].TotalAmount, fees[0].FormattedTotalAmount, wantCents)
+	}
+
+	today, err := ps.GetTodayStats(context.Background())
+	if err != nil || today.TotalCents != wantCents || today.TotalAmount != want {
+		t.Errorf("GetTodayStats total = %d cents, %v, %v, want %d cents", today.TotalCents, today.TotalAmount, err, wantCents)
+	}
+
+	overviews, err := ps.GetCategoryOverview("")
+	if err != nil || len(overviews) != 1 || overviews[0].TotalAmount != want {
+		t.Errorf("GetCategoryOverview = %+v, %v, want total %v", overviews, err, want)
+	}
+
+	if rank, total, err := ps.GetDonorRank("donor_a", "", ""); err != nil || rank != 1 || total != want {
+		t.Errorf("GetDonorRank = %d, %v, %v, want 1, %v", rank, total, err, want)
+	}
+}
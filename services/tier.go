@@ -0,0 +1,48 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DonationTier 根据金额计算捐款档位，供前端选择不同的提示音和动画
+// 档位为金额达到的阈值个数：0为最低档，阈值按项目配置（payment_configs.tier_thresholds），
+// 未配置时使用全局配置broadcast.tier_thresholds
+func (ps *PaymentService) DonationTier(paymentConfigID string, amount float64) int {
+	thresholds := viper.GetString("broadcast.tier_thresholds")
+	if paymentConfigID != "" {
+		// 使用支付配置缓存，避免每次广播都查询数据库
+		if config, err := ps.loadConfig(paymentConfigID); err == nil && config.TierThresholds != "" {
+			thresholds = config.TierThresholds
+		}
+	}
+	return tierForAmount(parseTierThresholds(thresholds), ToCents(amount))
+}
+
+// parseTierThresholds 解析逗号分隔的金额阈值（元），转换为分，忽略无效值并升序排列
+func parseTierThresholds(s string) []int64 {
+	var thresholds []int64
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || v <= 0 {
+			continue
+		}
+		thresholds = append(thresholds, ToCents(v))
+	}
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i] < thresholds[j] })
+	return thresholds
+}
+
+// tierForAmount 返回金额（分）达到的阈值个数
+func tierForAmount(thresholds []int64, amountCents int64) int {
+	tier := 0
+	for _, t := range thresholds {
+		if amountCents >= t {
+			tier++
+		}
+	}
+	return tier
+}
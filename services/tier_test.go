@@ -0,0 +1,65 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+)
+
+func TestParseTierThresholds(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []int64
+	}{
+		{"10,100,1000", []int64{1000, 10000, 100000}},
+		{" 1000 , 10 ,100", []int64{1000, 10000, 100000}},
+		{"0.1,9.99", []int64{10, 999}},
+		{"10,abc,-5,0,,100", []int64{1000, 10000}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parseTierThresholds(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTierThresholds(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTierForAmount(t *testing.T) {
+	thresholds := parseTierThresholds("0.3,10,100")
+	tests := []struct {
+		amount float64
+		want   int
+	}{
+		{0.29, 0},
+		{0.1 + 0.2, 1}, // 0.30000000000000004，按分比较达到0.3元档
+		{9.99, 1},
+		{10, 2},
+		{99.999, 3}, // 四舍五入到分为100元
+		{1000, 3},
+	}
+	for _, tt := range tests {
+		if got := tierForAmount(thresholds, ToCents(tt.amount)); got != tt.want {
+			t.Errorf("tierForAmount(%v) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+	if got := tierForAmount(nil, 100000); got != 0 {
+		t.Errorf("tierForAmount without thresholds = %d, want 0", got)
+	}
+}
+
+func TestDonationTierUsesConfigThresholds(t *testing.T) {
+	setupRankingsDB(t)
+	viper.Set("broadcast.tier_thresholds", "10,100")
+	t.Cleanup(func() { viper.Set("broadcast.tier_thresholds", "") })
+	mustCreate(t, &models.PaymentConfig{ID: 1, VendorSN: "V1", TerminalSN: "T1", StoreName: "门店", TierThresholds: "1,2,3"})
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	if got := ps.DonationTier("1", 2); got != 2 {
+		t.Errorf("DonationTier with config thresholds = %d, want 2", got)
+	}
+	if got := ps.DonationTier("", 50); got != 1 {
+		t.Errorf("DonationTier with global thresholds = %d, want 1", got)
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenHealth 记录微信access_token和支付宝用户令牌的刷新情况，用于及早发现AppSecret错误、IP未加白名单等问题
+type tokenHealth struct {
+	mutex  sync.Mutex
+	wechat map[string]*WechatTokenStatus // key为微信AppID
+	alipay AlipayTokenStatus
+}
+
+// WechatTokenStatus 单个微信公众号的access_token状态（不含令牌本身）
+type WechatTokenStatus struct {
+	AppID         string     `json:"app_id"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	LastRefreshAt *time.Time `json:"last_refresh_at"` // 上次成功刷新时间
+	LastErrorAt   *time.Time `json:"last_error_at"`
+	LastError     string     `json:"last_error"`
+	Refreshes     int64      `json:"refreshes"`
+	Failures      int64      `json:"failures"`
+}
+
+// AlipayTokenStatus 支付宝用户令牌刷新统计
+type AlipayTokenStatus struct {
+	LastRefreshAt *time.Time `json:"last_refresh_at"`
+	LastErrorAt   *time.Time `json:"last_error_at"`
+	LastError     string     `json:"last_error"`
+	Refreshes     int64      `json:"refreshes"`
+	Failures      int64      `json:"failures"`
+}
+
+// TokenHealthStats 网关令牌刷新指标
+type TokenHealthStats struct {
+	Wechat []WechatTokenStatus `json:"wechat"`
+	Alipay AlipayTokenStatus   `json:"alipay"`
+}
+
+// recordWechat 记录一次微信access_token刷新结果，错误信息中的AppSecret会被替换
+func (th *tokenHealth) recordWechat(cfg ShouqianbaConfig, info AccessTokenInfo, err error) {
+	now := time.Now()
+
+	th.mutex.Lock()
+	defer th.mutex.Unlock()
+
+	if th.wechat == nil {
+		th.wechat = make(map[string]*WechatTokenStatus)
+	}
+	status, ok := th.wechat[cfg.WechatAppID]
+	if !ok {
+		status = &WechatTokenStatus{AppID: cfg.WechatAppID}
+		th.wechat[cfg.WechatAppID] = status
+	}
+
+	if err != nil {
+		status.Failures++
+		status.LastErrorAt = &now
+		status.LastError = redactSecret(err.Error(), cfg.WechatAppSecret)
+		return
+	}
+	expiresAt := info.ExpiresAt
+	status.Refreshes++
+	status.LastRefreshAt = &now
+	status.ExpiresAt = &expiresAt
+}
+
+// recordAlipay 记录一次支付宝用户令牌刷新结果
+func (th *tokenHealth) recordAlipay(cfg ShouqianbaConfig, err error) {
+	now := time.Now()
+
+	th.mutex.Lock()
+	defer th.mutex.Unlock()
+
+	if err != nil {
+		th.alipay.Failures++
+		th.alipay.LastErrorAt = &now
+		th.alipay.LastError = redactSecret(err.Error(), cfg.AlipayPrivateKey)
+		return
+	}
+	th.alipay.Refreshes++
+	th.alipay.LastRefreshAt = &now
+}
+
+// TokenHealthStats 获取网关令牌刷新指标
+func (ps *PaymentService) TokenHealthStats() TokenHealthStats {
+	th := &ps.tokenHealth
+	th.mutex.Lock()
+	defer th.mutex.Unlock()
+
+	stats := TokenHealthStats{Wechat: []WechatTokenStatus{}, Alipay: th.alipay}
+	for _, status := range th.wechat {
+		stats.Wechat = append(stats.Wechat, *status)
+	}
+	sort.Slice(stats.Wechat, func(i, j int) bool { return stats.Wechat[i].AppID < stats.Wechat[j].AppID })
+	return stats
+}
+
+// redactSecret 从错误信息中去除密钥（如请求URL中的secret参数）
+func redactSecret(message, secret string) string {
+	if secret == "" {
+		return message
+	}
+	return strings.ReplaceAll(message, secret, "***")
+}
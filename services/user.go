@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zhifu/donation-rank/models"
+	"github.com/zhifu/donation-rank/utils"
+	"gorm.io/gorm"
+)
+
+// ForgetUser 清除用户的个人资料和授权令牌（数据删除请求）
+// 用户行保留并改为匿名施主，捐款记录不删除，排行榜中显示为匿名
+func (ps *PaymentService) ForgetUser(payment, userID string) error {
+	if userID == "" || userID == "anonymous" {
+		return fmt.Errorf("user not authorized")
+	}
+
+	var result *gorm.DB
+	switch payment {
+	case "wechat":
+		result = utils.DB.Model(&models.WechatUser{}).Where("open_id = ?", userID).Updates(map[string]interface{}{
+			"Nickname":     "匿名施主",
+			"AvatarURL":    "",
+			"UnionID":      "",
+			"Gender":       0,
+			"Country":      "",
+			"Province":     "",
+			"City":         "",
+			"Language":     "",
+			"AccessToken":  "",
+			"RefreshToken": "",
+			"ExpiresAt":    time.Time{},
+		})
+	case "alipay":
+		result = utils.DB.Model(&models.AlipayUser{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"Nickname":     "匿名施主",
+			"AvatarURL":    "",
+			"Gender":       "",
+			"Province":     "",
+			"City":         "",
+			"AccessToken":  "",
+			"RefreshToken": "",
+			"ExpiresAt":    time.Time{},
+		})
+	default:
+		return fmt.Errorf("unsupported payment type: %s", payment)
+	}
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to clear user profile: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// shouldRefreshUserInfo 检查用户信息是否需要更新，同一用户在user.refresh_interval（默认10m）内只更新一次
+func (ps *PaymentService) shouldRefreshUserInfo(payment, openid string) bool {
+	interval := viper.GetDuration("user.refresh_interval")
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+
+	key := payment + "_" + openid
+	now := time.Now()
+
+	ps.userRefreshMutex.Lock()
+	defer ps.userRefreshMutex.Unlock()
+	if ps.userRefreshAt == nil {
+		ps.userRefreshAt = make(map[string]time.Time)
+	}
+	if last, ok := ps.userRefreshAt[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+	ps.userRefreshAt[key] = now
+	return true
+}
+
+// refreshUserInfoAsync 在后台获取最新的用户信息，昵称或头像变化时写回数据库
+// 获取失败（包括panic）只影响资料更新，下单始终使用数据库中已有的用户信息继续
+// config: user.refresh_failure_log（warn：记录openid和订单号便于排查头像缺失，默认；silent：不记录）
+func (ps *PaymentService) refreshUserInfoAsync(payment, openid, paymentConfigID, orderID string) {
+	if !ps.shouldRefreshUserInfo(payment, openid) {
+		return
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logUserInfoFailure(payment, openid, orderID, fmt.Errorf("panic: %v", r))
+			}
+		}()
+		if err := ps.refreshUserInfo(payment, openid, paymentConfigID); err != nil {
+			logUserInfoFailure(payment, openid, orderID, err)
+		}
+	}()
+}
+
+// logUserInfoFailure 按user.refresh_failure_log记录用户信息获取失败，orderID用于关联下单日志
+func logUserInfoFailure(payment, openid, orderID string, err error) {
+	if viper.GetString("user.refresh_failure_log") == "silent" {
+		return
+	}
+	log.Printf("Warning: Failed to refresh %s user info, openid=%s, order_id=%s: %v", payment, openid, orderID, err)
+}
+
+// refreshUserInfo 获取最新的用户信息并与数据库比较，变化时更新
+func (ps *PaymentService) refreshUserInfo(payment, openid, paymentConfigID string) error {
+	switch payment {
+	case "wechat":
+		userInfo, err := ps.getWechatUserInfo(openid, paymentConfigID)
+		if err != nil {
+			return err
+		}
+		var wechatUser models.WechatUser
+		if err := utils.DB.Where("open_id = ?", openid).First(&wechatUser).Error; err != nil {
+			return err
+		}
+		if userInfo["user_name"] == wechatUser.Nickname && userInfo["avatar_url"] == wechatUser.AvatarURL {
+			return nil
+		}
+		return utils.DB.Model(&wechatUser).Updates(map[string]interface{}{"nickname": userInfo["user_name"], "avatar_url": userInfo["avatar_url"]}).Error
+	case "alipay":
+		userInfo, err := ps.getAlipayUserInfo(openid, paymentConfigID)
+		if err != nil {
+			return err
+		}
+		var alipayUser models.AlipayUser
+		if err := utils.DB.Where("user_id = ?", openid).First(&alipayUser).Error; err != nil {
+			return err
+		}
+		if userInfo["user_name"] == alipayUser.Nickname && userInfo["avatar_url"] == alipayUser.AvatarURL {
+			return nil
+		}
+		return utils.DB.Model(&alipayUser).Updates(map[string]interface{}{"nickname": userInfo["user_name"], "avatar_url": userInfo["avatar_url"]}).Error
+	default:
+		return fmt.Errorf("unsupported payment type: %s", payment)
+	}
+}
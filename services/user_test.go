@@ -0,0 +1,84 @@
+package services
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestShouldRefreshUserInfoThrottlesWithinInterval(t *testing.T) {
+	viper.Set("user.refresh_interval", "1h")
+	t.Cleanup(func() { viper.Set("user.refresh_interval", "") })
+	ps := NewPaymentService(ShouqianbaConfig{})
+
+	if !ps.shouldRefreshUserInfo("wechat", "openid1") {
+		t.Fatal("first refresh throttled, want allowed")
+	}
+	if ps.shouldRefreshUserInfo("wechat", "openid1") {
+		t.Error("second refresh within interval allowed, want throttled")
+	}
+	// 节流按用户和支付方式区分
+	if !ps.shouldRefreshUserInfo("wechat", "openid2") {
+		t.Error("refresh of another user throttled, want allowed")
+	}
+	if !ps.shouldRefreshUserInfo("alipay", "openid1") {
+		t.Error("refresh of same id on another payment throttled, want allowed")
+	}
+
+	// 超过间隔后再次允许更新
+	ps.userRefreshMutex.Lock()
+	ps.userRefreshAt["wechat_openid1"] = time.Now().Add(-2 * time.Hour)
+	ps.userRefreshMutex.Unlock()
+	if !ps.shouldRefreshUserInfo("wechat", "openid1") {
+		t.Error("refresh after interval throttled, want allowed")
+	}
+}
+
+// syncBuffer 并发安全的日志缓冲，用于等待后台goroutine写出的日志
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) count(substr string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return strings.Count(b.buf.String(), substr)
+}
+
+func TestRefreshUserInfoAsyncFetchesOncePerInterval(t *testing.T) {
+	setupRankingsDB(t)
+	ps := NewPaymentService(ShouqianbaConfig{})
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// 用户不在数据库中，每次后台更新都以一条失败日志结束
+	const failure = "Failed to refresh wechat user info, openid=openid1, order_id=ORD1"
+	for i := 0; i < 5; i++ {
+		ps.refreshUserInfoAsync("wechat", "openid1", "", "ORD1")
+	}
+
+	for deadline := time.Now().Add(2 * time.Second); logs.count(failure) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh did not run")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := logs.count(failure); n != 1 {
+		t.Errorf("background refreshes = %d, want 1 within the interval", n)
+	}
+}
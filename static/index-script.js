@@ -1351,8 +1351,13 @@ function checkDonationMatch(donation, params) {
         // 支持ID匹配（如2）或文本匹配（如wechat/alipay）
         paymentMatch = false;
         
+        // 情况0：公开排行榜接口不返回payment_config_id，请求已按p参数在服务端过滤，直接视为匹配
+        if (!donationPaymentConfigId) {
+            paymentMatch = true;
+            console.log('Payment match by server-side filter');
+        }
         // 情况1：直接匹配payment_config_id
-        if (donationPaymentConfigId === paymentParam) {
+        else if (donationPaymentConfigId === paymentParam) {
             paymentMatch = true;
             console.log('Payment match by config ID:', donationPaymentConfigId, '=', paymentParam);
         }
@@ -264,6 +264,10 @@ async function loadExtraContent(params) {
                     if (result.store_name) {
                         merchantName = result.store_name;
                     }
+                    // 当前支付方式未开通时切换到可用的支付方式
+                    if (Array.isArray(result.payments) && result.payments.length > 0 && !result.payments.includes(selectedPayment)) {
+                        selectedPayment = result.payments[0];
+                    }
                     // 检查是否是类目信息
                     if (result.name) {
                         categoryName = result.name;
@@ -338,6 +342,8 @@ function initSubmitButton(elements) {
         const formCategory = document.getElementById('form-category');
         const formBlessing = document.getElementById('form-blessing');
         const formPaymentConfigId = document.getElementById('form-payment-config-id');
+        const formAnonymous = document.getElementById('form-anonymous');
+        const anonymousCheckbox = document.getElementById('anonymous');
         
         elements.submitBtn.addEventListener('click', async (e) => {
             e.preventDefault(); // 阻止默认行为
@@ -363,6 +369,7 @@ function initSubmitButton(elements) {
                 formCategory.value = params.categories || '';
                 formBlessing.value = elements.blessingTextarea.value || '';
                 formPaymentConfigId.value = params.payment || '';
+                formAnonymous.value = anonymousCheckbox && anonymousCheckbox.checked ? '1' : '';
                 
                 // 提交表单，浏览器会处理302重定向
                 form.submit();
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"log"
+	"net"
+	"strings"
+)
+
+// ParseTrustedProxies 解析受信任的代理列表，每项为CIDR（10.0.0.0/8）或单个IP，无效项记录日志并忽略
+func ParseTrustedProxies(entries []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Printf("Warning: Invalid trusted proxy %q ignored", entry)
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Warning: Invalid trusted proxy %q ignored: %v", entry, err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// ClientIP 确定真实客户端IP：直连地址是受信任的代理时，从X-Forwarded-For由右向左取第一个不受信任的地址
+// 直连地址不受信任时忽略X-Forwarded-For（可被客户端伪造）；列表中全部为受信任地址时取最左侧的地址
+func ClientIP(remote net.IP, forwardedFor string, trusted []*net.IPNet) net.IP {
+	if forwardedFor == "" || !ipTrusted(remote, trusted) {
+		return remote
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	var leftmost net.IP
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			// 无法解析的地址之前的内容不可信，返回已确认的最后一跳
+			break
+		}
+		if !ipTrusted(ip, trusted) {
+			return ip
+		}
+		leftmost = ip
+	}
+	if leftmost != nil {
+		return leftmost
+	}
+	return remote
+}
+
+// ipTrusted IP是否在受信任的代理列表中
+func ipTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.168.1.10 ", "::1", "", "not-an-ip", "10.0.0.0/99"})
+	if len(nets) != 3 {
+		t.Fatalf("ParseTrustedProxies returned %d networks, want 3 (invalid entries ignored)", len(nets))
+	}
+	for ip, want := range map[string]bool{
+		"10.1.2.3":     true,
+		"192.168.1.10": true,
+		"192.168.1.11": false,
+		"::1":          true,
+		"8.8.8.8":      false,
+	} {
+		if got := ipTrusted(net.ParseIP(ip), nets); got != want {
+			t.Errorf("ipTrusted(%s) = %t, want %t", ip, got, want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.10"})
+	tests := []struct {
+		name         string
+		remote       string
+		forwardedFor string
+		want         string
+	}{
+		{"direct client without header", "203.0.113.7", "", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2", "203.0.113.7", "203.0.113.7"},
+		{"trusted proxy without header", "10.0.0.2", "", "10.0.0.2"},
+		// 直连地址不受信任时X-Forwarded-For可被伪造，使用直连地址
+		{"spoofed header from untrusted remote", "203.0.113.7", "1.2.3.4", "203.0.113.7"},
+		{"spoofed private address from untrusted remote", "203.0.113.7", "10.0.0.5", "203.0.113.7"},
+		// 多级代理由右向左跳过受信任地址，客户端在最左侧伪造的地址被忽略
+		{"multi-hop", "10.0.0.2", "1.2.3.4, 203.0.113.7, 192.168.1.10", "203.0.113.7"},
+		{"multi-hop without spaces", "10.0.0.2", "1.2.3.4,203.0.113.7,10.9.9.9", "203.0.113.7"},
+		{"all hops trusted", "10.0.0.2", "10.0.0.9, 192.168.1.10", "10.0.0.9"},
+		// 无法解析的地址之前的内容不可信
+		{"garbage before trusted hop", "10.0.0.2", "1.2.3.4, garbage, 10.0.0.9", "10.0.0.9"},
+		{"garbage only", "10.0.0.2", "garbage", "10.0.0.2"},
+		{"ipv6 client", "10.0.0.2", "2001:db8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		got := ClientIP(net.ParseIP(tt.remote), tt.forwardedFor, trusted)
+		if !got.Equal(net.ParseIP(tt.want)) {
+			t.Errorf("%s: ClientIP(%s, %q) = %s, want %s", tt.name, tt.remote, tt.forwardedFor, got, tt.want)
+		}
+	}
+
+	// 未配置受信任代理时始终使用直连地址
+	if got := ClientIP(net.ParseIP("10.0.0.2"), "203.0.113.7", nil); !got.Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("ClientIP without trusted proxies = %s, want remote address", got)
+	}
+}
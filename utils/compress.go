@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"bytes"
+
+	"github.com/valyala/fasthttp"
+)
+
+// CompressHandler 按配置压缩响应：跳过小于minSize的响应、已压缩的响应和skipTypes中的内容类型（如image/，二维码PNG本身已压缩）
+// level为压缩级别（fasthttp.CompressDefaultCompression、CompressBestSpeed等）
+func CompressHandler(h fasthttp.RequestHandler, level, minSize int, skipTypes []string) fasthttp.RequestHandler {
+	// 使用空处理器包装fasthttp的压缩逻辑，仅对已生成的响应体进行压缩
+	compress := fasthttp.CompressHandlerLevel(func(ctx *fasthttp.RequestCtx) {}, level)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		h(ctx)
+
+		if ctx.Response.IsBodyStream() || len(ctx.Response.Header.ContentEncoding()) > 0 {
+			return
+		}
+		if len(ctx.Response.Body()) < minSize {
+			return
+		}
+		contentType := ctx.Response.Header.ContentType()
+		for _, t := range skipTypes {
+			if bytes.HasPrefix(contentType, []byte(t)) {
+				return
+			}
+		}
+
+		compress(ctx)
+	}
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// qrHandler 模拟二维码接口，返回PNG图片
+func qrHandler(tb testing.TB) fasthttp.RequestHandler {
+	png, err := GenerateQRCode("https://example.com/?payment=1&categories=1")
+	if err != nil {
+		tb.Fatalf("GenerateQRCode: %v", err)
+	}
+	return func(ctx *fasthttp.RequestCtx) {
+		ctx.SetContentType("image/png")
+		ctx.SetBody(png)
+	}
+}
+
+// compressRequest 构造接受gzip的请求并交给handler处理
+func compressRequest(handler fasthttp.RequestHandler) *fasthttp.RequestCtx {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/qrcode")
+	ctx.Request.Header.Set("Accept-Encoding", "gzip")
+	handler(&ctx)
+	return &ctx
+}
+
+func TestCompressHandlerSkipsImagesAndSmallBodies(t *testing.T) {
+	jsonBody := `{"data":"` + strings.Repeat("a", 2048) + `"}`
+	tests := []struct {
+		name       string
+		handler    fasthttp.RequestHandler
+		compressed bool
+	}{
+		{"png", qrHandler(t), false},
+		{"small json", func(ctx *fasthttp.RequestCtx) {
+			ctx.SetContentType("application/json")
+			ctx.SetBodyString(`{"ok":true}`)
+		}, false},
+		{"large json", func(ctx *fasthttp.RequestCtx) {
+			ctx.SetContentType("application/json")
+			ctx.SetBodyString(jsonBody)
+		}, true},
+	}
+	for _, tt := range tests {
+		ctx := compressRequest(CompressHandler(tt.handler, fasthttp.CompressDefaultCompression, 1024, []string{"image/"}))
+		encoding := string(ctx.Response.Header.ContentEncoding())
+		if compressed := encoding != ""; compressed != tt.compressed {
+			t.Errorf("%s: Content-Encoding = %q, want compressed %t", tt.name, encoding, tt.compressed)
+		}
+	}
+}
+
+// gzipAll 不区分内容类型压缩所有响应，作为二维码PNG被重复压缩时的对照
+func gzipAll(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		h(ctx)
+		ctx.Response.SetBodyRaw(fasthttp.AppendGzipBytesLevel(nil, ctx.Response.Body(), fasthttp.CompressDefaultCompression))
+		ctx.Response.Header.SetContentEncoding("gzip")
+	}
+}
+
+// BenchmarkQRCode 对比压缩二维码PNG与跳过图片时二维码接口的CPU开销
+func BenchmarkQRCode(b *testing.B) {
+	for _, bm := range []struct {
+		name    string
+		handler fasthttp.RequestHandler
+	}{
+		{"gzip_png", gzipAll(qrHandler(b))},
+		{"skip_images", CompressHandler(qrHandler(b), fasthttp.CompressDefaultCompression, 1024, []string{"image/"})},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				compressRequest(bm.handler)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// IsOriginAllowed 校验请求的Origin是否在允许列表中
+// 列表为空时仅允许同域（Origin的host与请求的Host一致）；列表中的"*"表示允许所有域名
+func IsOriginAllowed(origin, host string, allowed []string) bool {
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		return strings.EqualFold(u.Host, host)
+	}
+
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(strings.TrimRight(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRedirectAllowed 校验跳转地址是否安全，防止开放重定向
+// 站内相对路径始终允许；绝对地址仅允许http/https，且主机为当前Host或在允许列表中
+func IsRedirectAllowed(rawURL, host string, allowedHosts []string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	if u.Scheme == "" && u.Host == "" {
+		// 相对路径，排除"//evil.com"和"/\evil.com"这类协议相对地址
+		return strings.HasPrefix(rawURL, "/") && !strings.HasPrefix(rawURL, "//") && !strings.HasPrefix(rawURL, "/\\")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true
+	}
+	for _, h := range allowedHosts {
+		if strings.EqualFold(h, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidHost 校验Host头是否为合法的主机名（可带端口），拒绝包含路径、用户信息等字符的伪造值
+func IsValidHost(host string) bool {
+	if host == "" || strings.ContainsAny(host, "/\\@?#% \t\r\n") {
+		return false
+	}
+	u, err := url.Parse("http://" + host)
+	return err == nil && u.Host == host
+}
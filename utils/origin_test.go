@@ -0,0 +1,79 @@
+package utils
+
+import "testing"
+
+func TestIsOriginAllowed(t *testing.T) {
+	tests := []struct {
+		origin  string
+		host    string
+		allowed []string
+		want    bool
+	}{
+		// 未配置允许列表时仅允许同域
+		{"https://donate.example.com", "donate.example.com", nil, true},
+		{"https://DONATE.example.com", "donate.example.com", nil, true},
+		{"https://evil.com", "donate.example.com", nil, false},
+		{"https://donate.example.com:8443", "donate.example.com", nil, false},
+		{"", "donate.example.com", nil, false},
+		{"://bad", "donate.example.com", nil, false},
+		// 配置允许列表后按完整Origin匹配，忽略末尾斜杠和大小写
+		{"https://screen.example.com", "donate.example.com", []string{"https://screen.example.com/"}, true},
+		{"https://Screen.Example.com", "donate.example.com", []string{"https://screen.example.com"}, true},
+		{"http://screen.example.com", "donate.example.com", []string{"https://screen.example.com"}, false},
+		{"https://donate.example.com", "donate.example.com", []string{"https://screen.example.com"}, false},
+		{"https://screen.example.com.evil.com", "donate.example.com", []string{"https://screen.example.com"}, false},
+		{"https://anything.com", "donate.example.com", []string{"*"}, true},
+	}
+	for _, tt := range tests {
+		if got := IsOriginAllowed(tt.origin, tt.host, tt.allowed); got != tt.want {
+			t.Errorf("IsOriginAllowed(%q, %q, %q) = %t, want %t", tt.origin, tt.host, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestIsRedirectAllowed(t *testing.T) {
+	allowed := []string{"thanks.example.com"}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"/pay?authorized=1", true},
+		{"/", true},
+		{"http://donate.example.com/pay", true},
+		{"https://DONATE.example.com/", true},
+		{"https://thanks.example.com/done", true},
+		{"https://evil.com/", false},
+		{"https://donate.example.com.evil.com/", false},
+		{"//evil.com/", false},
+		{"/\\evil.com", false},
+		{"pay", false},
+		{"javascript:alert(1)", false},
+		{"ftp://donate.example.com/", false},
+		{"https://user@evil.com/", false},
+		{"http://[::1", false},
+	}
+	for _, tt := range tests {
+		if got := IsRedirectAllowed(tt.url, "donate.example.com", allowed); got != tt.want {
+			t.Errorf("IsRedirectAllowed(%q) = %t, want %t", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"donate.example.com":      true,
+		"donate.example.com:8080": true,
+		"127.0.0.1:9090":          true,
+		"":                        false,
+		"evil.com/path":           false,
+		"user@evil.com":           false,
+		"evil.com?x=1":            false,
+		"evil.com#frag":           false,
+		"evil .com":               false,
+		"evil.com\r\nX-Test: 1":   false,
+	} {
+		if got := IsValidHost(host); got != want {
+			t.Errorf("IsValidHost(%q) = %t, want %t", host, got, want)
+		}
+	}
+}
@@ -2,14 +2,34 @@ package utils
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"log"
+	"os"
 	"os/exec"
+	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 // KillProcessUsingPort 检测并杀死占用指定端口的进程
+// 仅支持类Unix系统且依赖lsof/kill命令；不支持的平台或缺少命令时仅打印警告并返回nil
 func KillProcessUsingPort(port int) error {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd":
+	default:
+		log.Printf("Warning: KillProcessUsingPort is not supported on %s, skipping", runtime.GOOS)
+		return nil
+	}
+
+	for _, tool := range []string{"lsof", "kill"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			log.Printf("Warning: %s not found, skipping port %d check", tool, port)
+			return nil
+		}
+	}
+
 	// 构建lsof命令来查找占用端口的进程
 	cmd := exec.Command("lsof", "-i", fmt.Sprintf(":%d", port))
 	var out bytes.Buffer
@@ -42,7 +62,7 @@ func KillProcessUsingPort(port int) error {
 		// 尝试将第二个字段转换为进程ID
 		pidStr := parts[1]
 		pid, err := strconv.Atoi(pidStr)
-		if err != nil {
+		if err != nil || pid == os.Getpid() {
 			continue
 		}
 
@@ -62,3 +82,8 @@ func KillProcessUsingPort(port int) error {
 
 	return nil
 }
+
+// IsAddrInUse 判断监听失败是否因为端口已被占用
+func IsAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// freePort 返回当前未被占用的端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+func TestKillProcessUsingFreePort(t *testing.T) {
+	if err := KillProcessUsingPort(freePort(t)); err != nil {
+		t.Errorf("KillProcessUsingPort(free port) = %v, want nil", err)
+	}
+}
+
+func TestKillProcessUsingPortWithoutTools(t *testing.T) {
+	// PATH中找不到lsof/kill时只打印警告，不报错
+	t.Setenv("PATH", t.TempDir())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	if err := KillProcessUsingPort(listener.Addr().(*net.TCPAddr).Port); err != nil {
+		t.Errorf("KillProcessUsingPort without lsof/kill = %v, want nil", err)
+	}
+}
+
+func TestKillProcessUsingPortSkipsSelf(t *testing.T) {
+	// 占用端口的是当前进程时不杀死自己
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	if err := KillProcessUsingPort(listener.Addr().(*net.TCPAddr).Port); err != nil {
+		t.Errorf("KillProcessUsingPort(own port) = %v, want nil", err)
+	}
+}
+
+func TestIsAddrInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	_, err = net.Listen("tcp", listener.Addr().String())
+	if !IsAddrInUse(err) {
+		t.Errorf("IsAddrInUse(%v) = false, want true", err)
+	}
+	if IsAddrInUse(errors.New("other")) || !IsAddrInUse(syscall.EADDRINUSE) {
+		t.Error("IsAddrInUse misclassified plain errors")
+	}
+}
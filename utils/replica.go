@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ReadDB 只读副本连接，未配置副本时为nil，此时读查询使用主库DB
+var ReadDB *gorm.DB
+
+// InitReadDatabase 连接只读副本（config: mysql.read_dsn）
+func InitReadDatabase(dsn string) error {
+	logLevel := logger.Info
+	if os.Getenv("GO_ENV") == "production" {
+		logLevel = logger.Error // 生产环境只记录错误
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logLevel),
+	})
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxIdleConns(30)
+	sqlDB.SetMaxOpenConns(300)
+	sqlDB.SetConnMaxLifetime(5 * time.Minute)
+	sqlDB.SetConnMaxIdleTime(1 * time.Minute)
+
+	ReadDB = db
+	log.Printf("Read replica connection pool configured")
+	return nil
+}
+
+// Reader 获取只读查询使用的连接（排行榜、统计、分类和配置读取），未配置副本时返回主库
+// 写入及写后立即读取的查询应使用DB
+func Reader() *gorm.DB {
+	if ReadDB != nil {
+		return ReadDB
+	}
+	return DB
+}
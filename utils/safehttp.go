@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 安全HTTP请求相关错误
+var (
+	// ErrUnsafeURL 地址不是http(s)或解析失败
+	ErrUnsafeURL = errors.New("unsafe url")
+	// ErrUnsafeAddress 目标主机解析到内网、回环、链路本地等非公网地址
+	ErrUnsafeAddress = errors.New("unsafe address")
+	// ErrResponseTooLarge 响应超过大小限制
+	ErrResponseTooLarge = errors.New("response too large")
+)
+
+// 默认限制：超时10秒，响应最大2MB，最多跟随5次重定向
+const (
+	defaultSafeTimeout   = 10 * time.Second
+	defaultSafeMaxBytes  = 2 << 20
+	defaultSafeRedirects = 5
+)
+
+// cgnatNet 运营商级NAT地址段（100.64.0.0/10），同样视为内网
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP 是否为公网单播地址，内网、回环、链路本地（含169.254.169.254元数据地址）、组播、未指定地址均返回false
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || !ip.IsGlobalUnicast() {
+		return false
+	}
+	return !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !cgnatNet.Contains(ip)
+}
+
+// SafeResponse 安全请求的响应，Body已完整读取
+type SafeResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// SafeFetcher 请求外部（用户或网关提供的）地址的HTTP客户端，防止SSRF
+// 连接建立时校验实际解析到的IP（防止DNS重绑定），重定向目标同样校验协议和地址
+type SafeFetcher struct {
+	Timeout time.Duration
+	// CheckRedirect 额外的重定向校验（如域名白名单），可为nil
+	CheckRedirect func(req *http.Request) error
+
+	client *http.Client
+	once   sync.Once
+}
+
+var defaultFetcher SafeFetcher
+
+// SafeHTTPGet 使用默认限制安全地GET外部地址
+func SafeHTTPGet(rawURL string) (*SafeResponse, error) {
+	return defaultFetcher.Get(rawURL, 0)
+}
+
+// SafeHTTPPost 使用默认限制安全地POST到外部地址（如Webhook）
+func SafeHTTPPost(rawURL string, contentType string, body io.Reader) (*SafeResponse, error) {
+	if err := checkSafeURL(rawURL); err != nil {
+		return nil, err
+	}
+	resp, err := defaultFetcher.Client().Post(rawURL, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	return readSafeResponse(resp, 0)
+}
+
+// Get 安全地GET外部地址，maxBytes为0时使用默认大小限制
+func (f *SafeFetcher) Get(rawURL string, maxBytes int64) (*SafeResponse, error) {
+	if err := checkSafeURL(rawURL); err != nil {
+		return nil, err
+	}
+	resp, err := f.Client().Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return readSafeResponse(resp, maxBytes)
+}
+
+// Client 获取底层HTTP客户端，首次调用时创建
+func (f *SafeFetcher) Client() *http.Client {
+	f.once.Do(func() {
+		timeout := f.Timeout
+		if timeout <= 0 {
+			timeout = defaultSafeTimeout
+		}
+		dialer := &net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if !IsPublicIP(net.ParseIP(host)) {
+					return fmt.Errorf("%w: %s", ErrUnsafeAddress, host)
+				}
+				return nil
+			},
+		}
+		f.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 5 * time.Second,
+			},
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= defaultSafeRedirects {
+					return errors.New("too many redirects")
+				}
+				if err := checkSafeURL(req.URL.String()); err != nil {
+					return err
+				}
+				if f.CheckRedirect != nil {
+					return f.CheckRedirect(req)
+				}
+				return nil
+			},
+		}
+	})
+	return f.client
+}
+
+// checkSafeURL 仅允许http(s)地址，主机为IP时直接校验是否为公网地址
+func checkSafeURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrUnsafeURL
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrUnsafeAddress, ip)
+	}
+	return nil
+}
+
+// readSafeResponse 读取响应，超过大小限制时返回ErrResponseTooLarge
+func readSafeResponse(resp *http.Response, maxBytes int64) (*SafeResponse, error) {
+	defer resp.Body.Close()
+	if maxBytes <= 0 {
+		maxBytes = defaultSafeMaxBytes
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, ErrResponseTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, ErrResponseTooLarge
+	}
+	return &SafeResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"101.34.24.139", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"10.0.0.1", false},
+		{"10.255.255.255", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("IsPublicIP(%s) = %t, want %t", tt.ip, got, tt.want)
+		}
+	}
+	if IsPublicIP(nil) {
+		t.Error("IsPublicIP(nil) = true, want false")
+	}
+}
+
+func TestCheckSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://example.com/avatar.png", nil},
+		{"http://8.8.8.8/", nil},
+		{"http://127.0.0.1:8080/", ErrUnsafeAddress},
+		{"http://169.254.169.254/latest/meta-data/", ErrUnsafeAddress},
+		{"http://10.1.2.3/", ErrUnsafeAddress},
+		{"http://100.64.0.1/", ErrUnsafeAddress},
+		{"http://[::1]/", ErrUnsafeAddress},
+		{"file:///etc/passwd", ErrUnsafeURL},
+		{"gopher://example.com/", ErrUnsafeURL},
+		{"ftp://example.com/", ErrUnsafeURL},
+		{"http:///no-host", ErrUnsafeURL},
+		{"://bad", ErrUnsafeURL},
+	}
+	for _, tt := range tests {
+		err := checkSafeURL(tt.url)
+		if tt.want == nil && err != nil {
+			t.Errorf("checkSafeURL(%q) = %v, want nil", tt.url, err)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("checkSafeURL(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestSafeHTTPGetRejectsPrivateHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	// 直接使用回环IP，请求前即被拒绝
+	if _, err := SafeHTTPGet(server.URL); !errors.Is(err, ErrUnsafeAddress) {
+		t.Errorf("SafeHTTPGet(%s) = %v, want ErrUnsafeAddress", server.URL, err)
+	}
+
+	// 域名解析到回环地址时，在建立连接时被拒绝（防止DNS重绑定）
+	localURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	if _, err := SafeHTTPGet(localURL); !errors.Is(err, ErrUnsafeAddress) {
+		t.Errorf("SafeHTTPGet(%s) = %v, want ErrUnsafeAddress", localURL, err)
+	}
+}
+
+func TestSafeFetcherRejectsPrivateRedirects(t *testing.T) {
+	var fetcher SafeFetcher
+	checkRedirect := fetcher.Client().CheckRedirect
+
+	for _, target := range []string{"http://127.0.0.1/", "http://169.254.169.254/latest/meta-data/", "http://10.0.0.1/", "http://[::1]/", "file:///etc/passwd"} {
+		req, err := http.NewRequest("GET", target, nil)
+		if err != nil {
+			t.Fatalf("new request %s: %v", target, err)
+		}
+		if err := checkRedirect(req, nil); err == nil {
+			t.Errorf("redirect to %s allowed, want rejected", target)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	if err := checkRedirect(req, nil); err != nil {
+		t.Errorf("redirect to public host rejected: %v", err)
+	}
+	if err := checkRedirect(req, make([]*http.Request, defaultSafeRedirects)); err == nil {
+		t.Error("redirect past the limit allowed, want rejected")
+	}
+}
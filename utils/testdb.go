@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/glebarez/sqlite"
+	"github.com/zhifu/donation-rank/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBSeq int64
+
+// InitTestDB 测试用：打开独立的内存SQLite数据库并迁移所有表，替换全局DB
+// 依赖纯Go实现的SQLite驱动github.com/glebarez/sqlite（无需cgo），返回的清理函数会关闭数据库并恢复原来的DB
+func InitTestDB() func() {
+	dsn := fmt.Sprintf("file:testdb%d?mode=memory&cache=shared", atomic.AddInt64(&testDBSeq, 1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		panic(fmt.Sprintf("open test db: %v", err))
+	}
+	if err := db.AutoMigrate(&models.Donation{}, &models.Category{}, &models.PaymentConfig{}, &models.WechatUser{}, &models.AlipayUser{}, &models.DonationAuditLog{}, &models.DailyReport{}, &models.CampaignArchive{}); err != nil {
+		panic(fmt.Sprintf("migrate test db: %v", err))
+	}
+
+	oldDB, oldReadDB := DB, ReadDB
+	DB, ReadDB = db, nil
+	return func() {
+		DB, ReadDB = oldDB, oldReadDB
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
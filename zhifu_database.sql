@@ -28,10 +28,16 @@ CREATE TABLE IF NOT EXISTS payment_configs (
     logo_url VARCHAR(255) COMMENT 'logo地址',
     title2 VARCHAR(255) COMMENT '标题2',
     title3 VARCHAR(255) COMMENT '标题3',
+    success_redirect_url VARCHAR(255) COMMENT '支付完成跳转地址',
+    tier_thresholds VARCHAR(255) COMMENT '捐款档位阈值（元，逗号分隔）',
+    subject_prefix VARCHAR(50) COMMENT '交易概述前缀',
+    enabled_payments VARCHAR(50) COMMENT '可用支付方式（逗号分隔）',
     wechat_app_id VARCHAR(50) COMMENT '微信AppID',
     wechat_app_secret VARCHAR(100) COMMENT '微信AppSecret',
     wechat_token VARCHAR(100) COMMENT '微信Token',
     wechat_aes_key VARCHAR(100) COMMENT '微信AESKey',
+    wechat_mini_app_id VARCHAR(50) COMMENT '微信小程序AppID',
+    wechat_mini_app_secret VARCHAR(100) COMMENT '微信小程序AppSecret',
     alipay_app_id VARCHAR(50) COMMENT '支付宝AppID',
     alipay_public_key VARCHAR(500) COMMENT '支付宝公钥',
     alipay_private_key VARCHAR(500) COMMENT '应用私钥',
@@ -50,6 +56,8 @@ CREATE TABLE IF NOT EXISTS categories (
     name VARCHAR(50) COMMENT '类目名称',
     payment_config_id VARCHAR(20) COMMENT '支付配置ID',
     payment VARCHAR(20) COMMENT '支付参数',
+    subject_prefix VARCHAR(50) COMMENT '交易概述前缀',
+    milestone_step DECIMAL(10,2) DEFAULT 0 COMMENT '累计金额里程碑步长（元）',
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
     INDEX idx_payment_config_id (payment_config_id),
@@ -96,23 +104,70 @@ CREATE TABLE IF NOT EXISTS donations (
     id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     openid VARCHAR(50) COMMENT '微信openid或支付宝user_id',
     payer_uid VARCHAR(50) COMMENT '支付回调中的payer_uid',
+    transaction_id VARCHAR(64) COMMENT '支付通道交易号',
     amount DECIMAL(10,2) COMMENT '金额',
+    amount_cents BIGINT DEFAULT 0 COMMENT '金额（分），用于统计合计',
+    fee DECIMAL(10,2) DEFAULT 0 COMMENT '平台手续费',
+    refunded_amount DECIMAL(10,2) DEFAULT 0 COMMENT '已退款金额',
     payment VARCHAR(20) COMMENT '支付方式: wechat, alipay',
     payment_config_id VARCHAR(20) COMMENT '支付配置ID',
     categories VARCHAR(20) COMMENT '捐款类目',
     blessing VARCHAR(200) COMMENT '祝福语',
+    blessing_approved BOOLEAN DEFAULT TRUE COMMENT '祝福语是否审核通过',
     order_id VARCHAR(50) COMMENT '订单ID',
-    status VARCHAR(20) COMMENT '状态: pending, completed',
+    status VARCHAR(20) COMMENT '状态: pending, completed, failed, refunded',
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
     INDEX idx_payment (payment),
     INDEX idx_payment_config_id (payment_config_id),
     INDEX idx_categories (categories),
     INDEX idx_order_id (order_id),
+    INDEX idx_transaction_id (transaction_id),
     INDEX idx_status (status),
     INDEX idx_created_at (created_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- 6. 捐款修改日志表
+CREATE TABLE IF NOT EXISTS donation_audit_logs (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    order_id VARCHAR(50) COMMENT '订单ID',
+    action VARCHAR(20) COMMENT '操作: edit',
+    changes TEXT COMMENT '修改内容（JSON）',
+    operator VARCHAR(50) COMMENT '操作来源',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    INDEX idx_order_id (order_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 7. 每日汇总报告表
+CREATE TABLE IF NOT EXISTS daily_reports (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    report_date VARCHAR(10) COMMENT '报告日期',
+    summary TEXT COMMENT '汇总内容（JSON）',
+    delivered TINYINT(1) DEFAULT 0 COMMENT '是否已发送',
+    delivery_error VARCHAR(500) COMMENT '最近一次发送失败原因',
+    attempts INT DEFAULT 0 COMMENT '发送尝试次数',
+    delivered_at DATETIME NULL COMMENT '发送时间',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    UNIQUE INDEX idx_report_date (report_date)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 8. 活动周期归档表
+CREATE TABLE IF NOT EXISTS campaign_archives (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    payment_config_id VARCHAR(50) COMMENT '支付配置ID（为空表示全部项目）',
+    category_id VARCHAR(50) COMMENT '分类ID（为空表示全部分类）',
+    period_start DATETIME NULL COMMENT '上一周期开始时间',
+    period_end DATETIME COMMENT '上一周期结束时间（新周期开始时间）',
+    donation_count BIGINT DEFAULT 0 COMMENT '捐款笔数',
+    donor_count BIGINT DEFAULT 0 COMMENT '捐款人数',
+    total_cents BIGINT DEFAULT 0 COMMENT '累计金额（分）',
+    note VARCHAR(255) COMMENT '备注',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    INDEX idx_campaign_scope (payment_config_id, category_id),
+    INDEX idx_period_end (period_end)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- 插入默认数据
 
 -- 1. 默认支付配置
@@ -142,11 +197,11 @@ INSERT INTO categories (name, payment_config_id, payment) VALUES
 
 -- 3. 测试数据（可选）
 INSERT INTO donations (
-    openid, amount, payment, payment_config_id, categories, blessing, order_id, status
+    openid, amount, amount_cents, payment, payment_config_id, categories, blessing, order_id, status
 ) VALUES
-('test_openid_1', 100.00, 'wechat', '1', '1', '阿弥陀佛', 'test_order_1', 'completed'),
-('test_openid_2', 50.00, 'alipay', '1', '2', '功德无量', 'test_order_2', 'completed'),
-('test_openid_3', 200.00, 'wechat', '1', '3', '福慧双修', 'test_order_3', 'completed');
+('test_openid_1', 100.00, 10000, 'wechat', '1', '1', '阿弥陀佛', 'test_order_1', 'completed'),
+('test_openid_2', 50.00, 5000, 'alipay', '1', '2', '功德无量', 'test_order_2', 'completed'),
+('test_openid_3', 200.00, 20000, 'wechat', '1', '3', '福慧双修', 'test_order_3', 'completed');
 
 -- 查看创建的表结构
 SHOW TABLES;